@@ -0,0 +1,176 @@
+// Command dlq inspects and replays dead-lettered messages.
+//
+// Usage:
+//
+//	dlq [-config path] list   -subject events.v1.room.ended [-after id] [-limit 20]
+//	dlq [-config path] replay -subject events.v1.room.ended (-id id | -all)
+//
+// -subject is the original subject; the configured dead-letter suffix is appended automatically.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/weiawesome/wesio-live/libs/config"
+	"github.com/weiawesome/wesio-live/libs/messaging"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "dlq:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	global := flag.NewFlagSet("dlq", flag.ContinueOnError)
+	configPath := global.String("config", "", "path to the configuration file")
+	if err := global.Parse(args); err != nil {
+		return err
+	}
+	if global.NArg() == 0 {
+		return errors.New("missing command: list or replay")
+	}
+
+	cfg, err := config.LoadConfig(*configPath, "")
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	queue, err := openQueue(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer queue.Close()
+
+	suffix := messaging.ConsumerOptionsFromConfig(cfg.MessageQueue).DeadLetterSuffix
+	if suffix == "" {
+		suffix = messaging.DefaultConsumerOptions().DeadLetterSuffix
+	}
+
+	command, commandArgs := global.Arg(0), global.Args()[1:]
+	switch command {
+	case "list":
+		return list(ctx, queue, suffix, commandArgs)
+	case "replay":
+		return replay(ctx, queue, suffix, commandArgs)
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// browsableQueue is a queue that also supports browsing subjects
+type browsableQueue interface {
+	messaging.Queue
+	messaging.Browser
+}
+
+func openQueue(ctx context.Context, cfg *config.Config) (browsableQueue, error) {
+	switch {
+	case cfg.IsRedis():
+		return messaging.CreateRedisStreamQueue(ctx, cfg)
+	default:
+		return nil, fmt.Errorf("message queue type %q does not support browsing dead letters", cfg.MessageQueue.Type)
+	}
+}
+
+func list(ctx context.Context, queue browsableQueue, suffix string, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	subject := fs.String("subject", "", "original subject")
+	after := fs.String("after", "", "only list dead letters after this message ID")
+	limit := fs.Int64("limit", 20, "maximum number of dead letters to list")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *subject == "" {
+		return errors.New("-subject is required")
+	}
+
+	dlqSubject := messaging.DeadLetterSubject(*subject, suffix)
+	deadLetters, err := messaging.ListDeadLetters(ctx, queue, dlqSubject, *after, *limit)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tGROUP\tATTEMPTS\tFAILED AT\tEVENT ID\tERROR")
+	for _, dl := range deadLetters {
+		failedAt := ""
+		if !dl.FailedAt.IsZero() {
+			failedAt = dl.FailedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n",
+			dl.ID,
+			dl.Group,
+			dl.Attempts,
+			failedAt,
+			dl.Headers[messaging.DefaultIDHeader],
+			strings.ReplaceAll(dl.Error, "\n", " "),
+		)
+	}
+	return w.Flush()
+}
+
+func replay(ctx context.Context, queue browsableQueue, suffix string, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	subject := fs.String("subject", "", "original subject")
+	id := fs.String("id", "", "dead letter message ID to replay")
+	all := fs.Bool("all", false, "replay every dead letter of the subject")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *subject == "" {
+		return errors.New("-subject is required")
+	}
+	if (*id == "") == !*all {
+		return errors.New("exactly one of -id or -all is required")
+	}
+
+	dlqSubject := messaging.DeadLetterSubject(*subject, suffix)
+	replayed := 0
+	after := ""
+	for {
+		deadLetters, err := messaging.ListDeadLetters(ctx, queue, dlqSubject, after, 100)
+		if err != nil {
+			return err
+		}
+		if len(deadLetters) == 0 {
+			break
+		}
+
+		for _, dl := range deadLetters {
+			after = dl.ID
+			if *id != "" && dl.ID != *id {
+				continue
+			}
+
+			newID, err := messaging.ReplayDeadLetter(ctx, queue, queue, dlqSubject, dl)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("replayed %s -> %s %s\n", dl.ID, dl.OriginalSubject, newID)
+			replayed++
+
+			if *id != "" {
+				return nil
+			}
+		}
+	}
+
+	if *id != "" {
+		return fmt.Errorf("dead letter %s not found in %s", *id, dlqSubject)
+	}
+	fmt.Printf("replayed %d dead letters\n", replayed)
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -75,6 +76,75 @@ type MediaConfig struct {
 	BucketName    string `mapstructure:"bucket_name" yaml:"bucket_name"`
 	UseSSL        bool   `mapstructure:"use_ssl" yaml:"use_ssl"`
 	MaxUploadSize int64  `mapstructure:"max_upload_size" yaml:"max_upload_size"` // bytes
+
+	// CDN 配置
+	CDNDomain        string            `mapstructure:"cdn_domain" yaml:"cdn_domain"`                 // CDN 域名，例如 https://cdn.example.com
+	CDNSigningKey    string            `mapstructure:"cdn_signing_key" yaml:"cdn_signing_key"`       // CDN 簽名密鑰 (cloudfront 為 PEM 格式 RSA 私鑰，akamai 為十六進制密鑰)
+	CDNSigningKeyID  string            `mapstructure:"cdn_signing_key_id" yaml:"cdn_signing_key_id"` // hmac 簽名密鑰 ID，輪換密鑰時用於識別
+	CDNVerifyKeys    map[string]string `mapstructure:"cdn_verify_keys" yaml:"cdn_verify_keys"`       // 輪換期間仍然接受的舊 hmac 密鑰，密鑰 ID -> 密鑰
+	CDNSigner        string            `mapstructure:"cdn_signer" yaml:"cdn_signer"`                 // CDN 簽名方式：hmac, cloudfront, cloudflare, akamai, nginx
+	CDNKeyPairID     string            `mapstructure:"cdn_key_pair_id" yaml:"cdn_key_pair_id"`       // CloudFront 公鑰 ID
+	CDNTokenParam    string            `mapstructure:"cdn_token_param" yaml:"cdn_token_param"`       // Cloudflare/Akamai 令牌查詢參數名
+	CDNTokenLifetime string            `mapstructure:"cdn_token_lifetime" yaml:"cdn_token_lifetime"` // Cloudflare 規則中設定的令牌有效期
+
+	// 本地存儲配置 (storage_type 為 local 時使用)
+	LocalRoot     string `mapstructure:"local_root" yaml:"local_root"`           // 文件存儲根目錄
+	LocalBaseURL  string `mapstructure:"local_base_url" yaml:"local_base_url"`   // 文件下載處理器的公開 URL
+	URLSigningKey string `mapstructure:"url_signing_key" yaml:"url_signing_key"` // 本地下載鏈接與上傳會話 ID 簽名密鑰
+
+	ConnectTimeout string `mapstructure:"connect_timeout" yaml:"connect_timeout"` // 啟動時連接檢查超時時間
+
+	// Layout 存儲桶佈局配置
+	Layout MediaLayoutConfig `mapstructure:"layout" yaml:"layout"`
+
+	// Encryption 加密配置 (僅 minio、s3 支持)
+	Encryption MediaEncryptionConfig `mapstructure:"encryption" yaml:"encryption"`
+
+	// Quota 存儲配額配置
+	Quota MediaQuotaConfig `mapstructure:"quota" yaml:"quota"`
+
+	// Resilience 超時、重試與熔斷配置 (僅 minio、s3 使用)
+	Resilience MediaResilienceConfig `mapstructure:"resilience" yaml:"resilience"`
+}
+
+// MediaLayoutConfig 存儲桶佈局配置
+type MediaLayoutConfig struct {
+	Mode       string            `mapstructure:"mode" yaml:"mode"`               // per_type: 每種文件類型一個存儲桶, single: 使用 bucket_name 並按類型加前綴
+	Buckets    map[string]string `mapstructure:"buckets" yaml:"buckets"`         // per_type 模式下的存儲桶映射 (image, video, file)
+	Prefix     string            `mapstructure:"prefix" yaml:"prefix"`           // 環境/租戶前綴，例如 staging、tenant-a/production
+	AutoCreate bool              `mapstructure:"auto_create" yaml:"auto_create"` // 存儲桶不存在時自動創建
+	Region     string            `mapstructure:"region" yaml:"region"`           // 自動創建存儲桶時使用的區域
+	Policy     string            `mapstructure:"policy" yaml:"policy"`           // 自動創建存儲桶時的訪問策略：private, public-read
+	ExpireDays map[string]int    `mapstructure:"expire_days" yaml:"expire_days"` // 自動創建存儲桶時的生命週期規則，按文件類型設定過期天數
+}
+
+// MediaEncryptionConfig 加密配置
+type MediaEncryptionConfig struct {
+	Mode    string            `mapstructure:"mode" yaml:"mode"`         // none, sse-s3: 存儲端管理密鑰, sse-c: 按對象派生的客戶密鑰, envelope: 客戶端信封加密
+	KeyID   string            `mapstructure:"key_id" yaml:"key_id"`     // 主密鑰 ID (envelope 輪換密鑰時用於識別)
+	Key     string            `mapstructure:"key" yaml:"key"`           // 主密鑰，base64 編碼的 32 字節 (sse-c、envelope 必填)
+	OldKeys map[string]string `mapstructure:"old_keys" yaml:"old_keys"` // sse-c、envelope 輪換期間仍用於解密的舊主密鑰，密鑰 ID -> 密鑰
+}
+
+// MediaQuotaConfig 存儲配額配置
+type MediaQuotaConfig struct {
+	Roles map[string]map[string]MediaQuotaLimit `mapstructure:"roles" yaml:"roles"` // 角色 -> 文件類型 (image, video, file) -> 配額，default 角色用於未列出的角色
+}
+
+// MediaQuotaLimit 單一文件類型的配額
+type MediaQuotaLimit struct {
+	MaxBytes int64 `mapstructure:"max_bytes" yaml:"max_bytes"` // 總字節數上限，0 表示不限制
+	MaxCount int64 `mapstructure:"max_count" yaml:"max_count"` // 文件數量上限，0 表示不限制
+}
+
+// MediaResilienceConfig 超時、重試與熔斷配置
+type MediaResilienceConfig struct {
+	Enabled          bool   `mapstructure:"enabled" yaml:"enabled"`                     // 啟用超時、重試與熔斷
+	Timeout          string `mapstructure:"timeout" yaml:"timeout"`                     // 單次操作超時 (上傳下載以外)
+	TransferTimeout  string `mapstructure:"transfer_timeout" yaml:"transfer_timeout"`   // 單次上傳、下載超時
+	MaxAttempts      int    `mapstructure:"max_attempts" yaml:"max_attempts"`           // 冪等操作的最大嘗試次數 (含首次)
+	FailureThreshold int    `mapstructure:"failure_threshold" yaml:"failure_threshold"` // 連續失敗多少次後熔斷
+	OpenTimeout      string `mapstructure:"open_timeout" yaml:"open_timeout"`           // 熔斷後多久放行一次探測請求
 }
 
 // ChatConfig 聊天配置
@@ -87,6 +157,10 @@ type ChatConfig struct {
 type RoomConfig struct {
 	MaxParticipants int    `mapstructure:"max_participants" yaml:"max_participants"`
 	DefaultTTL      string `mapstructure:"default_ttl" yaml:"default_ttl"`
+
+	// Presence 在線狀態配置
+	PresenceTTL           string `mapstructure:"presence_ttl" yaml:"presence_ttl"`                       // 無心跳多久後視為離開
+	PresenceSweepInterval string `mapstructure:"presence_sweep_interval" yaml:"presence_sweep_interval"` // 過期會話清理間隔
 }
 
 // LoggerConfig 日誌配置
@@ -114,6 +188,9 @@ type MessageQueueConfig struct {
 
 	// Redis 特定配置
 	Redis RedisConfig `mapstructure:"redis" yaml:"redis"`
+
+	// Consumer 消費者重試與死信配置
+	Consumer ConsumerConfig `mapstructure:"consumer" yaml:"consumer"`
 }
 
 // TLSConfig TLS 配置
@@ -153,6 +230,23 @@ type RedisConfig struct {
 	DialTimeout  string `mapstructure:"dial_timeout" yaml:"dial_timeout"`
 	ReadTimeout  string `mapstructure:"read_timeout" yaml:"read_timeout"`
 	WriteTimeout string `mapstructure:"write_timeout" yaml:"write_timeout"`
+
+	// Streams 消費者組配置
+	ConsumerName  string `mapstructure:"consumer_name" yaml:"consumer_name"`   // 消費者名稱，為空時使用主機名-PID
+	BlockTimeout  string `mapstructure:"block_timeout" yaml:"block_timeout"`   // XREADGROUP 阻塞等待時間
+	BatchSize     int64  `mapstructure:"batch_size" yaml:"batch_size"`         // 每次讀取的最大消息數
+	MaxLen        int64  `mapstructure:"max_len" yaml:"max_len"`               // Stream 最大長度 (近似裁剪)，0 表示不限制
+	ClaimMinIdle  string `mapstructure:"claim_min_idle" yaml:"claim_min_idle"` // 待處理消息閒置多久後可被其他消費者接管
+	ClaimInterval string `mapstructure:"claim_interval" yaml:"claim_interval"` // 接管檢查間隔
+}
+
+// ConsumerConfig 消費者重試與死信配置
+type ConsumerConfig struct {
+	MaxAttempts      int    `mapstructure:"max_attempts" yaml:"max_attempts"`             // 最大處理次數，超過後移入死信
+	RetryBackoff     string `mapstructure:"retry_backoff" yaml:"retry_backoff"`           // 初始重試退避時間 (每次翻倍)
+	MaxRetryBackoff  string `mapstructure:"max_retry_backoff" yaml:"max_retry_backoff"`   // 最大重試退避時間 (Redis 下不超過 claim_min_idle 的一半)
+	DedupTTL         string `mapstructure:"dedup_ttl" yaml:"dedup_ttl"`                   // 事件 ID 去重記錄保存時間
+	DeadLetterSuffix string `mapstructure:"dead_letter_suffix" yaml:"dead_letter_suffix"` // 死信主題後綴
 }
 
 var globalConfig *Config
@@ -250,6 +344,83 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("invalid database port: %d", config.Database.Port)
 	}
 
+	// 驗證媒體存儲類型
+	validStorageTypes := map[string]bool{
+		"minio": true, "s3": true, "local": true,
+	}
+	if !validStorageTypes[config.Media.StorageType] {
+		return fmt.Errorf("invalid media storage type: %s", config.Media.StorageType)
+	}
+
+	// 生產環境不可使用開發用簽名密鑰 (本地下載鏈接與 MinIO 上傳會話 ID 均使用該密鑰簽名)
+	if config.Server.Mode == "production" && config.Media.URLSigningKey == DevURLSigningKey {
+		return fmt.Errorf("media url_signing_key must be set in production")
+	}
+
+	// 驗證存儲桶佈局
+	switch config.Media.Layout.Mode {
+	case "", "per_type":
+	case "single":
+		if config.Media.BucketName == "" {
+			return fmt.Errorf("media bucket_name is required for single bucket layout")
+		}
+	default:
+		return fmt.Errorf("invalid media layout mode: %s", config.Media.Layout.Mode)
+	}
+	if config.Media.Layout.Policy != "" && config.Media.Layout.Policy != "private" && config.Media.Layout.Policy != "public-read" {
+		return fmt.Errorf("invalid media layout policy: %s", config.Media.Layout.Policy)
+	}
+
+	switch config.Media.CDNSigner {
+	case "", "hmac", "cloudflare", "akamai", "nginx":
+	case "cloudfront":
+		if config.Media.CDNDomain != "" && config.Media.CDNKeyPairID == "" {
+			return fmt.Errorf("media cdn_key_pair_id is required for the cloudfront signer")
+		}
+	default:
+		return fmt.Errorf("invalid media cdn signer: %s", config.Media.CDNSigner)
+	}
+
+	// 驗證加密配置
+	switch config.Media.Encryption.Mode {
+	case "", "none":
+	case "sse-s3", "sse-c", "envelope":
+		if config.Media.StorageType == "local" {
+			return fmt.Errorf("media encryption mode %s is not supported by local storage", config.Media.Encryption.Mode)
+		}
+		if config.Media.Encryption.Mode != "sse-s3" && config.Media.Encryption.Key == "" {
+			return fmt.Errorf("media encryption key is required for %s encryption", config.Media.Encryption.Mode)
+		}
+	default:
+		return fmt.Errorf("invalid media encryption mode: %s", config.Media.Encryption.Mode)
+	}
+
+	// 驗證超時、重試與熔斷配置
+	for name, value := range map[string]string{
+		"timeout":          config.Media.Resilience.Timeout,
+		"transfer_timeout": config.Media.Resilience.TransferTimeout,
+		"open_timeout":     config.Media.Resilience.OpenTimeout,
+	} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			return fmt.Errorf("invalid media resilience %s: %s", name, value)
+		}
+	}
+	if config.Media.Resilience.MaxAttempts < 0 || config.Media.Resilience.FailureThreshold < 0 {
+		return fmt.Errorf("invalid media resilience retry or breaker settings")
+	}
+
+	// 驗證存儲配額
+	for role, limits := range config.Media.Quota.Roles {
+		for fileType, limit := range limits {
+			if limit.MaxBytes < 0 || limit.MaxCount < 0 {
+				return fmt.Errorf("invalid media quota for role %s and file type %s", role, fileType)
+			}
+		}
+	}
+
 	// 驗證日誌級別
 	validLogLevels := map[string]bool{
 		"debug": true, "info": true, "warn": true, "error": true,
@@ -392,3 +563,15 @@ func (c *Config) GetRedisURL() string {
 
 	return url
 }
+
+// ParseDuration 解析配置中的時間長度，為空、無效或不為正數時返回 def
+func ParseDuration(value string, def time.Duration) time.Duration {
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
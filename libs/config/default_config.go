@@ -1,5 +1,8 @@
 package config
 
+// DevURLSigningKey 開發環境使用的本地下載鏈接簽名密鑰，生產環境必須替換
+const DevURLSigningKey = "wesio-dev-url-signing-key"
+
 // DefaultValues 集中管理所有預設值
 var DefaultValues = map[string]interface{}{
 	// Server 預設值
@@ -25,14 +28,31 @@ var DefaultValues = map[string]interface{}{
 	"media.storage_type":    "local",
 	"media.max_upload_size": 100 * 1024 * 1024, // 100MB
 	"media.use_ssl":         false,
+	"media.local_root":      "./data/media",
+	"media.local_base_url":  "http://localhost:8080/media",
+	"media.url_signing_key": DevURLSigningKey,
+	"media.connect_timeout": "10s",
+	"media.cdn_signer":      "hmac",
+	"media.layout.mode":     "per_type",
+	"media.layout.policy":   "private",
+	"media.encryption.mode": "none",
+
+	"media.resilience.enabled":           true,
+	"media.resilience.timeout":           "10s",
+	"media.resilience.transfer_timeout":  "5m",
+	"media.resilience.max_attempts":      3,
+	"media.resilience.failure_threshold": 5,
+	"media.resilience.open_timeout":      "30s",
 
 	// Chat 預設值
 	"chat.max_message_length": 1000,
 	"chat.history_limit":      100,
 
 	// Room 預設值
-	"room.max_participants": 50,
-	"room.default_ttl":      "24h",
+	"room.max_participants":        50,
+	"room.default_ttl":             "24h",
+	"room.presence_ttl":            "30s",
+	"room.presence_sweep_interval": "10s",
 
 	// Logger 預設值
 	"logger.level":  "info",
@@ -63,6 +83,18 @@ var DefaultValues = map[string]interface{}{
 	"message_queue.redis.dial_timeout":   "5s",
 	"message_queue.redis.read_timeout":   "3s",
 	"message_queue.redis.write_timeout":  "3s",
+	"message_queue.redis.block_timeout":  "5s",
+	"message_queue.redis.batch_size":     10,
+	"message_queue.redis.max_len":        100000,
+	"message_queue.redis.claim_min_idle": "1m",
+	"message_queue.redis.claim_interval": "30s",
+
+	// Consumer 預設值
+	"message_queue.consumer.max_attempts":       5,
+	"message_queue.consumer.retry_backoff":      "1s",
+	"message_queue.consumer.max_retry_backoff":  "30s",
+	"message_queue.consumer.dedup_ttl":          "24h",
+	"message_queue.consumer.dead_letter_suffix": ".dlq",
 
 	// TLS 預設值
 	"message_queue.tls.enabled":     false,
@@ -0,0 +1,250 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	pb "github.com/weiawesome/wesio-live/libs/events/proto"
+	"github.com/weiawesome/wesio-live/libs/logger"
+	"github.com/weiawesome/wesio-live/libs/messaging"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// SchemaVersion is the current version of the event catalogue.
+// Bump it for breaking changes to any payload; consumers reject newer versions.
+const SchemaVersion uint32 = 1
+
+// Subjects events are published to
+const (
+	SubjectRoomStarted   = "events.v1.room.started"
+	SubjectRoomEnded     = "events.v1.room.ended"
+	SubjectUserBanned    = "events.v1.user.banned"
+	SubjectMediaUploaded = "events.v1.media.uploaded"
+	SubjectMessagePosted = "events.v1.message.posted"
+	SubjectViewerCount   = "events.v1.room.viewers"
+)
+
+// Message headers set on every published event
+const (
+	HeaderEventID       = "event_id"
+	HeaderEventType     = "event_type"
+	HeaderTraceID       = "trace_id"
+	HeaderSchemaVersion = "schema_version"
+)
+
+var (
+	// ErrUnknownEvent is returned for payloads or event types missing from the catalogue
+	ErrUnknownEvent = errors.New("events: unknown event type")
+	// ErrMalformedEvent is returned when a message cannot be decoded into the expected event
+	ErrMalformedEvent = errors.New("events: malformed event")
+	// ErrUnsupportedVersion is returned for events produced with a newer schema version
+	ErrUnsupportedVersion = errors.New("events: unsupported schema version")
+)
+
+// Event is the set of payload messages in the catalogue
+type Event interface {
+	proto.Message
+	*pb.RoomStarted | *pb.RoomEnded | *pb.UserBanned | *pb.MediaUploaded | *pb.MessagePosted | *pb.ViewerCountChanged
+}
+
+// Metadata carries the envelope fields supplied by the producer
+type Metadata struct {
+	AggregateID string         // ID of the entity the event is about, used for ordering
+	Producer    string         // Name of the producing service
+	Logger      *logger.Logger // Source of the trace ID, may be nil
+	OccurredAt  time.Time      // Defaults to now when zero
+}
+
+type definition struct {
+	eventType pb.EventType
+	subject   string
+}
+
+var catalogue = map[protoreflect.FullName]definition{
+	fullName(&pb.RoomStarted{}):        {pb.EventType_ROOM_STARTED, SubjectRoomStarted},
+	fullName(&pb.RoomEnded{}):          {pb.EventType_ROOM_ENDED, SubjectRoomEnded},
+	fullName(&pb.UserBanned{}):         {pb.EventType_USER_BANNED, SubjectUserBanned},
+	fullName(&pb.MediaUploaded{}):      {pb.EventType_MEDIA_UPLOADED, SubjectMediaUploaded},
+	fullName(&pb.MessagePosted{}):      {pb.EventType_MESSAGE_POSTED, SubjectMessagePosted},
+	fullName(&pb.ViewerCountChanged{}): {pb.EventType_VIEWER_COUNT_CHANGED, SubjectViewerCount},
+}
+
+func fullName(m proto.Message) protoreflect.FullName {
+	return m.ProtoReflect().Descriptor().FullName()
+}
+
+func lookup(m proto.Message) (definition, error) {
+	def, ok := catalogue[fullName(m)]
+	if !ok {
+		return definition{}, fmt.Errorf("%w: %s", ErrUnknownEvent, fullName(m))
+	}
+	return def, nil
+}
+
+// SubjectFor returns the subject events of the given type are published to
+func SubjectFor(eventType pb.EventType) (string, error) {
+	for _, def := range catalogue {
+		if def.eventType == eventType {
+			return def.subject, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownEvent, eventType)
+}
+
+// NewEnvelope wraps an event payload in a versioned envelope
+func NewEnvelope[T Event](event T, meta Metadata) (*pb.EventEnvelope, error) {
+	def, err := lookup(event)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := anypb.New(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack event payload: %w", err)
+	}
+
+	occurredAt := meta.OccurredAt
+	if occurredAt.IsZero() {
+		occurredAt = time.Now()
+	}
+
+	var traceID string
+	if meta.Logger != nil {
+		traceID = meta.Logger.GetTraceID()
+	}
+
+	return &pb.EventEnvelope{
+		EventId:       uuid.NewString(),
+		Type:          def.eventType,
+		SchemaVersion: SchemaVersion,
+		OccurredAt:    timestamppb.New(occurredAt),
+		TraceId:       traceID,
+		AggregateId:   meta.AggregateID,
+		Producer:      meta.Producer,
+		Payload:       payload,
+	}, nil
+}
+
+// Marshal encodes an envelope for transport
+func Marshal(env *pb.EventEnvelope) ([]byte, error) {
+	data, err := proto.Marshal(env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event envelope: %w", err)
+	}
+	return data, nil
+}
+
+// Unmarshal decodes an envelope and checks its schema version
+func Unmarshal(data []byte) (*pb.EventEnvelope, error) {
+	var env pb.EventEnvelope
+	if err := proto.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedEvent, err)
+	}
+	if env.GetSchemaVersion() > SchemaVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, env.GetSchemaVersion())
+	}
+	return &env, nil
+}
+
+// Unpack extracts the typed payload from an envelope
+func Unpack[T Event](env *pb.EventEnvelope) (T, error) {
+	var zero T
+	event := zero.ProtoReflect().New().Interface().(T)
+
+	def, err := lookup(event)
+	if err != nil {
+		return zero, err
+	}
+	if env.GetType() != def.eventType {
+		return zero, fmt.Errorf("%w: expected %s, got %s", ErrMalformedEvent, def.eventType, env.GetType())
+	}
+	if env.GetPayload() == nil {
+		return zero, fmt.Errorf("%w: missing payload", ErrMalformedEvent)
+	}
+	if err := env.GetPayload().UnmarshalTo(event); err != nil {
+		return zero, fmt.Errorf("%w: %v", ErrMalformedEvent, err)
+	}
+
+	return event, nil
+}
+
+// Headers returns the transport headers for an envelope
+func Headers(env *pb.EventEnvelope) map[string]string {
+	headers := map[string]string{
+		HeaderEventID:       env.GetEventId(),
+		HeaderEventType:     env.GetType().String(),
+		HeaderSchemaVersion: strconv.FormatUint(uint64(env.GetSchemaVersion()), 10),
+	}
+	if env.GetTraceId() != "" {
+		headers[HeaderTraceID] = env.GetTraceId()
+	}
+	return headers
+}
+
+// Publish wraps the event in an envelope and publishes it to the subject registered for its type
+func Publish[T Event](ctx context.Context, publisher messaging.Publisher, event T, meta Metadata) (*pb.EventEnvelope, error) {
+	env, err := NewEnvelope(event, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := PublishEnvelope(ctx, publisher, env); err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// PublishEnvelope publishes an already built envelope
+func PublishEnvelope(ctx context.Context, publisher messaging.Publisher, env *pb.EventEnvelope) error {
+	subject, err := SubjectFor(env.GetType())
+	if err != nil {
+		return err
+	}
+
+	data, err := Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	if _, err := publisher.Publish(ctx, subject, data, Headers(env)); err != nil {
+		return fmt.Errorf("failed to publish %s event: %w", env.GetType(), err)
+	}
+
+	return nil
+}
+
+// Handler processes a typed event together with its envelope
+type Handler[T Event] func(ctx context.Context, env *pb.EventEnvelope, event T) error
+
+// Subscribe consumes events of type T as part of a consumer group.
+// Messages that cannot be decoded into T are reported as permanent errors wrapping ErrMalformedEvent,
+// so a Consumer dead-letters them without retrying.
+func Subscribe[T Event](ctx context.Context, subscriber messaging.Subscriber, group string, handler Handler[T]) error {
+	var zero T
+	def, err := lookup(zero.ProtoReflect().New().Interface())
+	if err != nil {
+		return err
+	}
+
+	return subscriber.Subscribe(ctx, def.subject, group, func(ctx context.Context, msg *messaging.Message) error {
+		env, err := Unmarshal(msg.Data)
+		if err != nil {
+			return messaging.Permanent(err)
+		}
+
+		event, err := Unpack[T](env)
+		if err != nil {
+			return messaging.Permanent(err)
+		}
+
+		return handler(ctx, env, event)
+	})
+}
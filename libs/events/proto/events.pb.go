@@ -0,0 +1,774 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v5.29.3
+// source: libs/events/proto/events.proto
+
+package proto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	anypb "google.golang.org/protobuf/types/known/anypb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// 事件類型枚舉
+type EventType int32
+
+const (
+	EventType_UNSPECIFIED          EventType = 0 // 未指定
+	EventType_ROOM_STARTED         EventType = 1 // 房間開播
+	EventType_ROOM_ENDED           EventType = 2 // 房間結束
+	EventType_USER_BANNED          EventType = 3 // 用戶被封禁
+	EventType_MEDIA_UPLOADED       EventType = 4 // 媒體上傳完成
+	EventType_MESSAGE_POSTED       EventType = 5 // 聊天消息發送
+	EventType_VIEWER_COUNT_CHANGED EventType = 6 // 房間觀眾數變化
+)
+
+// Enum value maps for EventType.
+var (
+	EventType_name = map[int32]string{
+		0: "UNSPECIFIED",
+		1: "ROOM_STARTED",
+		2: "ROOM_ENDED",
+		3: "USER_BANNED",
+		4: "MEDIA_UPLOADED",
+		5: "MESSAGE_POSTED",
+		6: "VIEWER_COUNT_CHANGED",
+	}
+	EventType_value = map[string]int32{
+		"UNSPECIFIED":          0,
+		"ROOM_STARTED":         1,
+		"ROOM_ENDED":           2,
+		"USER_BANNED":          3,
+		"MEDIA_UPLOADED":       4,
+		"MESSAGE_POSTED":       5,
+		"VIEWER_COUNT_CHANGED": 6,
+	}
+)
+
+func (x EventType) Enum() *EventType {
+	p := new(EventType)
+	*p = x
+	return p
+}
+
+func (x EventType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (EventType) Descriptor() protoreflect.EnumDescriptor {
+	return file_libs_events_proto_events_proto_enumTypes[0].Descriptor()
+}
+
+func (EventType) Type() protoreflect.EnumType {
+	return &file_libs_events_proto_events_proto_enumTypes[0]
+}
+
+func (x EventType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use EventType.Descriptor instead.
+func (EventType) EnumDescriptor() ([]byte, []int) {
+	return file_libs_events_proto_events_proto_rawDescGZIP(), []int{0}
+}
+
+// 事件信封，所有跨服務事件的統一外層結構
+type EventEnvelope struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	EventId       string                 `protobuf:"bytes,1,opt,name=event_id,json=eventId,proto3" json:"event_id,omitempty"`                    // 事件 ID (UUID)
+	Type          EventType              `protobuf:"varint,2,opt,name=type,proto3,enum=events.v1.EventType" json:"type,omitempty"`               // 事件類型
+	SchemaVersion uint32                 `protobuf:"varint,3,opt,name=schema_version,json=schemaVersion,proto3" json:"schema_version,omitempty"` // 事件結構版本
+	OccurredAt    *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=occurred_at,json=occurredAt,proto3" json:"occurred_at,omitempty"`           // 事件發生時間
+	TraceId       string                 `protobuf:"bytes,5,opt,name=trace_id,json=traceId,proto3" json:"trace_id,omitempty"`                    // 追蹤 ID (來自 logger)
+	AggregateId   string                 `protobuf:"bytes,6,opt,name=aggregate_id,json=aggregateId,proto3" json:"aggregate_id,omitempty"`        // 聚合 ID (如房間 ID、用戶 ID)，用於保證順序
+	Producer      string                 `protobuf:"bytes,7,opt,name=producer,proto3" json:"producer,omitempty"`                                 // 產生事件的服務名稱
+	Payload       *anypb.Any             `protobuf:"bytes,8,opt,name=payload,proto3" json:"payload,omitempty"`                                   // 事件內容
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EventEnvelope) Reset() {
+	*x = EventEnvelope{}
+	mi := &file_libs_events_proto_events_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EventEnvelope) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EventEnvelope) ProtoMessage() {}
+
+func (x *EventEnvelope) ProtoReflect() protoreflect.Message {
+	mi := &file_libs_events_proto_events_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EventEnvelope.ProtoReflect.Descriptor instead.
+func (*EventEnvelope) Descriptor() ([]byte, []int) {
+	return file_libs_events_proto_events_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *EventEnvelope) GetEventId() string {
+	if x != nil {
+		return x.EventId
+	}
+	return ""
+}
+
+func (x *EventEnvelope) GetType() EventType {
+	if x != nil {
+		return x.Type
+	}
+	return EventType_UNSPECIFIED
+}
+
+func (x *EventEnvelope) GetSchemaVersion() uint32 {
+	if x != nil {
+		return x.SchemaVersion
+	}
+	return 0
+}
+
+func (x *EventEnvelope) GetOccurredAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.OccurredAt
+	}
+	return nil
+}
+
+func (x *EventEnvelope) GetTraceId() string {
+	if x != nil {
+		return x.TraceId
+	}
+	return ""
+}
+
+func (x *EventEnvelope) GetAggregateId() string {
+	if x != nil {
+		return x.AggregateId
+	}
+	return ""
+}
+
+func (x *EventEnvelope) GetProducer() string {
+	if x != nil {
+		return x.Producer
+	}
+	return ""
+}
+
+func (x *EventEnvelope) GetPayload() *anypb.Any {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+// 房間開播事件
+type RoomStarted struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RoomId        string                 `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`                // 房間 ID
+	UserId        string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`                // 主播用戶 ID
+	RoomName      string                 `protobuf:"bytes,3,opt,name=room_name,json=roomName,proto3" json:"room_name,omitempty"`          // 房間名稱
+	RoomTypeId    int32                  `protobuf:"varint,4,opt,name=room_type_id,json=roomTypeId,proto3" json:"room_type_id,omitempty"` // 房間類型 ID
+	RoomTags      []string               `protobuf:"bytes,5,rep,name=room_tags,json=roomTags,proto3" json:"room_tags,omitempty"`          // 房間標籤
+	StartedAt     *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`       // 開播時間
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RoomStarted) Reset() {
+	*x = RoomStarted{}
+	mi := &file_libs_events_proto_events_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RoomStarted) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RoomStarted) ProtoMessage() {}
+
+func (x *RoomStarted) ProtoReflect() protoreflect.Message {
+	mi := &file_libs_events_proto_events_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RoomStarted.ProtoReflect.Descriptor instead.
+func (*RoomStarted) Descriptor() ([]byte, []int) {
+	return file_libs_events_proto_events_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *RoomStarted) GetRoomId() string {
+	if x != nil {
+		return x.RoomId
+	}
+	return ""
+}
+
+func (x *RoomStarted) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *RoomStarted) GetRoomName() string {
+	if x != nil {
+		return x.RoomName
+	}
+	return ""
+}
+
+func (x *RoomStarted) GetRoomTypeId() int32 {
+	if x != nil {
+		return x.RoomTypeId
+	}
+	return 0
+}
+
+func (x *RoomStarted) GetRoomTags() []string {
+	if x != nil {
+		return x.RoomTags
+	}
+	return nil
+}
+
+func (x *RoomStarted) GetStartedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartedAt
+	}
+	return nil
+}
+
+// 房間結束事件
+type RoomEnded struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RoomId        string                 `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`    // 房間 ID
+	UserId        string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`    // 主播用戶 ID
+	EndedAt       *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=ended_at,json=endedAt,proto3" json:"ended_at,omitempty"` // 結束時間
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RoomEnded) Reset() {
+	*x = RoomEnded{}
+	mi := &file_libs_events_proto_events_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RoomEnded) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RoomEnded) ProtoMessage() {}
+
+func (x *RoomEnded) ProtoReflect() protoreflect.Message {
+	mi := &file_libs_events_proto_events_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RoomEnded.ProtoReflect.Descriptor instead.
+func (*RoomEnded) Descriptor() ([]byte, []int) {
+	return file_libs_events_proto_events_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *RoomEnded) GetRoomId() string {
+	if x != nil {
+		return x.RoomId
+	}
+	return ""
+}
+
+func (x *RoomEnded) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *RoomEnded) GetEndedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EndedAt
+	}
+	return nil
+}
+
+// 用戶封禁事件
+type UserBanned struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`       // 被封禁用戶 ID
+	BannedBy      string                 `protobuf:"bytes,2,opt,name=banned_by,json=bannedBy,proto3" json:"banned_by,omitempty"` // 執行封禁的管理員 ID
+	Reason        string                 `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`                     // 封禁原因
+	BannedAt      *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=banned_at,json=bannedAt,proto3" json:"banned_at,omitempty"` // 封禁時間
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UserBanned) Reset() {
+	*x = UserBanned{}
+	mi := &file_libs_events_proto_events_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserBanned) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserBanned) ProtoMessage() {}
+
+func (x *UserBanned) ProtoReflect() protoreflect.Message {
+	mi := &file_libs_events_proto_events_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserBanned.ProtoReflect.Descriptor instead.
+func (*UserBanned) Descriptor() ([]byte, []int) {
+	return file_libs_events_proto_events_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *UserBanned) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *UserBanned) GetBannedBy() string {
+	if x != nil {
+		return x.BannedBy
+	}
+	return ""
+}
+
+func (x *UserBanned) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *UserBanned) GetBannedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.BannedAt
+	}
+	return nil
+}
+
+// 媒體上傳事件
+type MediaUploaded struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	FileType       string                 `protobuf:"bytes,1,opt,name=file_type,json=fileType,proto3" json:"file_type,omitempty"`                     // 文件類型 (image, video)
+	Key            string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`                                               // 存儲鍵 (Upload 返回值)
+	Filename       string                 `protobuf:"bytes,3,opt,name=filename,proto3" json:"filename,omitempty"`                                     // 文件名
+	ContentType    string                 `protobuf:"bytes,4,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`            // MIME 類型
+	Size           int64                  `protobuf:"varint,5,opt,name=size,proto3" json:"size,omitempty"`                                            // 文件大小 (bytes)
+	UploaderUserId string                 `protobuf:"bytes,6,opt,name=uploader_user_id,json=uploaderUserId,proto3" json:"uploader_user_id,omitempty"` // 上傳者用戶 ID
+	RoomId         string                 `protobuf:"bytes,7,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`                           // 所屬房間 ID (可選)
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *MediaUploaded) Reset() {
+	*x = MediaUploaded{}
+	mi := &file_libs_events_proto_events_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MediaUploaded) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MediaUploaded) ProtoMessage() {}
+
+func (x *MediaUploaded) ProtoReflect() protoreflect.Message {
+	mi := &file_libs_events_proto_events_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MediaUploaded.ProtoReflect.Descriptor instead.
+func (*MediaUploaded) Descriptor() ([]byte, []int) {
+	return file_libs_events_proto_events_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *MediaUploaded) GetFileType() string {
+	if x != nil {
+		return x.FileType
+	}
+	return ""
+}
+
+func (x *MediaUploaded) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *MediaUploaded) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *MediaUploaded) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *MediaUploaded) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *MediaUploaded) GetUploaderUserId() string {
+	if x != nil {
+		return x.UploaderUserId
+	}
+	return ""
+}
+
+func (x *MediaUploaded) GetRoomId() string {
+	if x != nil {
+		return x.RoomId
+	}
+	return ""
+}
+
+// 聊天消息事件
+type MessagePosted struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MessageId     string                 `protobuf:"bytes,1,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"` // 消息 ID
+	RoomId        string                 `protobuf:"bytes,2,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`          // 房間 ID
+	UserId        string                 `protobuf:"bytes,3,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`          // 發送者用戶 ID
+	Content       string                 `protobuf:"bytes,4,opt,name=content,proto3" json:"content,omitempty"`                      // 消息內容
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"` // 發送時間
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MessagePosted) Reset() {
+	*x = MessagePosted{}
+	mi := &file_libs_events_proto_events_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MessagePosted) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MessagePosted) ProtoMessage() {}
+
+func (x *MessagePosted) ProtoReflect() protoreflect.Message {
+	mi := &file_libs_events_proto_events_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MessagePosted.ProtoReflect.Descriptor instead.
+func (*MessagePosted) Descriptor() ([]byte, []int) {
+	return file_libs_events_proto_events_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *MessagePosted) GetMessageId() string {
+	if x != nil {
+		return x.MessageId
+	}
+	return ""
+}
+
+func (x *MessagePosted) GetRoomId() string {
+	if x != nil {
+		return x.RoomId
+	}
+	return ""
+}
+
+func (x *MessagePosted) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *MessagePosted) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *MessagePosted) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+// 房間觀眾數變化事件
+type ViewerCountChanged struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	RoomId          string                 `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`                             // 房間 ID
+	Count           int32                  `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`                                            // 當前在線觀眾數
+	MaxParticipants int32                  `protobuf:"varint,3,opt,name=max_participants,json=maxParticipants,proto3" json:"max_participants,omitempty"` // 房間人數上限 (0 表示不限制)
+	UpdatedAt       *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`                    // 更新時間
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *ViewerCountChanged) Reset() {
+	*x = ViewerCountChanged{}
+	mi := &file_libs_events_proto_events_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ViewerCountChanged) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ViewerCountChanged) ProtoMessage() {}
+
+func (x *ViewerCountChanged) ProtoReflect() protoreflect.Message {
+	mi := &file_libs_events_proto_events_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ViewerCountChanged.ProtoReflect.Descriptor instead.
+func (*ViewerCountChanged) Descriptor() ([]byte, []int) {
+	return file_libs_events_proto_events_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ViewerCountChanged) GetRoomId() string {
+	if x != nil {
+		return x.RoomId
+	}
+	return ""
+}
+
+func (x *ViewerCountChanged) GetCount() int32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *ViewerCountChanged) GetMaxParticipants() int32 {
+	if x != nil {
+		return x.MaxParticipants
+	}
+	return 0
+}
+
+func (x *ViewerCountChanged) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+var File_libs_events_proto_events_proto protoreflect.FileDescriptor
+
+const file_libs_events_proto_events_proto_rawDesc = "" +
+	"\n" +
+	"\x1elibs/events/proto/events.proto\x12\tevents.v1\x1a\x19google/protobuf/any.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xc2\x02\n" +
+	"\rEventEnvelope\x12\x19\n" +
+	"\bevent_id\x18\x01 \x01(\tR\aeventId\x12(\n" +
+	"\x04type\x18\x02 \x01(\x0e2\x14.events.v1.EventTypeR\x04type\x12%\n" +
+	"\x0eschema_version\x18\x03 \x01(\rR\rschemaVersion\x12;\n" +
+	"\voccurred_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"occurredAt\x12\x19\n" +
+	"\btrace_id\x18\x05 \x01(\tR\atraceId\x12!\n" +
+	"\faggregate_id\x18\x06 \x01(\tR\vaggregateId\x12\x1a\n" +
+	"\bproducer\x18\a \x01(\tR\bproducer\x12.\n" +
+	"\apayload\x18\b \x01(\v2\x14.google.protobuf.AnyR\apayload\"\xd6\x01\n" +
+	"\vRoomStarted\x12\x17\n" +
+	"\aroom_id\x18\x01 \x01(\tR\x06roomId\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\x12\x1b\n" +
+	"\troom_name\x18\x03 \x01(\tR\broomName\x12 \n" +
+	"\froom_type_id\x18\x04 \x01(\x05R\n" +
+	"roomTypeId\x12\x1b\n" +
+	"\troom_tags\x18\x05 \x03(\tR\broomTags\x129\n" +
+	"\n" +
+	"started_at\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\tstartedAt\"t\n" +
+	"\tRoomEnded\x12\x17\n" +
+	"\aroom_id\x18\x01 \x01(\tR\x06roomId\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\x125\n" +
+	"\bended_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\aendedAt\"\x93\x01\n" +
+	"\n" +
+	"UserBanned\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x1b\n" +
+	"\tbanned_by\x18\x02 \x01(\tR\bbannedBy\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\x127\n" +
+	"\tbanned_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\bbannedAt\"\xd4\x01\n" +
+	"\rMediaUploaded\x12\x1b\n" +
+	"\tfile_type\x18\x01 \x01(\tR\bfileType\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x1a\n" +
+	"\bfilename\x18\x03 \x01(\tR\bfilename\x12!\n" +
+	"\fcontent_type\x18\x04 \x01(\tR\vcontentType\x12\x12\n" +
+	"\x04size\x18\x05 \x01(\x03R\x04size\x12(\n" +
+	"\x10uploader_user_id\x18\x06 \x01(\tR\x0euploaderUserId\x12\x17\n" +
+	"\aroom_id\x18\a \x01(\tR\x06roomId\"\xb5\x01\n" +
+	"\rMessagePosted\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x01 \x01(\tR\tmessageId\x12\x17\n" +
+	"\aroom_id\x18\x02 \x01(\tR\x06roomId\x12\x17\n" +
+	"\auser_id\x18\x03 \x01(\tR\x06userId\x12\x18\n" +
+	"\acontent\x18\x04 \x01(\tR\acontent\x129\n" +
+	"\n" +
+	"created_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\"\xa9\x01\n" +
+	"\x12ViewerCountChanged\x12\x17\n" +
+	"\aroom_id\x18\x01 \x01(\tR\x06roomId\x12\x14\n" +
+	"\x05count\x18\x02 \x01(\x05R\x05count\x12)\n" +
+	"\x10max_participants\x18\x03 \x01(\x05R\x0fmaxParticipants\x129\n" +
+	"\n" +
+	"updated_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt*\x91\x01\n" +
+	"\tEventType\x12\x0f\n" +
+	"\vUNSPECIFIED\x10\x00\x12\x10\n" +
+	"\fROOM_STARTED\x10\x01\x12\x0e\n" +
+	"\n" +
+	"ROOM_ENDED\x10\x02\x12\x0f\n" +
+	"\vUSER_BANNED\x10\x03\x12\x12\n" +
+	"\x0eMEDIA_UPLOADED\x10\x04\x12\x12\n" +
+	"\x0eMESSAGE_POSTED\x10\x05\x12\x18\n" +
+	"\x14VIEWER_COUNT_CHANGED\x10\x06B\x1eZ\x1cwesio-live/libs/events/protob\x06proto3"
+
+var (
+	file_libs_events_proto_events_proto_rawDescOnce sync.Once
+	file_libs_events_proto_events_proto_rawDescData []byte
+)
+
+func file_libs_events_proto_events_proto_rawDescGZIP() []byte {
+	file_libs_events_proto_events_proto_rawDescOnce.Do(func() {
+		file_libs_events_proto_events_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_libs_events_proto_events_proto_rawDesc), len(file_libs_events_proto_events_proto_rawDesc)))
+	})
+	return file_libs_events_proto_events_proto_rawDescData
+}
+
+var file_libs_events_proto_events_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_libs_events_proto_events_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_libs_events_proto_events_proto_goTypes = []any{
+	(EventType)(0),                // 0: events.v1.EventType
+	(*EventEnvelope)(nil),         // 1: events.v1.EventEnvelope
+	(*RoomStarted)(nil),           // 2: events.v1.RoomStarted
+	(*RoomEnded)(nil),             // 3: events.v1.RoomEnded
+	(*UserBanned)(nil),            // 4: events.v1.UserBanned
+	(*MediaUploaded)(nil),         // 5: events.v1.MediaUploaded
+	(*MessagePosted)(nil),         // 6: events.v1.MessagePosted
+	(*ViewerCountChanged)(nil),    // 7: events.v1.ViewerCountChanged
+	(*timestamppb.Timestamp)(nil), // 8: google.protobuf.Timestamp
+	(*anypb.Any)(nil),             // 9: google.protobuf.Any
+}
+var file_libs_events_proto_events_proto_depIdxs = []int32{
+	0, // 0: events.v1.EventEnvelope.type:type_name -> events.v1.EventType
+	8, // 1: events.v1.EventEnvelope.occurred_at:type_name -> google.protobuf.Timestamp
+	9, // 2: events.v1.EventEnvelope.payload:type_name -> google.protobuf.Any
+	8, // 3: events.v1.RoomStarted.started_at:type_name -> google.protobuf.Timestamp
+	8, // 4: events.v1.RoomEnded.ended_at:type_name -> google.protobuf.Timestamp
+	8, // 5: events.v1.UserBanned.banned_at:type_name -> google.protobuf.Timestamp
+	8, // 6: events.v1.MessagePosted.created_at:type_name -> google.protobuf.Timestamp
+	8, // 7: events.v1.ViewerCountChanged.updated_at:type_name -> google.protobuf.Timestamp
+	8, // [8:8] is the sub-list for method output_type
+	8, // [8:8] is the sub-list for method input_type
+	8, // [8:8] is the sub-list for extension type_name
+	8, // [8:8] is the sub-list for extension extendee
+	0, // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_libs_events_proto_events_proto_init() }
+func file_libs_events_proto_events_proto_init() {
+	if File_libs_events_proto_events_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_libs_events_proto_events_proto_rawDesc), len(file_libs_events_proto_events_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_libs_events_proto_events_proto_goTypes,
+		DependencyIndexes: file_libs_events_proto_events_proto_depIdxs,
+		EnumInfos:         file_libs_events_proto_events_proto_enumTypes,
+		MessageInfos:      file_libs_events_proto_events_proto_msgTypes,
+	}.Build()
+	File_libs_events_proto_events_proto = out.File
+	file_libs_events_proto_events_proto_goTypes = nil
+	file_libs_events_proto_events_proto_depIdxs = nil
+}
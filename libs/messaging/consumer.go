@@ -0,0 +1,266 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/weiawesome/wesio-live/libs/config"
+	"github.com/weiawesome/wesio-live/libs/logger"
+)
+
+// DefaultIDHeader is the header carrying the ID used for deduplication
+const DefaultIDHeader = "event_id"
+
+// permanentError marks a handler error that must not be retried
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the consumer moves the message to the dead-letter subject without retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was wrapped with Permanent
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// retryError asks the queue to redeliver a message once a delay has passed
+type retryError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *retryError) Error() string { return e.err.Error() }
+func (e *retryError) Unwrap() error { return e.err }
+
+// RetryAfter wraps a handler error so the queue redelivers the message once delay has passed,
+// instead of waiting for it to be reclaimed as abandoned
+func RetryAfter(err error, delay time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &retryError{err: err, delay: delay}
+}
+
+// RetryDelay returns the redelivery delay requested with RetryAfter
+func RetryDelay(err error) (time.Duration, bool) {
+	var r *retryError
+	if errors.As(err, &r) {
+		return r.delay, true
+	}
+	return 0, false
+}
+
+// ConsumerOptions configures retry, deduplication and dead-letter behaviour
+type ConsumerOptions struct {
+	MaxAttempts      int           // Attempts before a message is dead-lettered
+	RetryBackoff     time.Duration // Initial retry delay, doubled per attempt
+	MaxRetryBackoff  time.Duration // Upper bound for the retry delay
+	DedupTTL         time.Duration // How long processed IDs are remembered
+	DeadLetterSuffix string        // Appended to the subject to form the dead-letter subject
+	IDHeader         string        // Header used as the deduplication ID, falls back to Message.ID
+	Deduplicator     Deduplicator  // Defaults to an in-memory deduplicator
+}
+
+// DefaultConsumerOptions returns default consumer options
+func DefaultConsumerOptions() ConsumerOptions {
+	return ConsumerOptions{
+		MaxAttempts:      5,
+		RetryBackoff:     time.Second,
+		MaxRetryBackoff:  30 * time.Second,
+		DedupTTL:         24 * time.Hour,
+		DeadLetterSuffix: ".dlq",
+		IDHeader:         DefaultIDHeader,
+	}
+}
+
+// ConsumerOptionsFromConfig builds consumer options from the message queue configuration
+func ConsumerOptionsFromConfig(cfg config.MessageQueueConfig) ConsumerOptions {
+	defaults := DefaultConsumerOptions()
+	return ConsumerOptions{
+		MaxAttempts:      cfg.Consumer.MaxAttempts,
+		RetryBackoff:     config.ParseDuration(cfg.Consumer.RetryBackoff, defaults.RetryBackoff),
+		MaxRetryBackoff:  config.ParseDuration(cfg.Consumer.MaxRetryBackoff, defaults.MaxRetryBackoff),
+		DedupTTL:         config.ParseDuration(cfg.Consumer.DedupTTL, defaults.DedupTTL),
+		DeadLetterSuffix: cfg.Consumer.DeadLetterSuffix,
+	}
+}
+
+// Consumer wraps a Queue with idempotent, retrying message handling.
+// A failed message is left pending and redelivered by the queue after a backoff, so retries never
+// block the consumer loop. Messages whose handler keeps failing are published to a dead-letter
+// subject and acknowledged.
+// Consumer implements Subscriber, so it can be passed anywhere a Subscriber is expected.
+type Consumer struct {
+	queue Queue
+	opts  ConsumerOptions
+}
+
+func CreateConsumer(queue Queue, opts ConsumerOptions) *Consumer {
+	defaults := DefaultConsumerOptions()
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaults.MaxAttempts
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = defaults.RetryBackoff
+	}
+	if opts.MaxRetryBackoff <= 0 {
+		opts.MaxRetryBackoff = defaults.MaxRetryBackoff
+	}
+	if opts.DedupTTL <= 0 {
+		opts.DedupTTL = defaults.DedupTTL
+	}
+	if opts.DeadLetterSuffix == "" {
+		opts.DeadLetterSuffix = defaults.DeadLetterSuffix
+	}
+	if opts.IDHeader == "" {
+		opts.IDHeader = defaults.IDHeader
+	}
+	if opts.Deduplicator == nil {
+		opts.Deduplicator = CreateMemoryDeduplicator()
+	}
+
+	return &Consumer{
+		queue: queue,
+		opts:  opts,
+	}
+}
+
+func (c *Consumer) Subscribe(ctx context.Context, subject string, group string, handler Handler) error {
+	return c.queue.Subscribe(ctx, subject, group, c.wrap(subject, group, handler))
+}
+
+// DeadLetterSubject returns the dead-letter subject for subject
+func (c *Consumer) DeadLetterSubject(subject string) string {
+	return DeadLetterSubject(subject, c.opts.DeadLetterSuffix)
+}
+
+func (c *Consumer) wrap(subject string, group string, handler Handler) Handler {
+	return func(ctx context.Context, msg *Message) error {
+		dedupKey := group + ":" + c.messageID(msg)
+
+		seen, err := c.opts.Deduplicator.Seen(ctx, dedupKey)
+		if err != nil {
+			logger.Warn("messaging", "dedup_check", "failed to check deduplication store", map[string]interface{}{
+				"subject": subject,
+				"group":   group,
+				"id":      dedupKey,
+				"error":   err.Error(),
+			})
+		}
+		if seen {
+			logger.Debug("messaging", "dedup_skip", "skipping already processed message", map[string]interface{}{
+				"subject": subject,
+				"group":   group,
+				"id":      dedupKey,
+			})
+			return nil
+		}
+
+		attempt := int(msg.Attempts)
+		if attempt < 1 {
+			attempt = 1
+		}
+
+		handlerErr := handler(ctx, msg)
+		if handlerErr == nil {
+			c.markProcessed(ctx, dedupKey)
+			return nil
+		}
+		if ctx.Err() != nil {
+			// Shutting down; leave the message pending for redelivery
+			return handlerErr
+		}
+		if !IsPermanent(handlerErr) && attempt < c.opts.MaxAttempts {
+			delay := c.backoff(attempt)
+			logger.Warn("messaging", "retry", "handler failed, scheduling redelivery", map[string]interface{}{
+				"subject":  subject,
+				"group":    group,
+				"id":       msg.ID,
+				"attempt":  attempt,
+				"retry_in": delay.String(),
+				"error":    handlerErr.Error(),
+			})
+			return RetryAfter(handlerErr, delay)
+		}
+
+		if err := c.deadLetter(ctx, subject, group, msg, attempt, handlerErr); err != nil {
+			logger.Error("messaging", "dead_letter", "failed to dead-letter message", err, map[string]interface{}{
+				"subject": subject,
+				"group":   group,
+				"id":      msg.ID,
+			})
+			return handlerErr
+		}
+
+		// Not marked as processed, so a replay from the dead-letter subject is handled again
+		return nil
+	}
+}
+
+func (c *Consumer) deadLetter(ctx context.Context, subject string, group string, msg *Message, attempts int, cause error) error {
+	headers := make(map[string]string, len(msg.Headers)+6)
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+	headers[HeaderDeadLetterSubject] = subject
+	headers[HeaderDeadLetterGroup] = group
+	headers[HeaderDeadLetterMessageID] = msg.ID
+	headers[HeaderDeadLetterError] = cause.Error()
+	headers[HeaderDeadLetterAttempts] = strconv.Itoa(attempts)
+	headers[HeaderDeadLetterFailedAt] = time.Now().UTC().Format(time.RFC3339)
+
+	dlqSubject := c.DeadLetterSubject(subject)
+	if _, err := c.queue.Publish(ctx, dlqSubject, msg.Data, headers); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", dlqSubject, err)
+	}
+
+	logger.Error("messaging", "dead_letter", "message moved to dead-letter subject", cause, map[string]interface{}{
+		"subject":     subject,
+		"dlq_subject": dlqSubject,
+		"group":       group,
+		"id":          msg.ID,
+		"attempts":    attempts,
+	})
+	return nil
+}
+
+func (c *Consumer) markProcessed(ctx context.Context, key string) {
+	if err := c.opts.Deduplicator.Mark(ctx, key, c.opts.DedupTTL); err != nil {
+		logger.Warn("messaging", "dedup_mark", "failed to record processed message", map[string]interface{}{
+			"id":    key,
+			"error": err.Error(),
+		})
+	}
+}
+
+func (c *Consumer) messageID(msg *Message) string {
+	if id := msg.Headers[c.opts.IDHeader]; id != "" {
+		return id
+	}
+	return msg.ID
+}
+
+// backoff returns the retry delay after the given attempt
+func (c *Consumer) backoff(attempt int) time.Duration {
+	delay := c.opts.RetryBackoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= c.opts.MaxRetryBackoff {
+			return c.opts.MaxRetryBackoff
+		}
+	}
+	return delay
+}
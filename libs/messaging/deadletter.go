@@ -0,0 +1,104 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers added to messages moved to a dead-letter subject
+const (
+	HeaderDeadLetterSubject   = "dlq_subject"
+	HeaderDeadLetterGroup     = "dlq_group"
+	HeaderDeadLetterMessageID = "dlq_message_id"
+	HeaderDeadLetterError     = "dlq_error"
+	HeaderDeadLetterAttempts  = "dlq_attempts"
+	HeaderDeadLetterFailedAt  = "dlq_failed_at"
+)
+
+// Browser reads and removes messages from a subject without consuming them through a group
+type Browser interface {
+	// Browse returns up to count messages published after the given message ID ("" for the beginning)
+	Browse(ctx context.Context, subject string, after string, count int64) ([]*Message, error)
+
+	// Remove deletes messages from a subject
+	Remove(ctx context.Context, subject string, ids ...string) error
+}
+
+// DeadLetter is a message that exhausted its retries, with the failure details recorded by the Consumer
+type DeadLetter struct {
+	*Message
+
+	OriginalSubject string
+	Group           string
+	OriginalID      string
+	Error           string
+	Attempts        int
+	FailedAt        time.Time
+}
+
+// DeadLetterSubject returns the dead-letter subject for subject
+func DeadLetterSubject(subject string, suffix string) string {
+	return subject + suffix
+}
+
+// ParseDeadLetter extracts the failure details from a dead-lettered message
+func ParseDeadLetter(msg *Message) *DeadLetter {
+	dl := &DeadLetter{
+		Message:         msg,
+		OriginalSubject: msg.Headers[HeaderDeadLetterSubject],
+		Group:           msg.Headers[HeaderDeadLetterGroup],
+		OriginalID:      msg.Headers[HeaderDeadLetterMessageID],
+		Error:           msg.Headers[HeaderDeadLetterError],
+	}
+	if attempts, err := strconv.Atoi(msg.Headers[HeaderDeadLetterAttempts]); err == nil {
+		dl.Attempts = attempts
+	}
+	if failedAt, err := time.Parse(time.RFC3339, msg.Headers[HeaderDeadLetterFailedAt]); err == nil {
+		dl.FailedAt = failedAt
+	}
+	return dl
+}
+
+// ListDeadLetters returns up to limit dead letters from dlqSubject published after the given message ID
+func ListDeadLetters(ctx context.Context, browser Browser, dlqSubject string, after string, limit int64) ([]*DeadLetter, error) {
+	messages, err := browser.Browse(ctx, dlqSubject, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to browse %s: %w", dlqSubject, err)
+	}
+
+	deadLetters := make([]*DeadLetter, 0, len(messages))
+	for _, msg := range messages {
+		deadLetters = append(deadLetters, ParseDeadLetter(msg))
+	}
+	return deadLetters, nil
+}
+
+// ReplayDeadLetter republishes a dead letter to its original subject and removes it from dlqSubject.
+// Consumer groups that already processed the message skip it through deduplication.
+func ReplayDeadLetter(ctx context.Context, publisher Publisher, browser Browser, dlqSubject string, dl *DeadLetter) (string, error) {
+	if dl.OriginalSubject == "" {
+		return "", fmt.Errorf("dead letter %s has no original subject", dl.ID)
+	}
+
+	headers := make(map[string]string, len(dl.Headers))
+	for key, value := range dl.Headers {
+		if strings.HasPrefix(key, "dlq_") {
+			continue
+		}
+		headers[key] = value
+	}
+
+	id, err := publisher.Publish(ctx, dl.OriginalSubject, dl.Data, headers)
+	if err != nil {
+		return "", fmt.Errorf("failed to republish dead letter %s: %w", dl.ID, err)
+	}
+
+	if err := browser.Remove(ctx, dlqSubject, dl.ID); err != nil {
+		return id, fmt.Errorf("republished dead letter %s but failed to remove it: %w", dl.ID, err)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,62 @@
+package messaging
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Deduplicator remembers which message IDs have already been processed
+type Deduplicator interface {
+	// Seen reports whether the ID has been marked as processed
+	Seen(ctx context.Context, id string) (bool, error)
+
+	// Mark records the ID as processed for the given TTL
+	Mark(ctx context.Context, id string, ttl time.Duration) error
+}
+
+// MemoryDeduplicator is an in-process Deduplicator, suitable for single instance deployments and tests
+type MemoryDeduplicator struct {
+	mu      sync.Mutex
+	entries map[string]time.Time // id -> expiry
+}
+
+func CreateMemoryDeduplicator() *MemoryDeduplicator {
+	return &MemoryDeduplicator{
+		entries: make(map[string]time.Time),
+	}
+}
+
+func (d *MemoryDeduplicator) Seen(ctx context.Context, id string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	expiry, ok := d.entries[id]
+	if !ok {
+		return false, nil
+	}
+	if time.Now().After(expiry) {
+		delete(d.entries, id)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (d *MemoryDeduplicator) Mark(ctx context.Context, id string, ttl time.Duration) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	d.entries[id] = now.Add(ttl)
+
+	// Opportunistically drop expired entries so the map does not grow unbounded
+	if len(d.entries)%1024 == 0 {
+		for key, expiry := range d.entries {
+			if now.After(expiry) {
+				delete(d.entries, key)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrClosed is returned when publishing or subscribing on a closed queue
+var ErrClosed = errors.New("messaging: queue closed")
+
+// Message is a single entry delivered by a message queue
+type Message struct {
+	ID        string            // Backend assigned message ID
+	Subject   string            // Stream / subject the message was published to
+	Data      []byte            // Raw payload
+	Headers   map[string]string // Optional key-value headers
+	Attempts  int64             // Number of times the message has been delivered
+	Timestamp time.Time         // Time the message was accepted by the backend
+}
+
+// Handler processes a delivered message.
+// Returning nil acknowledges the message, returning an error leaves it pending for redelivery.
+// Errors wrapped with RetryAfter are redelivered once their delay has passed.
+type Handler func(ctx context.Context, msg *Message) error
+
+// Publisher publishes messages to a subject
+type Publisher interface {
+	Publish(ctx context.Context, subject string, data []byte, headers map[string]string) (string, error)
+}
+
+// Subscriber consumes messages from a subject as part of a consumer group.
+// Subscribe blocks until ctx is cancelled or the queue is closed.
+// The handler may be invoked concurrently, e.g. while redelivered messages are being reclaimed.
+type Subscriber interface {
+	Subscribe(ctx context.Context, subject string, group string, handler Handler) error
+}
+
+// Queue is a message queue backend supporting both publishing and consuming
+type Queue interface {
+	Publisher
+	Subscriber
+
+	Close() error
+}
+
+// sleepContext waits for d, returning false if ctx is cancelled first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
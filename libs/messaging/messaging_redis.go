@@ -0,0 +1,600 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/weiawesome/wesio-live/libs/config"
+	"github.com/weiawesome/wesio-live/libs/logger"
+)
+
+const (
+	redisFieldData    = "data"
+	redisFieldHeaders = "headers"
+)
+
+// RedisStreamQueue implements Queue on top of Redis Streams and consumer groups
+type RedisStreamQueue struct {
+	client        *redis.Client
+	consumer      string        // consumer name within the group
+	block         time.Duration // XREADGROUP block timeout
+	batchSize     int64         // max entries per read
+	maxLen        int64         // approximate stream cap, 0 for unlimited
+	claimMinIdle  time.Duration // idle time before a pending entry is reclaimed
+	claimInterval time.Duration // how often pending entries are scanned
+
+	done      chan struct{}
+	closeOnce sync.Once
+	mu        sync.Mutex // orders subscriptions starting against Close
+	wg        sync.WaitGroup
+}
+
+func CreateRedisStreamQueue(ctx context.Context, cfg *config.Config) (*RedisStreamQueue, error) {
+	opts, err := redis.ParseURL(cfg.GetRedisURL())
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+
+	redisCfg := cfg.MessageQueue.Redis
+	if opts.Username == "" && cfg.MessageQueue.Username != "" {
+		opts.Username = cfg.MessageQueue.Username
+	}
+	if opts.Password == "" && cfg.MessageQueue.Password != "" {
+		opts.Password = cfg.MessageQueue.Password
+	}
+	if opts.DB == 0 && redisCfg.DB != 0 {
+		opts.DB = redisCfg.DB
+	}
+	if redisCfg.PoolSize > 0 {
+		opts.PoolSize = redisCfg.PoolSize
+	}
+	if redisCfg.MinIdleConns > 0 {
+		opts.MinIdleConns = redisCfg.MinIdleConns
+	}
+	opts.DialTimeout = config.ParseDuration(redisCfg.DialTimeout, 5*time.Second)
+	opts.ReadTimeout = config.ParseDuration(redisCfg.ReadTimeout, 3*time.Second)
+	opts.WriteTimeout = config.ParseDuration(redisCfg.WriteTimeout, 3*time.Second)
+
+	tlsConfig, err := buildTLSConfig(cfg.MessageQueue.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		opts.TLSConfig = tlsConfig
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	consumer := redisCfg.ConsumerName
+	if consumer == "" {
+		hostname, _ := os.Hostname()
+		consumer = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+
+	batchSize := redisCfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 10
+	}
+
+	return &RedisStreamQueue{
+		client:        client,
+		consumer:      consumer,
+		block:         config.ParseDuration(redisCfg.BlockTimeout, 5*time.Second),
+		batchSize:     batchSize,
+		maxLen:        redisCfg.MaxLen,
+		claimMinIdle:  config.ParseDuration(redisCfg.ClaimMinIdle, time.Minute),
+		claimInterval: config.ParseDuration(redisCfg.ClaimInterval, 30*time.Second),
+		done:          make(chan struct{}),
+	}, nil
+}
+
+func (q *RedisStreamQueue) Publish(ctx context.Context, subject string, data []byte, headers map[string]string) (string, error) {
+	if q.isClosed() {
+		return "", ErrClosed
+	}
+
+	values := map[string]interface{}{
+		redisFieldData: data,
+	}
+	if len(headers) > 0 {
+		encoded, err := json.Marshal(headers)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode headers: %w", err)
+		}
+		values[redisFieldHeaders] = encoded
+	}
+
+	args := &redis.XAddArgs{
+		Stream: subject,
+		Values: values,
+	}
+	if q.maxLen > 0 {
+		args.MaxLen = q.maxLen
+		args.Approx = true
+	}
+
+	id, err := q.client.XAdd(ctx, args).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to publish message: %w", err)
+	}
+
+	return id, nil
+}
+
+func (q *RedisStreamQueue) Subscribe(ctx context.Context, subject string, group string, handler Handler) error {
+	if !q.track() {
+		return ErrClosed
+	}
+	defer q.wg.Done()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-q.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := q.ensureGroup(ctx, subject, group); err != nil {
+		return q.subscribeExitErr(ctx, err)
+	}
+
+	// Redeliver entries whose handler asked for a retry, and reclaim entries left pending by crashed
+	// consumers, in the background
+	retries := newRetrySchedule()
+	retryDone := make(chan struct{})
+	go func() {
+		defer close(retryDone)
+		q.retryLoop(ctx, subject, group, handler, retries)
+	}()
+	defer func() { <-retryDone }()
+
+	reclaimDone := make(chan struct{})
+	go func() {
+		defer close(reclaimDone)
+		q.reclaimLoop(ctx, subject, group, handler, retries)
+	}()
+	defer func() { <-reclaimDone }()
+
+	// Replay entries that were delivered to this consumer but never acknowledged
+	if err := q.drainOwnPending(ctx, subject, group, handler, retries); err != nil {
+		return q.subscribeExitErr(ctx, err)
+	}
+
+	for {
+		streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: q.consumer,
+			Streams:  []string{subject, ">"},
+			Count:    q.batchSize,
+			Block:    q.block,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if ctx.Err() != nil {
+				return q.subscribeExitErr(ctx, nil)
+			}
+			logger.Error("messaging", "redis_read_group", "failed to read from stream", err, map[string]interface{}{
+				"stream": subject,
+				"group":  group,
+			})
+			if !sleepContext(ctx, time.Second) {
+				return q.subscribeExitErr(ctx, nil)
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, entry := range stream.Messages {
+				q.handle(ctx, subject, group, handler, retries, entry, 1)
+			}
+		}
+	}
+}
+
+func (q *RedisStreamQueue) Close() error {
+	var err error
+	q.closeOnce.Do(func() {
+		q.mu.Lock()
+		close(q.done)
+		q.mu.Unlock()
+		q.wg.Wait()
+		err = q.client.Close()
+	})
+	return err
+}
+
+// ensureGroup creates the consumer group (and the stream) if they do not exist yet
+func (q *RedisStreamQueue) ensureGroup(ctx context.Context, subject string, group string) error {
+	err := q.client.XGroupCreateMkStream(ctx, subject, group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group: %w", err)
+	}
+	return nil
+}
+
+// drainOwnPending processes entries already assigned to this consumer, e.g. after a restart
+func (q *RedisStreamQueue) drainOwnPending(ctx context.Context, subject string, group string, handler Handler, retries *retrySchedule) error {
+	lastID := "0"
+	for {
+		streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: q.consumer,
+			Streams:  []string{subject, lastID},
+			Count:    q.batchSize,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				return nil
+			}
+			return fmt.Errorf("failed to read pending entries: %w", err)
+		}
+
+		if len(streams) == 0 || len(streams[0].Messages) == 0 {
+			return nil
+		}
+
+		entries := streams[0].Messages
+		attempts := q.deliveryCounts(ctx, subject, group, entries)
+		for _, entry := range entries {
+			q.handle(ctx, subject, group, handler, retries, entry, attempts[entry.ID])
+		}
+		lastID = entries[len(entries)-1].ID
+	}
+}
+
+// reclaimLoop periodically takes over entries that have been pending on other consumers for too long
+func (q *RedisStreamQueue) reclaimLoop(ctx context.Context, subject string, group string, handler Handler, retries *retrySchedule) {
+	ticker := time.NewTicker(q.claimInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		start := "0-0"
+		for {
+			entries, next, err := q.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+				Stream:   subject,
+				Group:    group,
+				Consumer: q.consumer,
+				MinIdle:  q.claimMinIdle,
+				Start:    start,
+				Count:    q.batchSize,
+			}).Result()
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Error("messaging", "redis_auto_claim", "failed to reclaim pending entries", err, map[string]interface{}{
+						"stream": subject,
+						"group":  group,
+					})
+				}
+				break
+			}
+
+			if len(entries) > 0 {
+				logger.Info("messaging", "redis_auto_claim", "reclaimed pending entries", map[string]interface{}{
+					"stream": subject,
+					"group":  group,
+					"count":  len(entries),
+				})
+
+				attempts := q.deliveryCounts(ctx, subject, group, entries)
+				for _, entry := range entries {
+					q.handle(ctx, subject, group, handler, retries, entry, attempts[entry.ID])
+				}
+			}
+
+			if next == "0-0" || next == "" {
+				break
+			}
+			start = next
+		}
+	}
+}
+
+// retryLoop claims entries back to this consumer once the delay their handler asked for has passed.
+// Claiming increments the delivery count, which the handler sees as the next attempt.
+func (q *RedisStreamQueue) retryLoop(ctx context.Context, subject string, group string, handler Handler, retries *retrySchedule) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		timer.Reset(retries.untilNext())
+		select {
+		case <-ctx.Done():
+			return
+		case <-retries.wake:
+			continue
+		case <-timer.C:
+		}
+
+		for _, retry := range retries.takeDue() {
+			// An entry idle for less than its delay was handled again meanwhile, e.g. after being reclaimed
+			entries, err := q.client.XClaim(ctx, &redis.XClaimArgs{
+				Stream:   subject,
+				Group:    group,
+				Consumer: q.consumer,
+				MinIdle:  retry.delay,
+				Messages: []string{retry.id},
+			}).Result()
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				logger.Error("messaging", "redis_claim", "failed to claim entry for redelivery", err, map[string]interface{}{
+					"stream": subject,
+					"group":  group,
+					"id":     retry.id,
+				})
+				continue
+			}
+
+			attempts := q.deliveryCounts(ctx, subject, group, entries)
+			for _, entry := range entries {
+				q.handle(ctx, subject, group, handler, retries, entry, attempts[entry.ID])
+			}
+		}
+	}
+}
+
+// deliveryCounts looks up how many times each entry has been delivered
+func (q *RedisStreamQueue) deliveryCounts(ctx context.Context, subject string, group string, entries []redis.XMessage) map[string]int64 {
+	counts := make(map[string]int64, len(entries))
+	if len(entries) == 0 {
+		return counts
+	}
+
+	pending, err := q.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream:   subject,
+		Group:    group,
+		Start:    entries[0].ID,
+		End:      entries[len(entries)-1].ID,
+		Count:    int64(len(entries)),
+		Consumer: q.consumer,
+	}).Result()
+	if err != nil {
+		return counts
+	}
+
+	for _, p := range pending {
+		counts[p.ID] = p.RetryCount
+	}
+	return counts
+}
+
+// handle runs the handler for a single entry and acknowledges it on success.
+// A failed entry stays pending; if the handler asked for a retry it is scheduled for redelivery,
+// otherwise it waits to be reclaimed once idle.
+func (q *RedisStreamQueue) handle(ctx context.Context, subject string, group string, handler Handler, retries *retrySchedule, entry redis.XMessage, attempts int64) {
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	msg := decodeRedisMessage(subject, entry)
+	msg.Attempts = attempts
+
+	if err := handler(ctx, msg); err != nil {
+		logger.Warn("messaging", "redis_handle", "handler failed, message left pending", map[string]interface{}{
+			"stream":   subject,
+			"group":    group,
+			"id":       entry.ID,
+			"attempts": attempts,
+			"error":    err.Error(),
+		})
+		if delay, ok := RetryDelay(err); ok && ctx.Err() == nil {
+			retries.schedule(entry.ID, q.retryDelay(delay))
+		}
+		return
+	}
+
+	if err := q.client.XAck(ctx, subject, group, entry.ID).Err(); err != nil {
+		logger.Error("messaging", "redis_ack", "failed to acknowledge message", err, map[string]interface{}{
+			"stream": subject,
+			"group":  group,
+			"id":     entry.ID,
+		})
+	}
+}
+
+// retryDelay caps a requested redelivery delay at half of claimMinIdle. An entry left idle for longer
+// would be reclaimed by any consumer of the group before its delay passed, and redelivered early.
+func (q *RedisStreamQueue) retryDelay(delay time.Duration) time.Duration {
+	return min(delay, q.claimMinIdle/2)
+}
+
+// retrySchedule holds the entries of one subscription waiting for a delayed redelivery
+type retrySchedule struct {
+	mu   sync.Mutex
+	due  map[string]scheduledRetry
+	wake chan struct{}
+}
+
+type scheduledRetry struct {
+	id    string
+	at    time.Time
+	delay time.Duration
+}
+
+func newRetrySchedule() *retrySchedule {
+	return &retrySchedule{
+		due:  make(map[string]scheduledRetry),
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// schedule redelivers the entry once delay has passed
+func (r *retrySchedule) schedule(id string, delay time.Duration) {
+	r.mu.Lock()
+	r.due[id] = scheduledRetry{id: id, at: time.Now().Add(delay), delay: delay}
+	r.mu.Unlock()
+
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// untilNext returns how long until the next retry is due
+func (r *retrySchedule) untilNext() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	wait := time.Hour
+	now := time.Now()
+	for _, retry := range r.due {
+		if d := retry.at.Sub(now); d < wait {
+			wait = max(d, 0)
+		}
+	}
+	return wait
+}
+
+// takeDue removes and returns the retries that are due
+func (r *retrySchedule) takeDue() []scheduledRetry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due []scheduledRetry
+	now := time.Now()
+	for id, retry := range r.due {
+		if !retry.at.After(now) {
+			due = append(due, retry)
+			delete(r.due, id)
+		}
+	}
+	return due
+}
+
+func (q *RedisStreamQueue) isClosed() bool {
+	select {
+	case <-q.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// track registers a starting subscription for Close to wait on, reporting false once the queue is closed
+func (q *RedisStreamQueue) track() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.isClosed() {
+		return false
+	}
+	q.wg.Add(1)
+	return true
+}
+
+// subscribeExitErr maps the reason Subscribe stopped to the error it returns
+func (q *RedisStreamQueue) subscribeExitErr(ctx context.Context, err error) error {
+	if q.isClosed() {
+		return ErrClosed
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// decodeRedisMessage converts a stream entry into a Message
+func decodeRedisMessage(subject string, entry redis.XMessage) *Message {
+	msg := &Message{
+		ID:      entry.ID,
+		Subject: subject,
+	}
+
+	if data, ok := entry.Values[redisFieldData].(string); ok {
+		msg.Data = []byte(data)
+	}
+	if raw, ok := entry.Values[redisFieldHeaders].(string); ok && raw != "" {
+		var headers map[string]string
+		if err := json.Unmarshal([]byte(raw), &headers); err == nil {
+			msg.Headers = headers
+		}
+	}
+
+	// Stream IDs are "<unix-millis>-<sequence>"
+	if millis, _, found := strings.Cut(entry.ID, "-"); found {
+		if ms, err := strconv.ParseInt(millis, 10, 64); err == nil {
+			msg.Timestamp = time.UnixMilli(ms)
+		}
+	}
+
+	return msg
+}
+
+func (q *RedisStreamQueue) Browse(ctx context.Context, subject string, after string, count int64) ([]*Message, error) {
+	start := "-"
+	if after != "" {
+		start = "(" + after
+	}
+
+	entries, err := q.client.XRangeN(ctx, subject, start, "+", count).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stream range: %w", err)
+	}
+
+	messages := make([]*Message, 0, len(entries))
+	for _, entry := range entries {
+		messages = append(messages, decodeRedisMessage(subject, entry))
+	}
+	return messages, nil
+}
+
+func (q *RedisStreamQueue) Remove(ctx context.Context, subject string, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := q.client.XDel(ctx, subject, ids...).Err(); err != nil {
+		return fmt.Errorf("failed to delete stream entries: %w", err)
+	}
+	return nil
+}
+
+// Deduplicator returns a Deduplicator storing processed IDs in Redis under the given key prefix
+func (q *RedisStreamQueue) Deduplicator(prefix string) Deduplicator {
+	return &redisDeduplicator{
+		client: q.client,
+		prefix: prefix,
+	}
+}
+
+// redisDeduplicator shares processed IDs between all instances of a consumer group
+type redisDeduplicator struct {
+	client *redis.Client
+	prefix string
+}
+
+func (d *redisDeduplicator) Seen(ctx context.Context, id string) (bool, error) {
+	n, err := d.client.Exists(ctx, d.prefix+id).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (d *redisDeduplicator) Mark(ctx context.Context, id string, ttl time.Duration) error {
+	return d.client.Set(ctx, d.prefix+id, 1, ttl).Err()
+}
@@ -0,0 +1,243 @@
+// Command quota reports and corrects media storage usage.
+//
+// Usage:
+//
+//	quota [-config path] report [-type image] [-all] [-fix]
+//	quota [-config path] usage  -user id
+//	quota [-config path] set    -user id -type image [-max-bytes n] [-max-count n]
+//	quota [-config path] unset  -user id -type image
+//
+// report recalculates usage from the files in storage and lists drifted users; -fix overwrites their
+// recorded usage. -type is image, video or file.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+
+	"github.com/weiawesome/wesio-live/libs/config"
+	"github.com/weiawesome/wesio-live/storage/media"
+	"github.com/weiawesome/wesio-live/storage/quota"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "quota:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	global := flag.NewFlagSet("quota", flag.ContinueOnError)
+	configPath := global.String("config", "", "path to the configuration file")
+	if err := global.Parse(args); err != nil {
+		return err
+	}
+	if global.NArg() == 0 {
+		return errors.New("missing command: report, usage, set or unset")
+	}
+
+	cfg, err := config.LoadConfig(*configPath, "")
+	if err != nil {
+		return err
+	}
+	policy, err := quota.PolicyFromConfig(cfg.Media.Quota)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	m, err := media.New(ctx, cfg.Media)
+	if err != nil {
+		return err
+	}
+	accountant := quota.CreateAccountant(db, m, policy)
+
+	command, commandArgs := global.Arg(0), global.Args()[1:]
+	switch command {
+	case "report":
+		return report(ctx, accountant, commandArgs)
+	case "usage":
+		return usage(ctx, accountant, commandArgs)
+	case "set":
+		return set(ctx, accountant, commandArgs)
+	case "unset":
+		return unset(ctx, accountant, commandArgs)
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func openDB(cfg *config.Config) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch cfg.Database.Type {
+	case "mysql":
+		dialector = mysql.Open(cfg.GetDatabaseURL())
+	case "sqlite", "sqlite3":
+		dialector = sqlite.Open(cfg.GetDatabaseURL())
+	default:
+		dialector = postgres.Open(cfg.GetDatabaseURL())
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return db, nil
+}
+
+// fileTypeFlag parses an optional -type flag value
+func fileTypeFlag(name string) ([]media.FileType, error) {
+	if name == "" {
+		return nil, nil
+	}
+	fileType, err := media.FileTypeFromConfigKey(name)
+	if err != nil {
+		return nil, err
+	}
+	return []media.FileType{fileType}, nil
+}
+
+func report(ctx context.Context, accountant *quota.Accountant, args []string) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	name := fs.String("type", "", "only recalculate this file type")
+	all := fs.Bool("all", false, "list every user, not only drifted ones")
+	fix := fs.Bool("fix", false, "overwrite drifted usage with the usage found in storage")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	fileTypes, err := fileTypeFlag(*name)
+	if err != nil {
+		return err
+	}
+
+	result, err := accountant.Recalculate(ctx, fileTypes, *fix)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "USER\tTYPE\tRECORDED BYTES\tSTORED BYTES\tRECORDED COUNT\tSTORED COUNT")
+	for _, e := range result.Entries {
+		if !*all && !e.Drifted() {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\n",
+			e.UserID,
+			typeName(e.FileType),
+			e.RecordedBytes,
+			e.StoredBytes,
+			e.RecordedCount,
+			e.StoredCount,
+		)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("scanned %d files, %d without owner, %d users drifted, %d fixed\n",
+		result.Scanned, result.Unowned, len(result.Drifted()), result.Fixed)
+	return nil
+}
+
+func usage(ctx context.Context, accountant *quota.Accountant, args []string) error {
+	fs := flag.NewFlagSet("usage", flag.ContinueOnError)
+	userID := fs.String("user", "", "user ID")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *userID == "" {
+		return errors.New("-user is required")
+	}
+
+	limits, err := accountant.Limits(ctx, *userID)
+	if err != nil {
+		return err
+	}
+	usages, err := accountant.Usage(ctx, *userID)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tBYTES\tMAX BYTES\tCOUNT\tMAX COUNT")
+	for _, u := range usages {
+		limit := limits[u.FileType]
+		fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%s\n",
+			typeName(u.FileType),
+			u.Bytes,
+			limitString(limit.MaxBytes),
+			u.Count,
+			limitString(limit.MaxCount),
+		)
+	}
+	return w.Flush()
+}
+
+func set(ctx context.Context, accountant *quota.Accountant, args []string) error {
+	fs := flag.NewFlagSet("set", flag.ContinueOnError)
+	userID := fs.String("user", "", "user ID")
+	name := fs.String("type", "", "file type")
+	maxBytes := fs.Int64("max-bytes", 0, "maximum total bytes, 0 for unlimited")
+	maxCount := fs.Int64("max-count", 0, "maximum number of files, 0 for unlimited")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *userID == "" || *name == "" {
+		return errors.New("-user and -type are required")
+	}
+	fileType, err := media.FileTypeFromConfigKey(*name)
+	if err != nil {
+		return err
+	}
+
+	return accountant.SetUserQuota(ctx, *userID, fileType, quota.Limit{MaxBytes: *maxBytes, MaxCount: *maxCount})
+}
+
+func unset(ctx context.Context, accountant *quota.Accountant, args []string) error {
+	fs := flag.NewFlagSet("unset", flag.ContinueOnError)
+	userID := fs.String("user", "", "user ID")
+	name := fs.String("type", "", "file type")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *userID == "" || *name == "" {
+		return errors.New("-user and -type are required")
+	}
+	fileType, err := media.FileTypeFromConfigKey(*name)
+	if err != nil {
+		return err
+	}
+
+	return accountant.RemoveUserQuota(ctx, *userID, fileType)
+}
+
+func typeName(fileType media.FileType) string {
+	if fileType == "" {
+		return "file"
+	}
+	return string(fileType)
+}
+
+func limitString(limit int64) string {
+	if limit == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprint(limit)
+}
@@ -0,0 +1,366 @@
+package media
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+// EncryptionMode selects how MinIOMedia encrypts stored objects
+type EncryptionMode string
+
+const (
+	EncryptNone     EncryptionMode = "none"
+	EncryptSSES3    EncryptionMode = "sse-s3"   // Keys managed by the object store
+	EncryptSSEC     EncryptionMode = "sse-c"    // Per-object keys derived from the master key, sent with every request
+	EncryptEnvelope EncryptionMode = "envelope" // Encrypted before upload with per-object data keys wrapped by the master key
+)
+
+// Metadata keys describing envelope encrypted objects
+const (
+	MetadataEncryption      = "encryption"        // "envelope" for envelope encrypted objects
+	MetadataEncryptionKeyID = "encryption-key-id" // ID of the master key wrapping the data key
+	MetadataEncryptionKey   = "encryption-key"    // Wrapped data key
+)
+
+// envelopeChunkSize is the plaintext size of each independently sealed chunk, so ranges can be
+// decrypted without reading the whole object
+const envelopeChunkSize = 64 * 1024
+
+var (
+	// ErrEncryptionUnsupported is returned for operations that cannot work with the configured encryption,
+	// such as presigned URLs for objects only the service can decrypt
+	ErrEncryptionUnsupported = errors.New("media: operation not supported with encryption")
+	// ErrDecryption is returned when an encrypted object cannot be decrypted or fails authentication
+	ErrDecryption = errors.New("media: failed to decrypt object")
+)
+
+// MasterKey is a 32-byte key protecting object keys
+type MasterKey struct {
+	ID  string
+	Key []byte
+}
+
+// EncryptionOptions configures object encryption
+type EncryptionOptions struct {
+	Mode      EncryptionMode
+	MasterKey MasterKey   // Required for sse-c and envelope
+	OldKeys   []MasterKey // Keys still accepted for decryption during rotation
+}
+
+// ParseMasterKey decodes a base64 master key
+func ParseMasterKey(id string, encoded string) (MasterKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return MasterKey{}, fmt.Errorf("master key %q must be base64 encoded: %w", id, err)
+	}
+	if len(key) != 32 {
+		return MasterKey{}, fmt.Errorf("master key %q must be 32 bytes, got %d", id, len(key))
+	}
+	return MasterKey{ID: id, Key: key}, nil
+}
+
+// objectEncryption applies EncryptionOptions to individual objects
+type objectEncryption struct {
+	mode    EncryptionMode
+	current MasterKey
+	old     []MasterKey       // Keys tried in order when an SSE-C object does not match the current key
+	keys    map[string][]byte // Envelope master keys by ID, including the current one
+}
+
+func newObjectEncryption(opts EncryptionOptions) (*objectEncryption, error) {
+	e := &objectEncryption{mode: opts.Mode, current: opts.MasterKey, old: opts.OldKeys}
+	switch opts.Mode {
+	case "", EncryptNone:
+		e.mode = EncryptNone
+		return e, nil
+	case EncryptSSES3:
+		return e, nil
+	case EncryptSSEC, EncryptEnvelope:
+	default:
+		return nil, fmt.Errorf("unsupported encryption mode %q", opts.Mode)
+	}
+
+	e.keys = make(map[string][]byte, len(opts.OldKeys)+1)
+	for _, key := range append([]MasterKey{opts.MasterKey}, opts.OldKeys...) {
+		if len(key.Key) != 32 {
+			return nil, fmt.Errorf("master key %q must be 32 bytes, got %d", key.ID, len(key.Key))
+		}
+		if _, ok := e.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate master key ID %q", key.ID)
+		}
+		e.keys[key.ID] = key.Key
+	}
+	return e, nil
+}
+
+// serverSide returns the server-side encryption of an object, nil when the store does not encrypt it.
+// SSE-C keys are derived per object with HKDF so a leaked object key exposes only that object.
+func (e *objectEncryption) serverSide(bucketName string, objectName string) encrypt.ServerSide {
+	switch e.mode {
+	case EncryptSSES3:
+		return encrypt.NewSSE()
+	case EncryptSSEC:
+		return deriveSSEC(e.current, bucketName, objectName)
+	default:
+		return nil
+	}
+}
+
+// oldServerSide returns the SSE-C keys of an object derived from OldKeys, which objects written before
+// the master key was rotated are encrypted with. Other modes have none: SSE-S3 keys are managed by the
+// store and envelope objects record the ID of their master key.
+func (e *objectEncryption) oldServerSide(bucketName string, objectName string) []encrypt.ServerSide {
+	if e.mode != EncryptSSEC {
+		return nil
+	}
+	sses := make([]encrypt.ServerSide, 0, len(e.old))
+	for _, key := range e.old {
+		sses = append(sses, deriveSSEC(key, bucketName, objectName))
+	}
+	return sses
+}
+
+// deriveSSEC returns the SSE-C key of an object derived from a master key
+func deriveSSEC(master MasterKey, bucketName string, objectName string) encrypt.ServerSide {
+	// Neither call can fail for the 32-byte keys checked by newObjectEncryption
+	key, _ := hkdf.Key(sha256.New, master.Key, nil, bucketName+"/"+objectName, 32)
+	sse, _ := encrypt.NewSSEC(key)
+	return sse
+}
+
+// clientSide reports whether objects are encrypted before upload
+func (e *objectEncryption) clientSide() bool {
+	return e.mode == EncryptEnvelope
+}
+
+// presignable reports whether objects can be read or written through presigned URLs
+func (e *objectEncryption) presignable() bool {
+	return e.mode == EncryptNone || e.mode == EncryptSSES3
+}
+
+// seal encrypts size bytes of plaintext with a new data key, returning the ciphertext, its size and
+// the metadata needed to decrypt it
+func (e *objectEncryption) seal(plaintext io.Reader, size int64) (io.Reader, int64, map[string]string, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	wrapped, err := wrapKey(e.current.Key, dataKey)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	metadata := map[string]string{
+		MetadataEncryption:      string(EncryptEnvelope),
+		MetadataEncryptionKeyID: e.current.ID,
+		MetadataEncryptionKey:   base64.StdEncoding.EncodeToString(wrapped),
+	}
+	return &sealReader{aead: aead, r: plaintext, chunks: envelopeChunks(size)}, envelopeCiphertextSize(size), metadata, nil
+}
+
+// isEnveloped reports whether an object's metadata marks it as envelope encrypted
+func isEnveloped(metadata map[string]string) bool {
+	return metadata[MetadataEncryption] == string(EncryptEnvelope)
+}
+
+// open returns a reader decrypting ciphertext that starts at the beginning of chunk firstChunk of an
+// object holding size plaintext bytes
+func (e *objectEncryption) open(metadata map[string]string, ciphertext io.Reader, firstChunk int64, size int64) (io.Reader, error) {
+	key, ok := e.keys[metadata[MetadataEncryptionKeyID]]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown master key %q", ErrDecryption, metadata[MetadataEncryptionKeyID])
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(metadata[MetadataEncryptionKey])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed data key", ErrDecryption)
+	}
+	dataKey, err := unwrapKey(key, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &openReader{aead: aead, r: ciphertext, index: firstChunk, chunks: envelopeChunks(size)}, nil
+}
+
+// plaintextSize returns the plaintext size recorded for an envelope encrypted object
+func plaintextSize(metadata map[string]string) (int64, error) {
+	size, err := strconv.ParseInt(metadata[MetadataSize], 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("%w: missing plaintext size", ErrDecryption)
+	}
+	return size, nil
+}
+
+// envelopeChunks returns the number of chunks sealing size bytes. Empty objects hold one empty
+// chunk, so truncating an object to nothing is detected.
+func envelopeChunks(size int64) int64 {
+	return max(1, (size+envelopeChunkSize-1)/envelopeChunkSize)
+}
+
+func envelopeCiphertextSize(size int64) int64 {
+	return size + envelopeChunks(size)*int64(aesGCMOverhead)
+}
+
+// envelopeRange locates a plaintext range of an envelope encrypted object in its ciphertext
+type envelopeRange struct {
+	start, end int64 // Inclusive ciphertext byte range of the chunks holding the plaintext range
+	firstChunk int64 // Index of the chunk at start
+	skip       int64 // Plaintext bytes of the first chunk before the range
+	length     int64 // Plaintext bytes in the range
+}
+
+// newEnvelopeRange locates length bytes (-1 or 0 for the rest) from offset of an object holding size
+// plaintext bytes. offset must be before the end of a non-empty object.
+func newEnvelopeRange(offset int64, length int64, size int64) envelopeRange {
+	end := size
+	if length > 0 {
+		end = min(size, offset+length)
+	}
+	firstChunk := offset / envelopeChunkSize
+	lastChunk := max(firstChunk, (end-1)/envelopeChunkSize)
+	sealedChunkSize := int64(envelopeChunkSize + aesGCMOverhead)
+
+	return envelopeRange{
+		start:      firstChunk * sealedChunkSize,
+		end:        min((lastChunk+1)*sealedChunkSize, envelopeCiphertextSize(size)) - 1,
+		firstChunk: firstChunk,
+		skip:       offset - firstChunk*envelopeChunkSize,
+		length:     end - offset,
+	}
+}
+
+// aesGCMOverhead is the tag appended to every sealed chunk
+const aesGCMOverhead = 16
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// wrapKey seals a data key under a master key, prefixed with its random nonce
+func wrapKey(masterKey []byte, dataKey []byte) ([]byte, error) {
+	aead, err := newGCM(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, dataKey, []byte(MetadataEncryptionKey)), nil
+}
+
+func unwrapKey(masterKey []byte, wrapped []byte) ([]byte, error) {
+	aead, err := newGCM(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: malformed data key", ErrDecryption)
+	}
+	dataKey, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(MetadataEncryptionKey))
+	if err != nil {
+		return nil, fmt.Errorf("%w: data key does not match the master key", ErrDecryption)
+	}
+	return dataKey, nil
+}
+
+// chunkNonce returns the nonce of a chunk. Data keys are never reused, so counting is safe; the
+// final chunk is flagged so dropping trailing chunks fails authentication.
+func chunkNonce(index int64, final bool) []byte {
+	nonce := make([]byte, 12)
+	if final {
+		nonce[0] = 1
+	}
+	binary.BigEndian.PutUint64(nonce[4:], uint64(index))
+	return nonce
+}
+
+// sealReader encrypts a plaintext stream chunk by chunk
+type sealReader struct {
+	aead   cipher.AEAD
+	r      io.Reader
+	chunks int64
+	index  int64
+	buf    []byte // Sealed bytes not yet returned
+}
+
+func (s *sealReader) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		if s.index == s.chunks {
+			return 0, io.EOF
+		}
+		chunk := make([]byte, envelopeChunkSize, envelopeChunkSize+aesGCMOverhead)
+		n, err := io.ReadFull(s.r, chunk)
+		final := s.index == s.chunks-1
+		switch {
+		case err == io.ErrUnexpectedEOF || err == io.EOF:
+			if !final {
+				return 0, fmt.Errorf("plaintext shorter than declared: %w", io.ErrUnexpectedEOF)
+			}
+		case err != nil:
+			return 0, err
+		}
+		s.buf = s.aead.Seal(chunk[:0], chunkNonce(s.index, final), chunk[:n], nil)
+		s.index++
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+// openReader decrypts a ciphertext stream chunk by chunk
+type openReader struct {
+	aead   cipher.AEAD
+	r      io.Reader
+	chunks int64
+	index  int64
+	buf    []byte // Decrypted bytes not yet returned
+}
+
+func (o *openReader) Read(p []byte) (int, error) {
+	for len(o.buf) == 0 {
+		if o.index >= o.chunks {
+			return 0, io.EOF
+		}
+		chunk := make([]byte, envelopeChunkSize+aesGCMOverhead)
+		n, err := io.ReadFull(o.r, chunk)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			if err == io.EOF {
+				return 0, fmt.Errorf("%w: truncated object", ErrDecryption)
+			}
+			return 0, err
+		}
+		final := o.index == o.chunks-1
+		plain, err := o.aead.Open(chunk[:0], chunkNonce(o.index, final), chunk[:n], nil)
+		if err != nil {
+			return 0, fmt.Errorf("%w: chunk %d failed authentication", ErrDecryption, o.index)
+		}
+		o.buf = plain
+		o.index++
+	}
+	n := copy(p, o.buf)
+	o.buf = o.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,248 @@
+package media
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/weiawesome/wesio-live/libs/config"
+)
+
+// defaultS3Endpoint is used when StorageType is s3 and no endpoint is configured
+const defaultS3Endpoint = "s3.amazonaws.com"
+
+// pinger is implemented by backends that can verify their connectivity
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// New builds the media backend selected by cfg.StorageType and verifies it can reach its storage
+func New(ctx context.Context, cfg config.MediaConfig) (Media, error) {
+	var (
+		m   Media
+		err error
+	)
+
+	cdnSigner, err := cdnSignerFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.StorageType {
+	case "minio", "s3":
+		m, err = newMinIOFromConfig(ctx, cfg, cdnSigner)
+	case "local":
+		m, err = CreateLocalMedia(LocalMediaOptions{
+			RootDir:       cfg.LocalRoot,
+			BaseURL:       cfg.LocalBaseURL,
+			SignKey:       cfg.URLSigningKey,
+			CDNDomain:     cfg.CDNDomain,
+			CDNSigner:     cdnSigner,
+			MaxUploadSize: cfg.MaxUploadSize,
+		})
+	default:
+		return nil, fmt.Errorf("unsupported media storage type: %q", cfg.StorageType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p, ok := m.(pinger); ok {
+		timeout := 10 * time.Second
+		if cfg.ConnectTimeout != "" {
+			if d, err := time.ParseDuration(cfg.ConnectTimeout); err == nil && d > 0 {
+				timeout = d
+			}
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		if err := p.Ping(pingCtx); err != nil {
+			return nil, fmt.Errorf("%s media storage connectivity check failed: %w", cfg.StorageType, err)
+		}
+	}
+
+	// Local storage fails fast on its own; object stores are wrapped against slow or failing endpoints
+	if cfg.Resilience.Enabled && cfg.StorageType != "local" {
+		opts, err := resilienceFromConfig(cfg.Resilience)
+		if err != nil {
+			return nil, err
+		}
+		m = CreateResilientMedia(m, opts)
+	}
+
+	return m, nil
+}
+
+// resilienceFromConfig converts the resilience configuration; unset values use the defaults
+func resilienceFromConfig(cfg config.MediaResilienceConfig) (ResilientOptions, error) {
+	opts := ResilientOptions{
+		MaxAttempts:      cfg.MaxAttempts,
+		FailureThreshold: cfg.FailureThreshold,
+	}
+	for _, d := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"timeout", cfg.Timeout, &opts.Timeout},
+		{"transfer_timeout", cfg.TransferTimeout, &opts.TransferTimeout},
+		{"open_timeout", cfg.OpenTimeout, &opts.OpenTimeout},
+	} {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil {
+			return ResilientOptions{}, fmt.Errorf("invalid media resilience %s: %w", d.name, err)
+		}
+		*d.dst = parsed
+	}
+	return opts, nil
+}
+
+// cdnSignerFromConfig builds the CDN signer selected by cfg.CDNSigner, or nil when no signing key is configured
+func cdnSignerFromConfig(cfg config.MediaConfig) (CDNSigner, error) {
+	if cfg.CDNSigningKey == "" {
+		return nil, nil
+	}
+
+	switch cfg.CDNSigner {
+	case "", "hmac":
+		return HMACSigner{Key: cfg.CDNSigningKey, KeyID: cfg.CDNSigningKeyID}, nil
+	case "cloudfront":
+		privateKey, err := ParseCloudFrontPrivateKey([]byte(cfg.CDNSigningKey))
+		if err != nil {
+			return nil, err
+		}
+		return CloudFrontSigner{KeyPairID: cfg.CDNKeyPairID, PrivateKey: privateKey}, nil
+	case "cloudflare":
+		var lifetime time.Duration
+		if cfg.CDNTokenLifetime != "" {
+			d, err := time.ParseDuration(cfg.CDNTokenLifetime)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CDN token lifetime: %w", err)
+			}
+			lifetime = d
+		}
+		return CloudflareSigner{Key: cfg.CDNSigningKey, Param: cfg.CDNTokenParam, Lifetime: lifetime}, nil
+	case "akamai":
+		if _, err := hex.DecodeString(cfg.CDNSigningKey); err != nil {
+			return nil, fmt.Errorf("Akamai CDN signing key must be hex encoded: %w", err)
+		}
+		return AkamaiSigner{Key: cfg.CDNSigningKey, Param: cfg.CDNTokenParam}, nil
+	case "nginx":
+		return NginxSecureLinkSigner{Secret: cfg.CDNSigningKey}, nil
+	default:
+		return nil, fmt.Errorf("unsupported CDN signer: %q", cfg.CDNSigner)
+	}
+}
+
+// CDNVerifyKeysFromConfig returns the hmac keys a URLVerifier accepts: the current signing key
+// followed by the keys still accepted during rotation, ordered by ID
+func CDNVerifyKeysFromConfig(cfg config.MediaConfig) []SigningKey {
+	var keys []SigningKey
+	if cfg.CDNSigningKey != "" {
+		keys = append(keys, SigningKey{ID: cfg.CDNSigningKeyID, Secret: cfg.CDNSigningKey})
+	}
+
+	ids := make([]string, 0, len(cfg.CDNVerifyKeys))
+	for id := range cfg.CDNVerifyKeys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		keys = append(keys, SigningKey{ID: id, Secret: cfg.CDNVerifyKeys[id]})
+	}
+	return keys
+}
+
+func newMinIOFromConfig(ctx context.Context, cfg config.MediaConfig, cdnSigner CDNSigner) (*MinIOMedia, error) {
+	endpoint := cfg.Endpoint
+	secure := cfg.UseSSL
+	if endpoint == "" {
+		if cfg.StorageType != "s3" {
+			return nil, fmt.Errorf("media endpoint not configured")
+		}
+		endpoint = defaultS3Endpoint
+		secure = true
+	}
+
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("media access key and secret key must be configured")
+	}
+
+	layout, err := BucketLayoutFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	expireDays := make(map[FileType]int, len(cfg.Layout.ExpireDays))
+	for name, days := range cfg.Layout.ExpireDays {
+		fileType, err := FileTypeFromConfigKey(name)
+		if err != nil {
+			return nil, err
+		}
+		expireDays[fileType] = days
+	}
+
+	encryption, err := encryptionFromConfig(cfg.Encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	// The development key is public, so session IDs are then signed with the secret key instead
+	signKey := cfg.URLSigningKey
+	if signKey == config.DevURLSigningKey {
+		signKey = ""
+	}
+
+	return CreateMinIOMediaWithOptions(ctx, MinIOMediaOptions{
+		Endpoint:      endpoint,
+		AccessKey:     cfg.AccessKey,
+		SecretKey:     cfg.SecretKey,
+		Secure:        secure,
+		CDNDomain:     cfg.CDNDomain,
+		CDNSigner:     cdnSigner,
+		Layout:        layout,
+		MaxUploadSize: cfg.MaxUploadSize,
+		Encryption:    encryption,
+		SignKey:       signKey,
+		Provisioning: BucketProvisioning{
+			AutoCreate: cfg.Layout.AutoCreate,
+			Region:     cfg.Layout.Region,
+			Policy:     cfg.Layout.Policy,
+			ExpireDays: expireDays,
+		},
+	})
+}
+
+// encryptionFromConfig decodes the master keys of the configured encryption mode, ordering old keys by ID
+func encryptionFromConfig(cfg config.MediaEncryptionConfig) (EncryptionOptions, error) {
+	opts := EncryptionOptions{Mode: EncryptionMode(cfg.Mode)}
+	if cfg.Key == "" {
+		return opts, nil
+	}
+
+	masterKey, err := ParseMasterKey(cfg.KeyID, cfg.Key)
+	if err != nil {
+		return EncryptionOptions{}, err
+	}
+	opts.MasterKey = masterKey
+
+	ids := make([]string, 0, len(cfg.OldKeys))
+	for id := range cfg.OldKeys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		oldKey, err := ParseMasterKey(id, cfg.OldKeys[id])
+		if err != nil {
+			return EncryptionOptions{}, err
+		}
+		opts.OldKeys = append(opts.OldKeys, oldKey)
+	}
+	return opts, nil
+}
@@ -0,0 +1,217 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/weiawesome/wesio-live/libs/logger"
+)
+
+// ReferenceSource reports every stored media reference, such as an avatar key or URL, by calling yield.
+// References may be keys returned by Upload or URLs whose path ends with such a key.
+// user.AvatarReferences, room.RecordingReferences and uploads.BlobReferences report the media their records hold,
+// video.PosterReferences and hls.StreamReferences report the posters of stored videos and the files of HLS streams.
+type ReferenceSource func(ctx context.Context, yield func(ref string) error) error
+
+// GCOptions configures the media garbage collector
+type GCOptions struct {
+	FileTypes []FileType    // File types to scan
+	Prefix    string        // Only files whose filename starts with Prefix are considered
+	MinAge    time.Duration // Files modified more recently are kept, so in-flight uploads are never collected
+	PageSize  int           // Files listed per page
+	Interval  time.Duration // Delay between collections in Run
+	DryRun    bool          // Report orphans without deleting them
+
+	// Group optionally maps a key to the group of files stored together with it, such as an image and its
+	// resized variants. A file is kept when any file of its group is referenced.
+	Group func(key string) string
+}
+
+// DefaultGCOptions returns default garbage collector options
+func DefaultGCOptions() GCOptions {
+	return GCOptions{
+		FileTypes: []FileType{Image, Video, ""},
+		MinAge:    24 * time.Hour,
+		PageSize:  1000,
+		Interval:  24 * time.Hour,
+	}
+}
+
+// GCResult summarises one collection
+type GCResult struct {
+	Scanned    int
+	Referenced int
+	Orphans    []string // Keys of unreferenced files old enough to collect
+	Deleted    int
+	Errors     DeleteErrors
+}
+
+// GarbageCollector deletes stored media that no ReferenceSource refers to
+type GarbageCollector struct {
+	media   Media
+	sources []ReferenceSource
+	opts    GCOptions
+}
+
+func CreateGarbageCollector(m Media, sources []ReferenceSource, opts GCOptions) *GarbageCollector {
+	defaults := DefaultGCOptions()
+	if len(opts.FileTypes) == 0 {
+		opts.FileTypes = defaults.FileTypes
+	}
+	if opts.MinAge <= 0 {
+		opts.MinAge = defaults.MinAge
+	}
+	if opts.PageSize <= 0 {
+		opts.PageSize = defaults.PageSize
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaults.Interval
+	}
+
+	return &GarbageCollector{
+		media:   m,
+		sources: sources,
+		opts:    opts,
+	}
+}
+
+// Run collects garbage every Interval until ctx is cancelled
+func (g *GarbageCollector) Run(ctx context.Context) error {
+	ticker := time.NewTicker(g.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		result, err := g.Collect(ctx)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			logger.Error("media", "gc", "failed to collect unreferenced media", err, nil)
+		case err == nil:
+			logger.Info("media", "gc", "collected unreferenced media", map[string]interface{}{
+				"scanned":    result.Scanned,
+				"referenced": result.Referenced,
+				"orphans":    len(result.Orphans),
+				"deleted":    result.Deleted,
+				"failed":     len(result.Errors),
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Collect loads every reference, then lists stored files and deletes those not referenced.
+// References are loaded before listing, so a file referenced after the listing starts is protected by MinAge.
+func (g *GarbageCollector) Collect(ctx context.Context) (*GCResult, error) {
+	referenced, err := g.loadReferences(ctx)
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string]bool)
+	if g.opts.Group != nil {
+		for key := range referenced {
+			groups[g.opts.Group(key)] = true
+		}
+	}
+
+	result := &GCResult{Errors: DeleteErrors{}}
+	cutoff := time.Now().Add(-g.opts.MinAge)
+
+	for _, fileType := range g.opts.FileTypes {
+		var orphans []string
+		cursor := ""
+		for {
+			page, err := g.media.List(ctx, fileType, g.opts.Prefix, cursor, g.opts.PageSize)
+			if err != nil {
+				return result, err
+			}
+
+			for _, file := range page.Files {
+				result.Scanned++
+				if referenced[file.Key] || (g.opts.Group != nil && groups[g.opts.Group(file.Key)]) {
+					result.Referenced++
+					continue
+				}
+				if file.LastModified.After(cutoff) {
+					continue
+				}
+				orphans = append(orphans, file.Filename)
+				result.Orphans = append(result.Orphans, file.Key)
+			}
+
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+
+		if g.opts.DryRun || len(orphans) == 0 {
+			continue
+		}
+
+		// Delete after listing so deletions do not shift the pages being read
+		for start := 0; start < len(orphans); start += g.opts.PageSize {
+			batch := orphans[start:min(start+g.opts.PageSize, len(orphans))]
+			err := g.media.DeleteMany(ctx, fileType, batch)
+
+			var failed DeleteErrors
+			switch {
+			case err == nil:
+			case errors.As(err, &failed):
+				for filename, deleteErr := range failed {
+					result.Errors[filename] = deleteErr
+				}
+			default:
+				return result, err
+			}
+			result.Deleted += len(batch) - len(failed)
+		}
+	}
+
+	return result, nil
+}
+
+// loadReferences returns the set of keys referenced by any source. Every path suffix of a
+// reference is included, so "https://cdn/images/a.png" and "bucket/images/a.png" both match "images/a.png".
+func (g *GarbageCollector) loadReferences(ctx context.Context) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	for _, source := range g.sources {
+		err := source(ctx, func(ref string) error {
+			for _, key := range referenceKeys(ref) {
+				referenced[key] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load media references: %w", err)
+		}
+	}
+	return referenced, nil
+}
+
+// referenceKeys returns the path of ref and every suffix of it starting after a "/"
+func referenceKeys(ref string) []string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return nil
+	}
+	if u, err := url.Parse(ref); err == nil && u.Scheme != "" {
+		ref = u.Path
+	}
+	ref = strings.TrimPrefix(ref, "/")
+
+	keys := []string{ref}
+	for i := 0; i < len(ref); i++ {
+		if ref[i] == '/' && i+1 < len(ref) {
+			keys = append(keys, ref[i+1:])
+		}
+	}
+	return keys
+}
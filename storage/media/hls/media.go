@@ -0,0 +1,75 @@
+package hls
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/weiawesome/wesio-live/storage/media"
+)
+
+// streamListSize is the number of files listed per page by StreamReferences
+const streamListSize = 1000
+
+// StreamReferences returns a media.ReferenceSource reporting the key of every file of every stream
+// stored under prefix, the Options.Prefix of the packager, whose master playlist still exists.
+// Playlists, init segments and segments are kept while their stream exists, including segments not yet
+// listed by a VOD playlist; files of streams whose master playlist was deleted are left to the collector.
+func StreamReferences(m media.Media, prefix string) func(ctx context.Context, yield func(ref string) error) error {
+	if prefix == "" {
+		prefix = DefaultOptions().Prefix
+	}
+	prefix = strings.TrimSuffix(prefix, "/") + "/"
+
+	return func(ctx context.Context, yield func(ref string) error) error {
+		// Files are listed by filename, so the files of a stream directory are contiguous
+		var (
+			dir       string
+			keys      []string
+			hasMaster bool
+		)
+		flush := func() error {
+			if hasMaster {
+				for _, key := range keys {
+					if err := yield(key); err != nil {
+						return err
+					}
+				}
+			}
+			keys, hasMaster = keys[:0], false
+			return nil
+		}
+
+		cursor := ""
+		for {
+			page, err := m.List(ctx, media.Video, prefix, cursor, streamListSize)
+			if err != nil {
+				return fmt.Errorf("failed to list HLS streams: %w", err)
+			}
+
+			for _, file := range page.Files {
+				// Streams are stored under <prefix>/<roomID>/<stream ID>
+				parts := strings.SplitN(strings.TrimPrefix(file.Filename, prefix), "/", 3)
+				if len(parts) < 3 {
+					continue
+				}
+				if streamDir := path.Join(prefix, parts[0], parts[1]); streamDir != dir {
+					if err := flush(); err != nil {
+						return err
+					}
+					dir = streamDir
+				}
+				keys = append(keys, file.Key)
+				if parts[2] == "master.m3u8" {
+					hasMaster = true
+				}
+			}
+
+			if page.NextCursor == "" {
+				return flush()
+			}
+			cursor = page.NextCursor
+		}
+	}
+}
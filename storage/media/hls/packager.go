@@ -0,0 +1,282 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/weiawesome/wesio-live/libs/logger"
+	"github.com/weiawesome/wesio-live/storage/media"
+)
+
+var (
+	// ErrUnknownRendition is returned when writing to a rendition the stream was not opened with
+	ErrUnknownRendition = errors.New("hls: unknown rendition")
+	// ErrStreamEnded is returned when writing to a stream after End
+	ErrStreamEnded = errors.New("hls: stream has ended")
+)
+
+// Options configures a Packager
+type Options struct {
+	Prefix         string        // Filename prefix of all streams; each room gets its own directory below it
+	Format         SegmentFormat // Container of the segments
+	Type           PlaylistType  // Live keeps a sliding window; Event and VOD keep every segment
+	WindowSize     int           // Segments listed by live playlists
+	DeleteExpired  bool          // Delete segments once they are a further WindowSize segments behind a live window
+	TargetDuration time.Duration // Expected segment duration; longer segments raise it
+}
+
+// DefaultOptions returns default packager options for live MPEG-TS streams
+func DefaultOptions() Options {
+	return Options{
+		Prefix:     "hls",
+		Format:     TS,
+		Type:       Live,
+		WindowSize: 6,
+	}
+}
+
+// Rendition is one encoding of a stream, stored in its own directory
+type Rendition struct {
+	Name string // Directory name, e.g. "720p"
+	StreamInfo
+}
+
+// Packager stores HLS streams through media.Media
+type Packager struct {
+	media media.Media
+	opts  Options
+}
+
+func CreatePackager(m media.Media, opts Options) (*Packager, error) {
+	defaults := DefaultOptions()
+	if opts.Prefix == "" {
+		opts.Prefix = defaults.Prefix
+	}
+	if opts.Format == "" {
+		opts.Format = defaults.Format
+	}
+	if opts.Type == "" {
+		opts.Type = defaults.Type
+	}
+	if opts.WindowSize <= 0 {
+		opts.WindowSize = defaults.WindowSize
+	}
+
+	if opts.Format != TS && opts.Format != FMP4 {
+		return nil, fmt.Errorf("unsupported HLS segment format %q", opts.Format)
+	}
+	if opts.Type != Live && opts.Type != Event && opts.Type != VOD {
+		return nil, fmt.Errorf("unsupported HLS playlist type %q", opts.Type)
+	}
+
+	return &Packager{media: m, opts: opts}, nil
+}
+
+// Stream is a session of a room being packaged. It is safe for concurrent use.
+type Stream struct {
+	packager   *Packager
+	roomID     string
+	dir        string
+	renditions map[string]*rendition
+
+	mu    sync.Mutex
+	ended bool
+}
+
+type rendition struct {
+	mu       sync.Mutex
+	dir      string
+	playlist MediaPlaylist
+	next     int      // Sequence number of the next segment
+	expired  []string // Filenames of segments that left the live window, oldest first
+}
+
+// Open starts a new stream of the room under <Prefix>/<roomID>/<stream ID> and stores its master playlist
+func (p *Packager) Open(ctx context.Context, roomID string, renditions []Rendition) (*Stream, error) {
+	if len(renditions) == 0 {
+		return nil, errors.New("an HLS stream needs at least one rendition")
+	}
+
+	s := &Stream{
+		packager:   p,
+		roomID:     roomID,
+		dir:        path.Join(p.opts.Prefix, roomID, uuid.NewString()),
+		renditions: make(map[string]*rendition, len(renditions)),
+	}
+
+	master := MasterPlaylist{}
+	for _, r := range renditions {
+		if r.Name == "" || strings.ContainsAny(r.Name, "/.") || s.renditions[r.Name] != nil {
+			return nil, fmt.Errorf("invalid or duplicate rendition name %q", r.Name)
+		}
+		if r.Bandwidth <= 0 {
+			return nil, fmt.Errorf("rendition %q has no bandwidth", r.Name)
+		}
+		s.renditions[r.Name] = &rendition{
+			dir: path.Join(s.dir, r.Name),
+			playlist: MediaPlaylist{
+				Type:           p.opts.Type,
+				TargetDuration: p.opts.TargetDuration,
+			},
+		}
+		master.Variants = append(master.Variants, Variant{URI: r.Name + "/index.m3u8", StreamInfo: r.StreamInfo})
+	}
+
+	if err := s.upload(ctx, s.Master(), master.Encode()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Master returns the filename of the master playlist
+func (s *Stream) Master() string {
+	return path.Join(s.dir, "master.m3u8")
+}
+
+// Playlist returns the filename of the media playlist of a rendition
+func (s *Stream) Playlist(name string) string {
+	return path.Join(s.dir, name, "index.m3u8")
+}
+
+// WriteInit stores the fMP4 init segment of a rendition
+func (s *Stream) WriteInit(ctx context.Context, name string, data io.Reader) error {
+	if s.packager.opts.Format != FMP4 {
+		return fmt.Errorf("%s streams have no init segment", s.packager.opts.Format)
+	}
+	r, err := s.rendition(name)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := s.packager.media.Upload(ctx, media.Video, path.Join(r.dir, "init.mp4"), data, &media.UploadOptions{
+		ContentType: "video/mp4",
+		Metadata:    s.metadata(),
+	}); err != nil {
+		return fmt.Errorf("failed to store init segment of %s: %w", name, err)
+	}
+	r.playlist.Map = "init.mp4"
+	return nil
+}
+
+// WriteSegment stores the next segment of a rendition and republishes its media playlist.
+// Live playlists only list the last WindowSize segments.
+func (s *Stream) WriteSegment(ctx context.Context, name string, data io.Reader, duration time.Duration) error {
+	if duration <= 0 {
+		return fmt.Errorf("invalid segment duration %s", duration)
+	}
+	r, err := s.rendition(name)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	filename := fmt.Sprintf("segment-%06d%s", r.next, s.packager.opts.Format.Extension())
+	if _, err := s.packager.media.Upload(ctx, media.Video, path.Join(r.dir, filename), data, &media.UploadOptions{
+		ContentType: s.packager.opts.Format.ContentType(),
+		Metadata:    s.metadata(),
+	}); err != nil {
+		return fmt.Errorf("failed to store segment %d of %s: %w", r.next, name, err)
+	}
+	r.next++
+
+	opts := s.packager.opts
+	r.playlist.Segments = append(r.playlist.Segments, Segment{URI: filename, Duration: duration})
+	// A target duration must not change during a live stream, so it only ever grows
+	r.playlist.TargetDuration = max(r.playlist.TargetDuration, duration)
+	if opts.Type == Live && len(r.playlist.Segments) > opts.WindowSize {
+		drop := len(r.playlist.Segments) - opts.WindowSize
+		for _, segment := range r.playlist.Segments[:drop] {
+			r.expired = append(r.expired, path.Join(r.dir, segment.URI))
+		}
+		r.playlist.Segments = append([]Segment(nil), r.playlist.Segments[drop:]...)
+		r.playlist.MediaSequence += drop
+	}
+
+	if opts.Type == VOD {
+		return nil
+	}
+	if err := s.upload(ctx, s.Playlist(name), r.playlist.Encode()); err != nil {
+		return err
+	}
+	s.deleteExpired(ctx, r)
+	return nil
+}
+
+// End marks every media playlist complete and republishes it. Writes after End fail.
+func (s *Stream) End(ctx context.Context) error {
+	s.mu.Lock()
+	s.ended = true
+	s.mu.Unlock()
+
+	for name, r := range s.renditions {
+		r.mu.Lock()
+		r.playlist.Ended = true
+		err := s.upload(ctx, s.Playlist(name), r.playlist.Encode())
+		r.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Stream) rendition(name string) (*rendition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ended {
+		return nil, ErrStreamEnded
+	}
+	r := s.renditions[name]
+	if r == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRendition, name)
+	}
+	return r, nil
+}
+
+// deleteExpired deletes segments that are more than WindowSize segments behind the live window,
+// so viewers that loaded an older playlist can still fetch them
+func (s *Stream) deleteExpired(ctx context.Context, r *rendition) {
+	opts := s.packager.opts
+	if !opts.DeleteExpired || len(r.expired) <= opts.WindowSize {
+		return
+	}
+
+	drop := r.expired[:len(r.expired)-opts.WindowSize]
+	if err := s.packager.media.DeleteMany(ctx, media.Video, drop); err != nil {
+		logger.Error("hls", "delete_expired", "failed to delete expired segments", err, map[string]interface{}{
+			"room_id":  s.roomID,
+			"segments": len(drop),
+		})
+		return
+	}
+	r.expired = append([]string(nil), r.expired[len(drop):]...)
+}
+
+func (s *Stream) upload(ctx context.Context, filename string, playlist []byte) error {
+	if _, err := s.packager.media.Upload(ctx, media.Video, filename, bytes.NewReader(playlist), &media.UploadOptions{
+		ContentType: ContentType,
+		Metadata:    s.metadata(),
+	}); err != nil {
+		return fmt.Errorf("failed to store playlist %s: %w", filename, err)
+	}
+	return nil
+}
+
+// metadata returns the object metadata stored with every file of the stream
+func (s *Stream) metadata() map[string]string {
+	return map[string]string{"room-id": s.roomID}
+}
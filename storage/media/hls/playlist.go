@@ -0,0 +1,186 @@
+// Package hls packages media segments into HTTP Live Streaming playlists stored through media.Media
+// and signs the playlists for playback through the CDN.
+package hls
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContentType is the MIME type of HLS playlists
+const ContentType = "application/vnd.apple.mpegurl"
+
+// SegmentFormat is the container of media segments
+type SegmentFormat string
+
+const (
+	TS   SegmentFormat = "ts"   // MPEG-TS, self-contained segments
+	FMP4 SegmentFormat = "fmp4" // Fragmented MP4, segments share an init segment
+)
+
+// ContentType returns the MIME type of segments in the format
+func (f SegmentFormat) ContentType() string {
+	if f == FMP4 {
+		return "video/mp4"
+	}
+	return "video/mp2t"
+}
+
+// Extension returns the filename extension of segments in the format, including the dot
+func (f SegmentFormat) Extension() string {
+	if f == FMP4 {
+		return ".m4s"
+	}
+	return ".ts"
+}
+
+// PlaylistType selects how a media playlist grows
+type PlaylistType string
+
+const (
+	Live  PlaylistType = "live"  // Sliding window of the latest segments
+	Event PlaylistType = "EVENT" // Segments are only appended, so viewers can seek back to the start
+	VOD   PlaylistType = "VOD"   // Complete and unchanging
+)
+
+// Segment is a media segment in a playlist
+type Segment struct {
+	URI      string
+	Duration time.Duration
+}
+
+// MediaPlaylist lists the segments of one rendition
+type MediaPlaylist struct {
+	Type           PlaylistType
+	TargetDuration time.Duration // Zero derives it from the longest segment
+	MediaSequence  int           // Sequence number of the first segment
+	Map            string        // URI of the fMP4 init segment, if any
+	Segments       []Segment
+	Ended          bool // No more segments will be added
+}
+
+// Encode returns the playlist in M3U8 format
+func (p *MediaPlaylist) Encode() []byte {
+	target := p.TargetDuration
+	for _, s := range p.Segments {
+		target = max(target, s.Duration)
+	}
+
+	version := 3
+	if p.Map != "" {
+		version = 7
+	}
+
+	var b bytes.Buffer
+	b.WriteString("#EXTM3U\n")
+	fmt.Fprintf(&b, "#EXT-X-VERSION:%d\n", version)
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(target.Seconds())))
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", p.MediaSequence)
+	if p.Type == Event || p.Type == VOD {
+		fmt.Fprintf(&b, "#EXT-X-PLAYLIST-TYPE:%s\n", p.Type)
+	}
+	b.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	if p.Map != "" {
+		fmt.Fprintf(&b, "#EXT-X-MAP:URI=%q\n", p.Map)
+	}
+	for _, s := range p.Segments {
+		fmt.Fprintf(&b, "#EXTINF:%s,\n", strconv.FormatFloat(s.Duration.Seconds(), 'f', 3, 64))
+		b.WriteString(s.URI + "\n")
+	}
+	if p.Ended || p.Type == VOD {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	}
+	return b.Bytes()
+}
+
+// StreamInfo describes the encoding of a variant stream
+type StreamInfo struct {
+	Bandwidth        int64 // Peak bits per second, required
+	AverageBandwidth int64
+	Width            int
+	Height           int
+	Codecs           string // RFC 6381 codecs, e.g. "avc1.64001f,mp4a.40.2"
+	FrameRate        float64
+}
+
+// Variant is a variant stream in a master playlist
+type Variant struct {
+	URI string
+	StreamInfo
+}
+
+// MasterPlaylist lists the variant streams of a presentation
+type MasterPlaylist struct {
+	Variants []Variant
+}
+
+// Encode returns the playlist in M3U8 format
+func (p *MasterPlaylist) Encode() []byte {
+	var b bytes.Buffer
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:3\n")
+	b.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	for _, v := range p.Variants {
+		attrs := []string{"BANDWIDTH=" + strconv.FormatInt(v.Bandwidth, 10)}
+		if v.AverageBandwidth > 0 {
+			attrs = append(attrs, "AVERAGE-BANDWIDTH="+strconv.FormatInt(v.AverageBandwidth, 10))
+		}
+		if v.Width > 0 && v.Height > 0 {
+			attrs = append(attrs, fmt.Sprintf("RESOLUTION=%dx%d", v.Width, v.Height))
+		}
+		if v.Codecs != "" {
+			attrs = append(attrs, fmt.Sprintf("CODECS=%q", v.Codecs))
+		}
+		if v.FrameRate > 0 {
+			attrs = append(attrs, "FRAME-RATE="+strconv.FormatFloat(v.FrameRate, 'f', 3, 64))
+		}
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:%s\n", strings.Join(attrs, ","))
+		b.WriteString(v.URI + "\n")
+	}
+	return b.Bytes()
+}
+
+// RewriteURIs returns playlist with every URI replaced by rewrite: segment and variant lines as well
+// as URI attributes of tags such as EXT-X-MAP, EXT-X-KEY and EXT-X-MEDIA
+func RewriteURIs(playlist []byte, rewrite func(uri string) (string, error)) ([]byte, error) {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(playlist))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#"):
+			start := strings.Index(line, `URI="`)
+			if start < 0 {
+				break
+			}
+			start += len(`URI="`)
+			end := strings.IndexByte(line[start:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated URI attribute: %s", line)
+			}
+			uri, err := rewrite(line[start : start+end])
+			if err != nil {
+				return nil, err
+			}
+			line = line[:start] + uri + line[start+end:]
+		default:
+			uri, err := rewrite(line)
+			if err != nil {
+				return nil, err
+			}
+			line = uri
+		}
+		out.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read playlist: %w", err)
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,79 @@
+package hls
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/weiawesome/wesio-live/storage/media"
+)
+
+// maxPlaylistSize caps the stored playlists read for signing
+const maxPlaylistSize = 4 * 1024 * 1024
+
+// SignPlaylist returns the media playlist stored as filename with its segment, init segment and key
+// URIs replaced by signed CDN URLs valid for expiration. Relative URIs are resolved against the
+// playlist's directory; absolute URLs are kept.
+func SignPlaylist(ctx context.Context, m media.Media, filename string, expiration time.Duration) ([]byte, error) {
+	playlist, err := download(ctx, m, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return RewriteURIs(playlist, func(uri string) (string, error) {
+		target, ok := resolve(filename, uri)
+		if !ok {
+			return uri, nil
+		}
+		return m.GetCDNURL(ctx, media.Video, target, expiration)
+	})
+}
+
+// SignMaster returns the master playlist stored as filename with its variant playlist URIs replaced
+// by playlistURL, called with the resolved filename of each media playlist. Media playlists list
+// relative segment URIs that only work when served through SignPlaylist, so playlistURL usually
+// points at the service endpoint that does so.
+func SignMaster(ctx context.Context, m media.Media, filename string, playlistURL func(filename string) (string, error)) ([]byte, error) {
+	playlist, err := download(ctx, m, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return RewriteURIs(playlist, func(uri string) (string, error) {
+		target, ok := resolve(filename, uri)
+		if !ok {
+			return uri, nil
+		}
+		return playlistURL(target)
+	})
+}
+
+func download(ctx context.Context, m media.Media, filename string) ([]byte, error) {
+	body, err := m.Download(ctx, media.Video, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	playlist, err := io.ReadAll(io.LimitReader(body, maxPlaylistSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read playlist %s: %w", filename, err)
+	}
+	if len(playlist) > maxPlaylistSize {
+		return nil, fmt.Errorf("%w: playlist %s exceeds %d bytes", media.ErrTooLarge, filename, maxPlaylistSize)
+	}
+	return playlist, nil
+}
+
+// resolve returns the filename a URI in the playlist stored as filename refers to.
+// It reports false for absolute URLs and paths, which do not point into storage.
+func resolve(filename string, uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.IsAbs() || u.Host != "" || path.IsAbs(u.Path) || u.Path == "" {
+		return "", false
+	}
+	return path.Join(path.Dir(filename), u.Path), true
+}
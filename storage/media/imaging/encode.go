@@ -0,0 +1,101 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os/exec"
+	"strconv"
+)
+
+// Format is an output image format
+type Format string
+
+const (
+	JPEG Format = "jpeg"
+	PNG  Format = "png"
+	WebP Format = "webp"
+)
+
+// ContentType returns the MIME type of the format
+func (f Format) ContentType() string {
+	return "image/" + string(f)
+}
+
+// Extension returns the filename extension of the format, including the dot
+func (f Format) Extension() string {
+	if f == JPEG {
+		return ".jpg"
+	}
+	return "." + string(f)
+}
+
+// defaultFormat returns the output format used for a source of contentType when none is requested:
+// PNG for sources that may be transparent, JPEG otherwise
+func defaultFormat(contentType string) Format {
+	if contentType == "image/png" || contentType == "image/gif" {
+		return PNG
+	}
+	return JPEG
+}
+
+// encode encodes img in format, using webp for WebP
+func encode(ctx context.Context, img image.Image, format Format, quality int, webp EncodeFunc) ([]byte, error) {
+	encodeFunc := EncodeJPEG
+	switch format {
+	case PNG:
+		encodeFunc = EncodePNG
+	case WebP:
+		encodeFunc = webp
+	}
+
+	var buf bytes.Buffer
+	if err := encodeFunc(ctx, &buf, img, quality); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EncodeFunc encodes img to w. quality ranges from 1 to 100 and is ignored by lossless formats.
+type EncodeFunc func(ctx context.Context, w io.Writer, img image.Image, quality int) error
+
+// EncodeJPEG encodes img as JPEG, flattening transparency onto white
+func EncodeJPEG(ctx context.Context, w io.Writer, img image.Image, quality int) error {
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+	return jpeg.Encode(w, flat, &jpeg.Options{Quality: quality})
+}
+
+// EncodePNG encodes img as PNG
+func EncodePNG(ctx context.Context, w io.Writer, img image.Image, quality int) error {
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	return encoder.Encode(w, img)
+}
+
+// CWebPEncoder returns an EncodeFunc running the libwebp cwebp binary at path ("cwebp" to search PATH).
+// The standard library and golang.org/x/image only decode WebP, so encoding needs the external tool.
+func CWebPEncoder(path string) EncodeFunc {
+	return func(ctx context.Context, w io.Writer, img image.Image, quality int) error {
+		var input bytes.Buffer
+		if err := png.Encode(&input, img); err != nil {
+			return err
+		}
+
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, path, "-quiet", "-q", strconv.Itoa(quality), "-metadata", "none", "-o", "-", "--", "-")
+		cmd.Stdin = &input
+		cmd.Stdout = w
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("cwebp failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,244 @@
+// Package imaging decodes uploaded images, strips their metadata and stores resized variants
+// alongside the original through media.Media.
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/weiawesome/wesio-live/libs/logger"
+	"github.com/weiawesome/wesio-live/storage/media"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	// ErrUnsupportedFormat is returned for data that is not a decodable image
+	ErrUnsupportedFormat = errors.New("imaging: unsupported image format")
+	// ErrTooManyPixels is returned for images larger than Options.MaxPixels, such as decompression bombs
+	ErrTooManyPixels = errors.New("imaging: image has too many pixels")
+)
+
+// Variant describes a resized copy of an image
+type Variant struct {
+	Name    string // Appended to the original filename, e.g. "128" stores photo.jpg as photo_128.jpg
+	Size    int    // Maximum width and height in pixels
+	Square  bool   // Center-crop to a square, as avatars are shown
+	Format  Format // Output format; empty keeps PNG for PNG and GIF sources and uses JPEG otherwise
+	Quality int    // Lossy quality, 0 uses Options.Quality
+}
+
+// AvatarVariants are the square sizes avatars are shown at
+var AvatarVariants = []Variant{
+	{Name: "64", Size: 64, Square: true},
+	{Name: "128", Size: 128, Square: true},
+	{Name: "512", Size: 512, Square: true},
+}
+
+// Options configures a Pipeline
+type Options struct {
+	Variants  []Variant
+	MaxSize   int64      // Maximum input size in bytes
+	MaxPixels int64      // Maximum width x height of the input
+	Quality   int        // Default lossy quality
+	WebP      EncodeFunc // Encoder for WebP variants, such as CWebPEncoder; required when a variant uses WebP
+}
+
+// DefaultOptions returns default pipeline options producing avatar variants
+func DefaultOptions() Options {
+	return Options{
+		Variants:  AvatarVariants,
+		MaxSize:   20 * 1024 * 1024,
+		MaxPixels: 40_000_000,
+		Quality:   85,
+	}
+}
+
+// Image describes a stored image
+type Image struct {
+	Key         string `json:"key"`
+	Filename    string `json:"filename"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// Manifest lists the stored original and its variants by variant name
+type Manifest struct {
+	Original Image            `json:"original"`
+	Variants map[string]Image `json:"variants"`
+}
+
+// Pipeline processes image uploads
+type Pipeline struct {
+	media media.Media
+	opts  Options
+}
+
+func CreatePipeline(m media.Media, opts Options) (*Pipeline, error) {
+	defaults := DefaultOptions()
+	if opts.Variants == nil {
+		opts.Variants = defaults.Variants
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = defaults.MaxSize
+	}
+	if opts.MaxPixels <= 0 {
+		opts.MaxPixels = defaults.MaxPixels
+	}
+	if opts.Quality <= 0 {
+		opts.Quality = defaults.Quality
+	}
+
+	names := make(map[string]bool, len(opts.Variants))
+	for _, v := range opts.Variants {
+		if v.Name == "" || strings.ContainsAny(v.Name, "/.") || names[v.Name] {
+			return nil, fmt.Errorf("invalid or duplicate image variant name %q", v.Name)
+		}
+		names[v.Name] = true
+		if v.Size <= 0 {
+			return nil, fmt.Errorf("image variant %q has no size", v.Name)
+		}
+		switch v.Format {
+		case "", JPEG, PNG:
+		case WebP:
+			if opts.WebP == nil {
+				return nil, fmt.Errorf("image variant %q needs a WebP encoder", v.Name)
+			}
+		default:
+			return nil, fmt.Errorf("image variant %q has unsupported format %q", v.Name, v.Format)
+		}
+	}
+
+	return &Pipeline{media: m, opts: opts}, nil
+}
+
+// Process stores the image with its metadata stripped under filename and its variants next to it.
+// If any upload fails, the files already stored are deleted.
+func (p *Pipeline) Process(ctx context.Context, filename string, data io.Reader) (*Manifest, error) {
+	raw, err := io.ReadAll(io.LimitReader(data, p.opts.MaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if int64(len(raw)) > p.opts.MaxSize {
+		return nil, fmt.Errorf("%w: image exceeds %d bytes", media.ErrTooLarge, p.opts.MaxSize)
+	}
+
+	// Check the dimensions before decoding so oversized images are never allocated
+	config, format, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	if int64(config.Width)*int64(config.Height) > p.opts.MaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrTooManyPixels, config.Width, config.Height)
+	}
+
+	stripped, orientation, err := StripMetadata(raw)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+
+	width, height := config.Width, config.Height
+	if orientation >= 5 {
+		width, height = height, width
+	}
+
+	manifest := &Manifest{Variants: make(map[string]Image, len(p.opts.Variants))}
+	var stored []string
+	cleanup := func() {
+		if len(stored) == 0 {
+			return
+		}
+		if err := p.media.DeleteMany(context.WithoutCancel(ctx), media.Image, stored); err != nil {
+			logger.Error("imaging", "process", "failed to delete partially processed image", err, map[string]interface{}{
+				"filename": filename,
+			})
+		}
+	}
+
+	original, err := p.store(ctx, filename, "image/"+format, stripped, width, height)
+	if err != nil {
+		return nil, err
+	}
+	stored = append(stored, filename)
+	manifest.Original = *original
+
+	for _, v := range p.opts.Variants {
+		outFormat := v.Format
+		if outFormat == "" {
+			outFormat = defaultFormat("image/" + format)
+		}
+		quality := v.Quality
+		if quality <= 0 {
+			quality = p.opts.Quality
+		}
+
+		resized := Orient(Resize(img, v.Size, v.Square), orientation)
+		encoded, err := encode(ctx, resized, outFormat, quality, p.opts.WebP)
+		if err != nil {
+			cleanup()
+			return nil, fmt.Errorf("failed to encode image variant %s: %w", v.Name, err)
+		}
+
+		bounds := resized.Bounds()
+		variantFilename := VariantFilename(filename, v.Name, outFormat)
+		variant, err := p.store(ctx, variantFilename, outFormat.ContentType(), encoded, bounds.Dx(), bounds.Dy())
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		stored = append(stored, variantFilename)
+		manifest.Variants[v.Name] = *variant
+	}
+
+	return manifest, nil
+}
+
+func (p *Pipeline) store(ctx context.Context, filename string, contentType string, data []byte, width int, height int) (*Image, error) {
+	key, err := p.media.Upload(ctx, media.Image, filename, bytes.NewReader(data), &media.UploadOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store image %s: %w", filename, err)
+	}
+
+	return &Image{
+		Key:         key,
+		Filename:    filename,
+		Width:       width,
+		Height:      height,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+	}, nil
+}
+
+// VariantFilename returns the filename a variant of filename is stored under
+func VariantFilename(filename string, name string, format Format) string {
+	stem := strings.TrimSuffix(filename, path.Ext(filename))
+	return stem + "_" + name + format.Extension()
+}
+
+// Group returns the key shared by an image and its variants: the key without its extension and
+// variant suffix. Set it as media.GCOptions.Group so referencing one variant keeps them all.
+func (p *Pipeline) Group(key string) string {
+	stem := strings.TrimSuffix(key, path.Ext(key))
+	for _, v := range p.opts.Variants {
+		if trimmed, ok := strings.CutSuffix(stem, "_"+v.Name); ok {
+			return trimmed
+		}
+	}
+	return stem
+}
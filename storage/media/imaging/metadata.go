@@ -0,0 +1,270 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// exifHeader prefixes the TIFF structure in a JPEG APP1 segment
+const exifHeader = "Exif\x00\x00"
+
+// StripMetadata removes EXIF, XMP, IPTC and text metadata (including GPS positions) from a JPEG,
+// PNG or WebP image without re-encoding it. Colour profiles are kept. The EXIF orientation is
+// returned and, when the image is not upright, kept as the only EXIF tag so viewers still rotate it.
+// Other formats are returned unchanged with orientation 1.
+func StripMetadata(data []byte) ([]byte, int, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8")):
+		return stripJPEG(data)
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return stripPNG(data)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return stripWebP(data)
+	default:
+		return data, 1, nil
+	}
+}
+
+func stripJPEG(data []byte) ([]byte, int, error) {
+	orientation := 1
+	var kept bytes.Buffer
+
+	pos := 2
+	for {
+		if pos+2 > len(data) || data[pos] != 0xff {
+			return nil, 0, fmt.Errorf("%w: malformed JPEG marker", ErrUnsupportedFormat)
+		}
+		marker := data[pos+1]
+		switch {
+		case marker == 0xff:
+			// Fill byte
+			pos++
+			continue
+		case marker == 0xd9 || marker == 0xda:
+			// End of image or start of scan: the rest is entropy-coded data
+			kept.Write(data[pos:])
+			return assembleJPEG(kept.Bytes(), orientation), orientation, nil
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7):
+			kept.Write(data[pos : pos+2])
+			pos += 2
+			continue
+		}
+
+		if pos+4 > len(data) {
+			return nil, 0, fmt.Errorf("%w: truncated JPEG segment", ErrUnsupportedFormat)
+		}
+		// The length includes its own two bytes, so anything shorter is malformed
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 {
+			return nil, 0, fmt.Errorf("%w: invalid JPEG segment length", ErrUnsupportedFormat)
+		}
+		end := pos + 2 + length
+		if end > len(data) {
+			return nil, 0, fmt.Errorf("%w: truncated JPEG segment", ErrUnsupportedFormat)
+		}
+
+		segment := data[pos:end]
+		switch marker {
+		case 0xe1: // APP1: EXIF or XMP
+			if len(segment) < 4 {
+				break
+			}
+			if payload := segment[4:]; bytes.HasPrefix(payload, []byte(exifHeader)) {
+				orientation = exifOrientation(payload[len(exifHeader):])
+			}
+		case 0xed, 0xfe: // APP13 (IPTC) and comments
+		default:
+			kept.Write(segment)
+		}
+		pos = end
+	}
+}
+
+// assembleJPEG prefixes segments with SOI and, for rotated images, a minimal EXIF segment
+func assembleJPEG(segments []byte, orientation int) []byte {
+	var out bytes.Buffer
+	out.WriteString("\xff\xd8")
+	if orientation != 1 {
+		payload := append([]byte(exifHeader), orientationTIFF(orientation)...)
+		out.Write([]byte{0xff, 0xe1})
+		binary.Write(&out, binary.BigEndian, uint16(len(payload)+2))
+		out.Write(payload)
+	}
+	out.Write(segments)
+	return out.Bytes()
+}
+
+func stripPNG(data []byte) ([]byte, int, error) {
+	orientation := 1
+	var out bytes.Buffer
+	out.Write(data[:8])
+
+	pos := 8
+	for pos < len(data) {
+		if pos+12 > len(data) {
+			return nil, 0, fmt.Errorf("%w: truncated PNG chunk", ErrUnsupportedFormat)
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, 0, fmt.Errorf("%w: truncated PNG chunk", ErrUnsupportedFormat)
+		}
+		chunkType := string(data[pos+4 : pos+8])
+		if pos == 8 && chunkType != "IHDR" {
+			return nil, 0, fmt.Errorf("%w: PNG does not start with IHDR", ErrUnsupportedFormat)
+		}
+
+		switch chunkType {
+		case "eXIf":
+			orientation = exifOrientation(data[pos+8 : pos+8+length])
+		case "tEXt", "zTXt", "iTXt", "tIME":
+		default:
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+
+	if orientation == 1 {
+		return out.Bytes(), orientation, nil
+	}
+
+	// eXIf must precede the image data, so it goes right after IHDR
+	stripped := out.Bytes()
+	ihdrEnd := 8 + 12 + int(binary.BigEndian.Uint32(stripped[8:]))
+	var withExif bytes.Buffer
+	withExif.Write(stripped[:ihdrEnd])
+	writePNGChunk(&withExif, "eXIf", orientationTIFF(orientation))
+	withExif.Write(stripped[ihdrEnd:])
+	return withExif.Bytes(), orientation, nil
+}
+
+func writePNGChunk(w *bytes.Buffer, chunkType string, payload []byte) {
+	binary.Write(w, binary.BigEndian, uint32(len(payload)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(chunkType))
+	crc.Write(payload)
+	w.WriteString(chunkType)
+	w.Write(payload)
+	binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// VP8X feature flags
+const (
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+func stripWebP(data []byte) ([]byte, int, error) {
+	orientation := 1
+	var chunks bytes.Buffer
+	vp8xFlags := -1 // offset of the VP8X flags byte in chunks
+
+	pos := 12
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, 0, fmt.Errorf("%w: truncated WebP chunk", ErrUnsupportedFormat)
+		}
+		fourCC := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size + size%2
+		if size < 0 || pos+8+size > len(data) {
+			return nil, 0, fmt.Errorf("%w: truncated WebP chunk", ErrUnsupportedFormat)
+		}
+		end = min(end, len(data))
+
+		switch fourCC {
+		case "EXIF":
+			payload := data[pos+8 : pos+8+size]
+			// Some encoders keep the JPEG style header
+			payload = bytes.TrimPrefix(payload, []byte(exifHeader))
+			orientation = exifOrientation(payload)
+			if orientation != 1 {
+				writeWebPChunk(&chunks, "EXIF", orientationTIFF(orientation))
+			}
+		case "XMP ":
+		default:
+			if fourCC == "VP8X" {
+				vp8xFlags = chunks.Len() + 8
+			}
+			chunks.Write(data[pos:end])
+		}
+		pos = end
+	}
+
+	body := chunks.Bytes()
+	if vp8xFlags >= 0 && vp8xFlags < len(body) {
+		body[vp8xFlags] &^= webpFlagXMP
+		if orientation == 1 {
+			body[vp8xFlags] &^= webpFlagEXIF
+		}
+	}
+
+	var out bytes.Buffer
+	out.WriteString("RIFF")
+	binary.Write(&out, binary.LittleEndian, uint32(4+len(body)))
+	out.WriteString("WEBP")
+	out.Write(body)
+	return out.Bytes(), orientation, nil
+}
+
+func writeWebPChunk(w *bytes.Buffer, fourCC string, payload []byte) {
+	w.WriteString(fourCC)
+	binary.Write(w, binary.LittleEndian, uint32(len(payload)))
+	w.Write(payload)
+	if len(payload)%2 == 1 {
+		w.WriteByte(0)
+	}
+}
+
+// exifOrientation returns the Orientation tag of a TIFF structure, 1 when it is missing or invalid
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) != 0x0112 {
+			continue
+		}
+		if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+			return orientation
+		}
+		return 1
+	}
+	return 1
+}
+
+// orientationTIFF returns a big-endian TIFF structure holding only the Orientation tag
+func orientationTIFF(orientation int) []byte {
+	var b bytes.Buffer
+	b.WriteString("MM\x00\x2a")
+	binary.Write(&b, binary.BigEndian, uint32(8))      // IFD0 offset
+	binary.Write(&b, binary.BigEndian, uint16(1))      // Entry count
+	binary.Write(&b, binary.BigEndian, uint16(0x0112)) // Orientation
+	binary.Write(&b, binary.BigEndian, uint16(3))      // SHORT
+	binary.Write(&b, binary.BigEndian, uint32(1))      // Count
+	binary.Write(&b, binary.BigEndian, uint16(orientation))
+	binary.Write(&b, binary.BigEndian, uint16(0)) // Value padding
+	binary.Write(&b, binary.BigEndian, uint32(0)) // No next IFD
+	return b.Bytes()
+}
@@ -0,0 +1,207 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/weiawesome/wesio-live/storage/media"
+	"github.com/weiawesome/wesio-live/storage/media/mediatest"
+)
+
+func FuzzStripMetadata(f *testing.F) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	img.Set(1, 1, color.RGBA{R: 255, A: 255})
+
+	var jpg, pngData bytes.Buffer
+	if err := jpeg.Encode(&jpg, img, nil); err != nil {
+		f.Fatal(err)
+	}
+	if err := png.Encode(&pngData, img); err != nil {
+		f.Fatal(err)
+	}
+
+	f.Add(jpg.Bytes())
+	// APP1 segments declaring a length shorter than the length field itself
+	f.Add(append([]byte("\xff\xd8\xff\xe1\x00\x00"), jpg.Bytes()[2:]...))
+	f.Add(pngData.Bytes())
+	f.Add([]byte("\xff\xd8\xff\xe1\x00\x00"))
+	f.Add([]byte("\xff\xd8\xff\xe1\x00\x01"))
+	f.Add([]byte("RIFF\x00\x00\x00\x00WEBPVP8X\x0a\x00\x00\x00"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		stripped, orientation, err := StripMetadata(data)
+		if err != nil {
+			return
+		}
+		if orientation < 1 || orientation > 8 {
+			t.Fatalf("orientation %d out of range", orientation)
+		}
+		// Stripping is idempotent on its own output
+		again, orientationAgain, err := StripMetadata(stripped)
+		if err != nil {
+			t.Fatalf("failed to strip stripped image: %v", err)
+		}
+		if orientationAgain != orientation {
+			t.Fatalf("orientation changed from %d to %d", orientation, orientationAgain)
+		}
+		if !bytes.Equal(again, stripped) {
+			t.Fatalf("stripping is not idempotent")
+		}
+	})
+}
+
+// secrets are planted in the metadata of test images and must not survive stripping
+var secrets = []string{"GPS-SECRET", "XMP-SECRET", "IPTC-SECRET"}
+
+// exifWithGPS returns a little-endian TIFF structure with an orientation and a GPS IFD
+func exifWithGPS(orientation int) []byte {
+	var b bytes.Buffer
+	b.WriteString("II\x2a\x00")
+	binary.Write(&b, binary.LittleEndian, uint32(8)) // IFD0 offset
+	binary.Write(&b, binary.LittleEndian, uint16(2))
+	binary.Write(&b, binary.LittleEndian, []uint16{0x0112, 3}) // Orientation, SHORT
+	binary.Write(&b, binary.LittleEndian, uint32(1))
+	binary.Write(&b, binary.LittleEndian, []uint16{uint16(orientation), 0})
+	binary.Write(&b, binary.LittleEndian, []uint16{0x8825, 4}) // GPSInfo, LONG
+	binary.Write(&b, binary.LittleEndian, uint32(1))
+	binary.Write(&b, binary.LittleEndian, uint32(38)) // GPS IFD offset
+	binary.Write(&b, binary.LittleEndian, uint32(0))  // No next IFD
+	binary.Write(&b, binary.LittleEndian, uint16(1))
+	binary.Write(&b, binary.LittleEndian, []uint16{0x0001, 2}) // GPSLatitudeRef, ASCII
+	binary.Write(&b, binary.LittleEndian, uint32(2))
+	b.WriteString("N\x00\x00\x00")
+	binary.Write(&b, binary.LittleEndian, uint32(0))
+	b.WriteString("GPS-SECRET")
+	return b.Bytes()
+}
+
+// jpegWithMetadata encodes img as a JPEG carrying EXIF with GPS, XMP and IPTC segments
+func jpegWithMetadata(t *testing.T, img image.Image, orientation int) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("\xff\xd8")
+	for _, segment := range []struct {
+		marker  byte
+		payload []byte
+	}{
+		{0xe1, append([]byte(exifHeader), exifWithGPS(orientation)...)},
+		{0xe1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta>XMP-SECRET</x:xmpmeta>")},
+		{0xed, []byte("Photoshop 3.0\x008BIM\x04\x04IPTC-SECRET")},
+	} {
+		out.Write([]byte{0xff, segment.marker})
+		binary.Write(&out, binary.BigEndian, uint16(len(segment.payload)+2))
+		out.Write(segment.payload)
+	}
+	out.Write(encoded.Bytes()[2:])
+	return out.Bytes()
+}
+
+// pngWithMetadata encodes img as a PNG carrying eXIf with GPS, XMP and IPTC chunks
+func pngWithMetadata(t *testing.T, img image.Image, orientation int) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		t.Fatal(err)
+	}
+
+	data := encoded.Bytes()
+	ihdrEnd := 8 + 12 + int(binary.BigEndian.Uint32(data[8:]))
+	var out bytes.Buffer
+	out.Write(data[:ihdrEnd])
+	writePNGChunk(&out, "eXIf", exifWithGPS(orientation))
+	writePNGChunk(&out, "iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta>XMP-SECRET</x:xmpmeta>"))
+	writePNGChunk(&out, "zTXt", []byte("Raw profile type iptc\x00\x00IPTC-SECRET"))
+	out.Write(data[ihdrEnd:])
+	return out.Bytes()
+}
+
+func TestStripMetadataRemovesLocation(t *testing.T) {
+	// Wider than tall, so a rotated image is taller than wide
+	img := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	img.Set(1, 1, color.RGBA{R: 255, A: 255})
+
+	for _, tc := range []struct {
+		name        string
+		encode      func(*testing.T, image.Image, int) []byte
+		orientation int
+	}{
+		{"jpeg upright", jpegWithMetadata, 1},
+		{"jpeg rotated", jpegWithMetadata, 6},
+		{"png upright", pngWithMetadata, 1},
+		{"png rotated", pngWithMetadata, 6},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data := tc.encode(t, img, tc.orientation)
+			for _, secret := range secrets {
+				if !bytes.Contains(data, []byte(secret)) {
+					t.Fatalf("test image is missing %s", secret)
+				}
+			}
+
+			stripped, orientation, err := StripMetadata(data)
+			if err != nil {
+				t.Fatalf("StripMetadata: %v", err)
+			}
+			checkStripped(t, stripped, tc.orientation)
+			if orientation != tc.orientation {
+				t.Fatalf("orientation = %d, want %d", orientation, tc.orientation)
+			}
+
+			m := mediatest.CreateMemoryMedia()
+			p, err := CreatePipeline(m, Options{Variants: []Variant{{Name: "8", Size: 8}}})
+			if err != nil {
+				t.Fatalf("CreatePipeline: %v", err)
+			}
+			manifest, err := p.Process(context.Background(), "photo", bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+
+			rc, err := m.Download(context.Background(), media.Image, manifest.Original.Filename)
+			if err != nil {
+				t.Fatalf("Download: %v", err)
+			}
+			original, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatalf("failed to read original: %v", err)
+			}
+			checkStripped(t, original, tc.orientation)
+
+			variant := manifest.Variants["8"]
+			if rotated := tc.orientation >= 5; rotated != (manifest.Original.Height > manifest.Original.Width) ||
+				rotated != (variant.Height > variant.Width) {
+				t.Fatalf("original is %dx%d and variant %dx%d with orientation %d",
+					manifest.Original.Width, manifest.Original.Height, variant.Width, variant.Height, tc.orientation)
+			}
+		})
+	}
+}
+
+// checkStripped verifies a stripped image decodes, holds none of the planted metadata and keeps its orientation
+func checkStripped(t *testing.T, data []byte, orientation int) {
+	t.Helper()
+	if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("stripped image does not decode: %v", err)
+	}
+	for _, secret := range secrets {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Fatalf("stripped image still contains %s", secret)
+		}
+	}
+	if _, kept, err := StripMetadata(data); err != nil || kept != orientation {
+		t.Fatalf("stripped image has orientation %d (%v), want %d", kept, err, orientation)
+	}
+}
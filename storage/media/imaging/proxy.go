@@ -0,0 +1,423 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weiawesome/wesio-live/libs/logger"
+	"github.com/weiawesome/wesio-live/storage/media"
+)
+
+// Transform describes how the proxy renders an image
+type Transform struct {
+	Width   int
+	Height  int
+	Fit     Fit    // FitContain if empty
+	Format  Format // Empty keeps PNG for PNG and GIF sources and uses JPEG otherwise
+	Quality int    // 0 uses ProxyOptions.Quality
+}
+
+// ProxyOptions configures a Proxy. Memory per request is bounded by MaxSourceSize plus four bytes
+// per pixel of MaxSourcePixels, and at most MaxConcurrent renders run at once.
+type ProxyOptions struct {
+	BaseURL  string             // Public URL the proxy is mounted at, e.g. https://api.example.com/img
+	Keys     []media.SigningKey // Keys accepted for signatures; the first signs URLs built by URL
+	FileType media.FileType     // Type of the originals, media.Image if empty
+
+	CachePrefix     string        // Filename prefix rendered images are cached under
+	MaxDimension    int           // Maximum requested width or height
+	MaxSourceSize   int64         // Maximum size of an original in bytes
+	MaxSourcePixels int64         // Maximum width x height of an original
+	MaxConcurrent   int           // Renders running at once; further requests wait until Timeout
+	Timeout         time.Duration // Deadline for reading, rendering and caching one image
+	Quality         int           // Default lossy quality
+	CacheControl    string        // Sent with rendered images
+	WebP            EncodeFunc    // Encoder for WebP output; WebP requests are rejected without it
+}
+
+// DefaultProxyOptions returns default proxy options
+func DefaultProxyOptions() ProxyOptions {
+	return ProxyOptions{
+		FileType:        media.Image,
+		CachePrefix:     "_resized",
+		MaxDimension:    2048,
+		MaxSourceSize:   20 * 1024 * 1024,
+		MaxSourcePixels: 40_000_000,
+		MaxConcurrent:   runtime.NumCPU(),
+		Timeout:         30 * time.Second,
+		Quality:         85,
+		CacheControl:    "public, max-age=86400",
+	}
+}
+
+// Proxy is an http.Handler rendering resized images from signed URLs and caching the results in storage
+type Proxy struct {
+	media   media.Media
+	opts    ProxyOptions
+	baseURL *url.URL
+	renders chan struct{}
+}
+
+func CreateProxy(m media.Media, opts ProxyOptions) (*Proxy, error) {
+	if len(opts.Keys) == 0 || opts.Keys[0].Secret == "" {
+		return nil, fmt.Errorf("image proxy signing key not configured")
+	}
+	baseURL, err := url.Parse(opts.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image proxy base URL: %w", err)
+	}
+	baseURL.Path = strings.TrimSuffix(baseURL.Path, "/")
+
+	defaults := DefaultProxyOptions()
+	if opts.FileType == "" {
+		opts.FileType = defaults.FileType
+	}
+	if opts.CachePrefix == "" {
+		opts.CachePrefix = defaults.CachePrefix
+	}
+	if opts.MaxDimension <= 0 {
+		opts.MaxDimension = defaults.MaxDimension
+	}
+	if opts.MaxSourceSize <= 0 {
+		opts.MaxSourceSize = defaults.MaxSourceSize
+	}
+	if opts.MaxSourcePixels <= 0 {
+		opts.MaxSourcePixels = defaults.MaxSourcePixels
+	}
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = defaults.MaxConcurrent
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaults.Timeout
+	}
+	if opts.Quality <= 0 {
+		opts.Quality = defaults.Quality
+	}
+	if opts.CacheControl == "" {
+		opts.CacheControl = defaults.CacheControl
+	}
+
+	return &Proxy{
+		media:   m,
+		opts:    opts,
+		baseURL: baseURL,
+		renders: make(chan struct{}, opts.MaxConcurrent),
+	}, nil
+}
+
+// URL returns a signed proxy URL rendering filename with t. A zero expiration never expires,
+// which keeps the URL stable for CDN caching.
+func (p *Proxy) URL(filename string, t Transform, expiration time.Duration) (string, error) {
+	if err := p.validate(t); err != nil {
+		return "", err
+	}
+
+	u := *p.baseURL
+	u.Path = u.Path + "/" + filename
+
+	query := url.Values{}
+	if t.Width > 0 {
+		query.Set("w", strconv.Itoa(t.Width))
+	}
+	if t.Height > 0 {
+		query.Set("h", strconv.Itoa(t.Height))
+	}
+	if t.Fit != "" {
+		query.Set("fit", string(t.Fit))
+	}
+	if t.Format != "" {
+		query.Set("fmt", string(t.Format))
+	}
+	if t.Quality > 0 {
+		query.Set("q", strconv.Itoa(t.Quality))
+	}
+	if expiration > 0 {
+		query.Set("expires", strconv.FormatInt(time.Now().Add(expiration).Unix(), 10))
+	}
+
+	key := p.opts.Keys[0]
+	if key.ID != "" {
+		query.Set("kid", key.ID)
+	}
+	query.Set("signature", signProxyURL(key.Secret, u.Path, query))
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// signProxyURL returns the hex HMAC-SHA256 of the path and every query parameter except the signature
+func signProxyURL(secret string, urlPath string, query url.Values) string {
+	signed := url.Values{}
+	for k, v := range query {
+		if k != "signature" {
+			signed[k] = v
+		}
+	}
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(urlPath + "?" + signed.Encode()))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// verify checks the signature and expiry of a proxy request
+func (p *Proxy) verify(u *url.URL, now time.Time) error {
+	query := u.Query()
+	signature := query.Get("signature")
+	if signature == "" {
+		return media.ErrSignatureMissing
+	}
+	if expiresParam := query.Get("expires"); expiresParam != "" {
+		expires, err := strconv.ParseInt(expiresParam, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: malformed expires", media.ErrSignatureInvalid)
+		}
+		if now.Unix() > expires {
+			return media.ErrSignatureExpired
+		}
+	}
+
+	kid := query.Get("kid")
+	found := false
+	for _, key := range p.opts.Keys {
+		if kid != "" && key.ID != kid {
+			continue
+		}
+		found = true
+		if hmac.Equal([]byte(signProxyURL(key.Secret, u.Path, query)), []byte(signature)) {
+			return nil
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: %q", media.ErrSignatureUnknownKey, kid)
+	}
+	return media.ErrSignatureInvalid
+}
+
+// parseTransform reads the transform parameters of a proxy request
+func (p *Proxy) parseTransform(query url.Values) (Transform, error) {
+	var t Transform
+	for param, dst := range map[string]*int{"w": &t.Width, "h": &t.Height, "q": &t.Quality} {
+		if value := query.Get(param); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return t, fmt.Errorf("invalid %s parameter", param)
+			}
+			*dst = n
+		}
+	}
+	t.Fit = Fit(query.Get("fit"))
+	t.Format = Format(query.Get("fmt"))
+	return t, p.validate(t)
+}
+
+func (p *Proxy) validate(t Transform) error {
+	switch {
+	case t.Width < 0 || t.Height < 0 || (t.Width == 0 && t.Height == 0):
+		return fmt.Errorf("width or height required")
+	case t.Width > p.opts.MaxDimension || t.Height > p.opts.MaxDimension:
+		return fmt.Errorf("width and height must not exceed %d", p.opts.MaxDimension)
+	case t.Quality < 0 || t.Quality > 100:
+		return fmt.Errorf("quality must be between 1 and 100")
+	}
+	switch t.Fit {
+	case "", FitContain, FitCover:
+	default:
+		return fmt.Errorf("unsupported fit %q", t.Fit)
+	}
+	switch t.Format {
+	case "", JPEG, PNG:
+	case WebP:
+		if p.opts.WebP == nil {
+			return fmt.Errorf("WebP output is not enabled")
+		}
+	default:
+		return fmt.Errorf("unsupported format %q", t.Format)
+	}
+	return nil
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	filename, ok := strings.CutPrefix(r.URL.Path, p.baseURL.Path+"/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := p.verify(r.URL, time.Now()); err != nil {
+		logger.Warn("imaging", "proxy", "rejected image proxy URL", map[string]interface{}{
+			"path":  r.URL.Path,
+			"error": err.Error(),
+		})
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	t, err := p.parseTransform(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), p.opts.Timeout)
+	defer cancel()
+
+	source, err := p.media.Stat(ctx, p.opts.FileType, filename)
+	if err != nil {
+		writeProxyError(w, err)
+		return
+	}
+
+	// Rendered images are cached per source version, so overwriting an original invalidates them
+	etag := renderETag(source, t)
+	w.Header().Set("ETag", `"`+etag+`"`)
+	w.Header().Set("Cache-Control", p.opts.CacheControl)
+	if match := r.Header.Get("If-None-Match"); match == `"`+etag+`"` || match == "*" {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	format := t.Format
+	if format == "" {
+		format = defaultFormat(source.ContentType)
+	}
+	cacheName := path.Join(p.opts.CachePrefix, filename, etag+format.Extension())
+
+	if cached, err := p.media.Download(ctx, p.opts.FileType, cacheName); err == nil {
+		defer cached.Close()
+		w.Header().Set("Content-Type", format.ContentType())
+		if r.Method == http.MethodGet {
+			io.Copy(w, cached)
+		}
+		return
+	}
+
+	rendered, err := p.render(ctx, filename, source, t, format)
+	if err != nil {
+		writeProxyError(w, err)
+		return
+	}
+
+	if _, err := p.media.Upload(ctx, p.opts.FileType, cacheName, bytes.NewReader(rendered), &media.UploadOptions{
+		ContentType: format.ContentType(),
+	}); err != nil {
+		// Serving the render matters more than caching it
+		logger.Error("imaging", "proxy", "failed to cache rendered image", err, map[string]interface{}{
+			"filename": cacheName,
+		})
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Length", strconv.Itoa(len(rendered)))
+	if r.Method == http.MethodGet {
+		w.Write(rendered)
+	}
+}
+
+// render reads and resizes an original, waiting for a free render slot
+func (p *Proxy) render(ctx context.Context, filename string, source *media.FileInfo, t Transform, format Format) ([]byte, error) {
+	if source.Size > p.opts.MaxSourceSize {
+		return nil, fmt.Errorf("%w: original exceeds %d bytes", media.ErrTooLarge, p.opts.MaxSourceSize)
+	}
+
+	select {
+	case p.renders <- struct{}{}:
+		defer func() { <-p.renders }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	rc, err := p.media.Download(ctx, p.opts.FileType, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(rc, p.opts.MaxSourceSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read original: %w", err)
+	}
+	if int64(len(raw)) > p.opts.MaxSourceSize {
+		return nil, fmt.Errorf("%w: original exceeds %d bytes", media.ErrTooLarge, p.opts.MaxSourceSize)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	if int64(config.Width)*int64(config.Height) > p.opts.MaxSourcePixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrTooManyPixels, config.Width, config.Height)
+	}
+
+	_, orientation, err := StripMetadata(raw)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+
+	// Resizing before rotating is cheaper; rotated orientations swap the box instead
+	width, height := t.Width, t.Height
+	if orientation >= 5 {
+		width, height = height, width
+	}
+	fit := t.Fit
+	if fit == "" {
+		fit = FitContain
+	}
+	resized := Orient(ResizeTo(img, width, height, fit), orientation)
+
+	quality := t.Quality
+	if quality <= 0 {
+		quality = p.opts.Quality
+	}
+	encoded, err := encode(ctx, resized, format, quality, p.opts.WebP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return encoded, nil
+}
+
+// renderETag identifies a rendering of one version of an original
+func renderETag(source *media.FileInfo, t Transform) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%d\n%s\n%dx%d\n%s\n%s\n%d", source.Key, source.Size, source.ETag, t.Width, t.Height, t.Fit, t.Format, t.Quality)
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// writeProxyError maps media and imaging errors to HTTP status codes
+func writeProxyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, media.ErrNotFound):
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	case errors.Is(err, media.ErrInvalidFilename):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, media.ErrTooLarge), errors.Is(err, ErrTooManyPixels), errors.Is(err, ErrUnsupportedFormat):
+		// The stored original cannot be rendered
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
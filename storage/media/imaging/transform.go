@@ -0,0 +1,114 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// Fit selects how an image is fitted into a width x height box
+type Fit string
+
+const (
+	FitContain Fit = "contain" // Scale to fit inside the box, keeping the aspect ratio
+	FitCover   Fit = "cover"   // Scale and center-crop to fill the box
+)
+
+// Resize scales img to fit within a size x size box, or when square is set, center-crops it to
+// a square of at most size pixels. Images are never enlarged.
+func Resize(img image.Image, size int, square bool) image.Image {
+	if square {
+		return ResizeTo(img, size, size, FitCover)
+	}
+	return ResizeTo(img, size, size, FitContain)
+}
+
+// ResizeTo fits img into a width x height box. A zero width or height is derived from the aspect
+// ratio. Images are never enlarged; a covered box larger than the image shrinks to keep its ratio.
+func ResizeTo(img image.Image, width int, height int, fit Fit) image.Image {
+	src := img.Bounds()
+	w, h := src.Dx(), src.Dy()
+
+	var dstW, dstH int
+	switch {
+	case fit == FitCover && width > 0 && height > 0:
+		// Crop the source to the box's aspect ratio around its center
+		if w*height > h*width {
+			cropW := max(1, h*width/height)
+			src = image.Rect(0, 0, cropW, h).Add(src.Min).Add(image.Pt((w-cropW)/2, 0))
+		} else {
+			cropH := max(1, w*height/width)
+			src = image.Rect(0, 0, w, cropH).Add(src.Min).Add(image.Pt(0, (h-cropH)/2))
+		}
+		dstW, dstH = width, height
+		if dstW > src.Dx() {
+			dstW, dstH = src.Dx(), max(1, height*src.Dx()/width)
+		}
+	default:
+		if width <= 0 {
+			width = w
+		}
+		if height <= 0 {
+			height = h
+		}
+		dstW, dstH = w, h
+		if dstW > width {
+			dstW, dstH = width, max(1, h*width/w)
+		}
+		if dstH > height {
+			dstW, dstH = max(1, w*height/h), height
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+	if dstW == src.Dx() && dstH == src.Dy() {
+		draw.Draw(dst, dst.Bounds(), img, src.Min, draw.Src)
+		return dst
+	}
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, src, xdraw.Src, nil)
+	return dst
+}
+
+// Orient applies an EXIF orientation (1-8) so the image is upright
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+
+	// source returns the source pixel shown at (x, y) of the upright image
+	source := func(x, y int) (int, int) {
+		switch orientation {
+		case 2:
+			return w - 1 - x, y
+		case 3:
+			return w - 1 - x, h - 1 - y
+		case 4:
+			return x, h - 1 - y
+		case 5:
+			return y, x
+		case 6:
+			return y, h - 1 - x
+		case 7:
+			return w - 1 - y, h - 1 - x
+		default:
+			return w - 1 - y, x
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			sx, sy := source(x, y)
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,154 @@
+package media
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/weiawesome/wesio-live/libs/config"
+)
+
+// LayoutMode selects how file types map onto buckets
+type LayoutMode string
+
+const (
+	// LayoutPerType stores each file type in its own bucket
+	LayoutPerType LayoutMode = "per_type"
+	// LayoutSingle stores every file type in one bucket under a per-type prefix
+	LayoutSingle LayoutMode = "single"
+)
+
+// BucketLayout maps a file type and filename to a bucket and object key
+type BucketLayout struct {
+	Mode    LayoutMode
+	Bucket  string              // Bucket used by LayoutSingle
+	Buckets map[FileType]string // Buckets used by LayoutPerType, missing types fall back to the defaults
+	Prefix  string              // Environment / tenant prefix prepended to every object key
+}
+
+// DefaultBucketLayout returns the per-type layout using the images, videos and files buckets
+func DefaultBucketLayout() BucketLayout {
+	return BucketLayout{
+		Mode: LayoutPerType,
+		Buckets: map[FileType]string{
+			Image: "images",
+			Video: "videos",
+			"":    "files",
+		},
+	}
+}
+
+// BucketLayoutFromConfig builds a bucket layout from the media configuration
+func BucketLayoutFromConfig(cfg config.MediaConfig) (BucketLayout, error) {
+	layout := DefaultBucketLayout()
+	layout.Prefix = strings.Trim(cfg.Layout.Prefix, "/")
+
+	switch LayoutMode(cfg.Layout.Mode) {
+	case "", LayoutPerType:
+		for name, bucket := range cfg.Layout.Buckets {
+			fileType, err := FileTypeFromConfigKey(name)
+			if err != nil {
+				return BucketLayout{}, err
+			}
+			layout.Buckets[fileType] = bucket
+		}
+	case LayoutSingle:
+		if cfg.BucketName == "" {
+			return BucketLayout{}, fmt.Errorf("bucket name is required for single bucket layout")
+		}
+		layout.Mode = LayoutSingle
+		layout.Bucket = cfg.BucketName
+	default:
+		return BucketLayout{}, fmt.Errorf("unsupported bucket layout mode: %q", cfg.Layout.Mode)
+	}
+
+	return layout, nil
+}
+
+// FileTypeFromConfigKey maps configuration keys (image, video, file) to file types
+func FileTypeFromConfigKey(name string) (FileType, error) {
+	switch name {
+	case "image":
+		return Image, nil
+	case "video":
+		return Video, nil
+	case "file", "files", "default":
+		return "", nil
+	default:
+		return "", fmt.Errorf("unknown media file type: %q", name)
+	}
+}
+
+// typeDirName returns the per-type prefix used by the single bucket layout
+func typeDirName(fileType FileType) string {
+	switch fileType {
+	case Image:
+		return "images"
+	case Video:
+		return "videos"
+	default:
+		return "files"
+	}
+}
+
+// fileTypeFromDirName maps a per-type directory name back to its file type
+func fileTypeFromDirName(dir string) (FileType, bool) {
+	switch dir {
+	case "images":
+		return Image, true
+	case "videos":
+		return Video, true
+	case "files":
+		return "", true
+	default:
+		return "", false
+	}
+}
+
+// BucketFor returns the bucket holding files of the given type
+func (l BucketLayout) BucketFor(fileType FileType) string {
+	if l.Mode == LayoutSingle {
+		return l.Bucket
+	}
+	if bucket, ok := l.Buckets[fileType]; ok && bucket != "" {
+		return bucket
+	}
+	return DefaultBucketLayout().Buckets[fileType]
+}
+
+// KeyPrefix returns the object key prefix for files of the given type, ending in "/" when non-empty
+func (l BucketLayout) KeyPrefix(fileType FileType) string {
+	var parts []string
+	if l.Prefix != "" {
+		parts = append(parts, l.Prefix)
+	}
+	if l.Mode == LayoutSingle {
+		parts = append(parts, typeDirName(fileType))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return strings.Join(parts, "/") + "/"
+}
+
+// Location returns the bucket and object key of a file
+func (l BucketLayout) Location(fileType FileType, filename string) (string, string) {
+	return l.BucketFor(fileType), l.KeyPrefix(fileType) + filename
+}
+
+// BucketNames returns the distinct buckets used by the layout
+func (l BucketLayout) BucketNames() []string {
+	if l.Mode == LayoutSingle {
+		return []string{l.Bucket}
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, fileType := range []FileType{Image, Video, ""} {
+		bucket := l.BucketFor(fileType)
+		if !seen[bucket] {
+			seen[bucket] = true
+			names = append(names, bucket)
+		}
+	}
+	return names
+}
@@ -2,7 +2,12 @@ package media
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"path"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -13,9 +18,68 @@ const (
 	Video FileType = "video"
 )
 
+// MetadataOwner is the metadata key holding the ID of the user a file is charged to by quota accounting.
+// It is only written through quota.Media, so files tagged with a user for other purposes, such as the
+// "user-id" of room recordings, are not charged to anyone.
+const MetadataOwner = "quota-owner"
+
+var (
+	// ErrNotFound is returned when the requested file does not exist
+	ErrNotFound = errors.New("media: file not found")
+	// ErrInvalidFilename is returned for filenames that are empty or escape the storage root
+	ErrInvalidFilename = errors.New("media: invalid filename")
+	// ErrInvalidRange is returned by DownloadRange when offset is beyond the end of the file
+	ErrInvalidRange = errors.New("media: invalid range")
+)
+
 type UploadOptions struct {
 	ContentType string
 	Metadata    map[string]string
+
+	// Size and Checksum (hex SHA-256) describe data when the caller already knows them. With both
+	// set backends can stream the upload instead of buffering it; a mismatch fails the upload.
+	Size     int64
+	Checksum string
+}
+
+// FileInfo describes a stored file
+type FileInfo struct {
+	Key          string
+	Filename     string
+	Size         int64
+	ContentType  string
+	ETag         string            // Unquoted entity tag, changes whenever the content changes
+	Metadata     map[string]string // User metadata with lower-case keys
+	LastModified time.Time
+}
+
+// defaultListLimit is the page size used by List when limit is not positive
+const defaultListLimit = 1000
+
+// ListPage is a page of files returned by List
+type ListPage struct {
+	Files      []FileInfo // Ordered by filename; backends may leave ContentType and Metadata empty
+	NextCursor string     // Cursor for the next page, empty on the last page
+}
+
+// DeleteErrors maps filenames to the error that prevented their deletion
+type DeleteErrors map[string]error
+
+func (e DeleteErrors) Error() string {
+	filenames := make([]string, 0, len(e))
+	for filename := range e {
+		filenames = append(filenames, filename)
+	}
+	if len(filenames) == 0 {
+		return "failed to delete files"
+	}
+	sort.Strings(filenames)
+
+	first := filenames[0]
+	if len(filenames) == 1 {
+		return fmt.Sprintf("failed to delete %s: %v", first, e[first])
+	}
+	return fmt.Sprintf("failed to delete %d files, first %s: %v", len(filenames), first, e[first])
 }
 
 type Media interface {
@@ -23,9 +87,79 @@ type Media interface {
 
 	Download(ctx context.Context, fileType FileType, filename string) (io.ReadCloser, error)
 
+	// DownloadRange returns length bytes starting at offset, or the rest of the file if length is -1.
+	// The range is truncated at the end of the file; a non-zero offset at or past the end returns ErrInvalidRange.
+	DownloadRange(ctx context.Context, fileType FileType, filename string, offset int64, length int64) (io.ReadCloser, error)
+
+	// Stat returns the metadata of a file, or an error wrapping ErrNotFound
+	Stat(ctx context.Context, fileType FileType, filename string) (*FileInfo, error)
+
+	// UpdateMetadata merges metadata into the user metadata of a stored file; an empty value removes the key.
+	// The content and content type are unchanged.
+	UpdateMetadata(ctx context.Context, fileType FileType, filename string, metadata map[string]string) error
+
 	GetURL(ctx context.Context, fileType FileType, filename string, expiration time.Duration) (string, error)
 
 	GetCDNURL(ctx context.Context, fileType FileType, filename string, expiration time.Duration) (string, error)
 
 	Delete(ctx context.Context, fileType FileType, filename string) error
+
+	// List returns up to limit files whose filename starts with prefix, after cursor ("" for the first page)
+	List(ctx context.Context, fileType FileType, prefix string, cursor string, limit int) (*ListPage, error)
+
+	// DeleteMany deletes files in bulk. Missing files are not an error; failures are returned as DeleteErrors.
+	DeleteMany(ctx context.Context, fileType FileType, filenames []string) error
+
+	// InitiateUpload starts a resumable upload session. size is the declared total size, -1 if unknown.
+	InitiateUpload(ctx context.Context, fileType FileType, filename string, size int64, opts *UploadOptions) (*UploadSession, error)
+
+	// GetUploadSession returns an in-progress session, or ErrSessionNotFound
+	GetUploadSession(ctx context.Context, sessionID string) (*UploadSession, error)
+
+	// UploadPart stores part partNumber of a session, replacing any previous part with that number.
+	// size is the exact part size, -1 if unknown; a shorter stream fails without storing the part.
+	UploadPart(ctx context.Context, sessionID string, partNumber int, data io.Reader, size int64) (*UploadPart, error)
+
+	// ListParts returns the stored parts of a session ordered by part number
+	ListParts(ctx context.Context, sessionID string) ([]UploadPart, error)
+
+	// CompleteUpload assembles every stored part in order and returns the file key, as Upload does
+	CompleteUpload(ctx context.Context, sessionID string) (string, error)
+
+	// AbortUpload discards a session and its parts
+	AbortUpload(ctx context.Context, sessionID string) error
+
+	// GetUploadURL returns a presigned form upload letting a client upload a file directly to storage
+	GetUploadURL(ctx context.Context, fileType FileType, filename string, constraints UploadConstraints) (*PresignedUpload, error)
+
+	// VerifyUpload checks a file uploaded with GetUploadURL against constraints, deleting it when it is rejected
+	VerifyUpload(ctx context.Context, fileType FileType, filename string, constraints UploadConstraints) (*UploadedFile, error)
+}
+
+// mergeMetadata returns current with updates applied, using lower-case keys as Stat returns them
+func mergeMetadata(current map[string]string, updates map[string]string) map[string]string {
+	merged := make(map[string]string, len(current)+len(updates))
+	for k, v := range current {
+		merged[strings.ToLower(k)] = v
+	}
+	for k, v := range updates {
+		if v == "" {
+			delete(merged, strings.ToLower(k))
+		} else {
+			merged[strings.ToLower(k)] = v
+		}
+	}
+	return merged
+}
+
+// cleanFilename validates a slash-separated filename and returns it in canonical form.
+// Filenames may contain subdirectories but must not be absolute or contain "." / ".." segments.
+func cleanFilename(filename string) (string, error) {
+	if filename == "" || strings.ContainsAny(filename, "\x00\\") {
+		return "", ErrInvalidFilename
+	}
+	if strings.HasPrefix(filename, "/") || path.Clean("/"+filename) != "/"+filename {
+		return "", ErrInvalidFilename
+	}
+	return filename, nil
 }
@@ -0,0 +1,581 @@
+package media
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// metaDirName holds JSON sidecars with the content type and metadata of stored files
+const metaDirName = ".meta"
+
+// LocalMediaOptions configures a LocalMedia backend
+type LocalMediaOptions struct {
+	RootDir    string    // Directory files are stored under, one subdirectory per FileType
+	BaseURL    string    // Public URL the handler returned by Handler is mounted at, e.g. https://api.example.com/media
+	SignKey    string    // Key used to sign URLs returned by GetURL
+	CDNDomain  string    // Optional CDN in front of the handler
+	CDNSignKey string    // Key for the generic HMACSigner, used when CDNSigner is nil
+	CDNSigner  CDNSigner // Signer matching the CDN in front of the handler
+
+	MaxUploadSize int64         // Maximum upload size in bytes, 0 for unlimited
+	SessionTTL    time.Duration // Unfinished upload sessions older than this are discarded, 0 for DefaultSessionTTL
+}
+
+// localFileInfo is the sidecar stored next to every uploaded file
+type localFileInfo struct {
+	ContentType string            `json:"content_type"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Size        int64             `json:"size"`
+	UploadedAt  time.Time         `json:"uploaded_at"`
+}
+
+// LocalMedia stores files on the local filesystem and serves them through an HMAC-signed HTTP handler
+type LocalMedia struct {
+	root      string
+	baseURL   *url.URL
+	signKey   string
+	cdnDomain string
+	cdnSigner CDNSigner
+
+	maxUploadSize int64
+	sessionTTL    time.Duration
+	lastSweep     atomic.Int64 // unix nanoseconds of the last expired session sweep
+}
+
+func CreateLocalMedia(opts LocalMediaOptions) (*LocalMedia, error) {
+	if opts.RootDir == "" {
+		return nil, fmt.Errorf("local media root directory not configured")
+	}
+	if opts.SignKey == "" {
+		return nil, fmt.Errorf("local media signing key not configured")
+	}
+
+	root, err := filepath.Abs(opts.RootDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid root directory: %w", err)
+	}
+
+	baseURL, err := url.Parse(opts.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	baseURL.Path = strings.TrimSuffix(baseURL.Path, "/")
+
+	m := &LocalMedia{
+		root:      root,
+		baseURL:   baseURL,
+		signKey:   opts.SignKey,
+		cdnDomain: opts.CDNDomain,
+		cdnSigner: cdnSignerOrDefault(opts.CDNSigner, opts.CDNSignKey),
+
+		maxUploadSize: opts.MaxUploadSize,
+		sessionTTL:    opts.SessionTTL,
+	}
+	if m.sessionTTL <= 0 {
+		m.sessionTTL = DefaultSessionTTL
+	}
+
+	for _, fileType := range []FileType{Image, Video, ""} {
+		if err := os.MkdirAll(filepath.Join(root, m.getDirName(fileType)), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create storage directory: %w", err)
+		}
+	}
+
+	return m, nil
+}
+
+// Ping verifies that the storage root is writable
+func (m *LocalMedia) Ping(ctx context.Context) error {
+	probe, err := os.CreateTemp(m.root, ".tmp-ping-*")
+	if err != nil {
+		return fmt.Errorf("storage root %s is not writable: %w", m.root, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// getDirName returns the directory name based on file type
+func (m *LocalMedia) getDirName(fileType FileType) string {
+	switch fileType {
+	case Image:
+		return "images"
+	case Video:
+		return "videos"
+	default:
+		return "files"
+	}
+}
+
+// resolvePath returns the absolute path of a file, guaranteeing it stays inside its type directory
+func (m *LocalMedia) resolvePath(fileType FileType, filename string) (string, error) {
+	name, err := cleanFilename(filename)
+	if err != nil {
+		return "", err
+	}
+	// Reserved names used for metadata sidecars and in-progress uploads
+	for _, segment := range strings.Split(name, "/") {
+		if segment == metaDirName || strings.HasPrefix(segment, ".tmp-") {
+			return "", ErrInvalidFilename
+		}
+	}
+
+	dir := filepath.Join(m.root, m.getDirName(fileType))
+	full := filepath.Join(dir, filepath.FromSlash(name))
+	if !strings.HasPrefix(full, dir+string(filepath.Separator)) {
+		return "", ErrInvalidFilename
+	}
+
+	return full, nil
+}
+
+// infoPath returns the path of the sidecar for a file
+func (m *LocalMedia) infoPath(fileType FileType, filename string) string {
+	return filepath.Join(m.root, metaDirName, m.getDirName(fileType), filepath.FromSlash(filename)+".json")
+}
+
+func (m *LocalMedia) Upload(ctx context.Context, fileType FileType, filename string, data io.Reader, opts *UploadOptions) (string, error) {
+	target, err := m.resolvePath(fileType, filename)
+	if err != nil {
+		return "", err
+	}
+
+	var metadata map[string]string
+	if opts != nil {
+		metadata = opts.Metadata
+	}
+
+	upload, err := NewUploadReader(&contextReader{ctx: ctx, r: data}, fileType, opts, m.maxUploadSize)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// Write to a temporary file first so readers never observe a partial upload
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, upload)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to upload file: %w", err)
+	}
+	if err := upload.Verify(opts); err != nil {
+		return "", err
+	}
+
+	info := localFileInfo{
+		ContentType: upload.ContentType(),
+		Metadata:    upload.Metadata(metadata),
+		Size:        upload.Size(),
+		UploadedAt:  time.Now().UTC(),
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", fmt.Errorf("failed to upload file: %w", err)
+	}
+	if err := m.writeInfo(fileType, filename, info); err != nil {
+		return "", err
+	}
+
+	// Return the file path/key
+	return fmt.Sprintf("%s/%s", m.getDirName(fileType), filename), nil
+}
+
+func (m *LocalMedia) Download(ctx context.Context, fileType FileType, filename string) (io.ReadCloser, error) {
+	target, err := m.resolvePath(fileType, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(target)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to get object: %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+
+	// Directories hold the files of nested filenames and are not files themselves
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	if stat.IsDir() {
+		file.Close()
+		return nil, fmt.Errorf("failed to get object: %w", ErrNotFound)
+	}
+
+	return file, nil
+}
+
+func (m *LocalMedia) DownloadRange(ctx context.Context, fileType FileType, filename string, offset int64, length int64) (io.ReadCloser, error) {
+	if offset < 0 || length < -1 {
+		return nil, ErrInvalidRange
+	}
+
+	rc, err := m.Download(ctx, fileType, filename)
+	if err != nil {
+		return nil, err
+	}
+	file := rc.(*os.File)
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	if offset > 0 && offset >= stat.Size() {
+		file.Close()
+		return nil, fmt.Errorf("failed to get object: %w", ErrInvalidRange)
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	if length < 0 {
+		return file, nil
+	}
+	return &rangeReadCloser{Reader: io.LimitReader(file, length), Closer: file}, nil
+}
+
+func (m *LocalMedia) Stat(ctx context.Context, fileType FileType, filename string) (*FileInfo, error) {
+	target, err := m.resolvePath(fileType, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(target)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to stat object: %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to stat object: %w", err)
+	}
+
+	info := &FileInfo{
+		Key:          fmt.Sprintf("%s/%s", m.getDirName(fileType), filename),
+		Filename:     filename,
+		Size:         stat.Size(),
+		ContentType:  "application/octet-stream",
+		ETag:         fmt.Sprintf("%x-%x", stat.ModTime().UnixNano(), stat.Size()),
+		Metadata:     map[string]string{},
+		LastModified: stat.ModTime().UTC(),
+	}
+
+	if sidecar, err := m.readInfo(fileType, filename); err == nil {
+		if sidecar.ContentType != "" {
+			info.ContentType = sidecar.ContentType
+		}
+		for k, v := range sidecar.Metadata {
+			info.Metadata[strings.ToLower(k)] = v
+		}
+		if checksum := sidecar.Metadata[MetadataChecksum]; checksum != "" {
+			info.ETag = checksum
+		}
+	}
+
+	return info, nil
+}
+
+func (m *LocalMedia) UpdateMetadata(ctx context.Context, fileType FileType, filename string, metadata map[string]string) error {
+	info, err := m.Stat(ctx, fileType, filename)
+	if err != nil {
+		return err
+	}
+
+	sidecar, err := m.readInfo(fileType, filename)
+	if err != nil {
+		// Files stored without a sidecar get one describing their current state
+		sidecar = &localFileInfo{
+			ContentType: info.ContentType,
+			Size:        info.Size,
+			UploadedAt:  info.LastModified,
+		}
+	}
+	sidecar.Metadata = mergeMetadata(sidecar.Metadata, metadata)
+
+	return m.writeInfo(fileType, filename, *sidecar)
+}
+
+func (m *LocalMedia) GetURL(ctx context.Context, fileType FileType, filename string, expiration time.Duration) (string, error) {
+	if _, err := cleanFilename(filename); err != nil {
+		return "", err
+	}
+
+	fileURL := *m.baseURL
+	fileURL.Path = fmt.Sprintf("%s/%s/%s", m.baseURL.Path, m.getDirName(fileType), filename)
+
+	signedURL, err := generateSignedURL(fileURL.String(), m.signKey, expiration)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate signed URL: %w", err)
+	}
+	return signedURL, nil
+}
+
+func (m *LocalMedia) GetCDNURL(ctx context.Context, fileType FileType, filename string, expiration time.Duration) (string, error) {
+	if m.cdnDomain == "" {
+		return "", fmt.Errorf("CDN URL not configured")
+	}
+
+	if m.cdnSigner == nil {
+		return "", fmt.Errorf("CDN signing key not configured")
+	}
+
+	if _, err := cleanFilename(filename); err != nil {
+		return "", err
+	}
+
+	// Parse CDN URL and append the file path
+	cdnURL, err := url.Parse(m.cdnDomain)
+	if err != nil {
+		return "", fmt.Errorf("invalid CDN URL: %w", err)
+	}
+
+	// Construct the full CDN URL path
+	cdnURL.Path = fmt.Sprintf("/%s/%s", m.getDirName(fileType), filename)
+
+	signedURL, err := m.cdnSigner.SignURL(cdnURL.String(), expiration)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate CDN signed URL: %w", err)
+	}
+
+	return signedURL, nil
+}
+
+func (m *LocalMedia) Delete(ctx context.Context, fileType FileType, filename string) error {
+	target, err := m.resolvePath(fileType, filename)
+	if err != nil {
+		return err
+	}
+
+	// Deleting a missing file is not an error, matching object storage semantics
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	if err := os.Remove(m.infoPath(fileType, filename)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete object metadata: %w", err)
+	}
+
+	return nil
+}
+
+func (m *LocalMedia) List(ctx context.Context, fileType FileType, prefix string, cursor string, limit int) (*ListPage, error) {
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+
+	// Directory walks are not in full-path order, so collect and sort the names before paging
+	dir := filepath.Join(m.root, m.getDirName(fileType))
+	var filenames []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dir && errors.Is(err, fs.ErrNotExist) {
+				// Nothing has been uploaded for this file type yet
+				return fs.SkipAll
+			}
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".tmp-") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return ctx.Err()
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		filename := filepath.ToSlash(rel)
+		if strings.HasPrefix(filename, prefix) && filename > cursor {
+			filenames = append(filenames, filename)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	sort.Strings(filenames)
+
+	page := &ListPage{}
+	if len(filenames) > limit {
+		filenames = filenames[:limit]
+		page.NextCursor = filenames[limit-1]
+	}
+
+	for _, filename := range filenames {
+		info, err := m.Stat(ctx, fileType, filename)
+		if errors.Is(err, ErrNotFound) {
+			// Deleted while listing
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		page.Files = append(page.Files, *info)
+	}
+
+	return page, nil
+}
+
+func (m *LocalMedia) DeleteMany(ctx context.Context, fileType FileType, filenames []string) error {
+	failed := DeleteErrors{}
+	for _, filename := range filenames {
+		if err := m.Delete(ctx, fileType, filename); err != nil {
+			failed[filename] = err
+		}
+	}
+
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// Handler returns an http.Handler serving files at the URLs produced by GetURL and accepting
+// form uploads produced by GetUploadURL.
+// Mount it at the path of BaseURL without stripping the prefix, since the signature covers the full path.
+func (m *LocalMedia) Handler() http.Handler {
+	return http.HandlerFunc(m.serveHTTP)
+}
+
+func (m *LocalMedia) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Form uploads carry a signed policy in the body instead of a signed URL
+	if r.Method != http.MethodPost {
+		if err := verifySignedURL(r.URL, m.signKey, time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	relative, ok := strings.CutPrefix(r.URL.Path, m.baseURL.Path+"/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	dir, filename, ok := strings.Cut(relative, "/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	fileType, ok := fileTypeFromDirName(dir)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	target, err := m.resolvePath(fileType, filename)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		m.serveUpload(w, r, fileType, filename)
+		return
+	}
+
+	file, err := os.Open(target)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil || stat.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	contentType := ""
+	if info, err := m.readInfo(fileType, filename); err == nil {
+		contentType = info.ContentType
+	}
+	setContentHeaders(w.Header(), contentType)
+
+	http.ServeContent(w, r, stat.Name(), stat.ModTime(), file)
+}
+
+func (m *LocalMedia) writeInfo(fileType FileType, filename string, info localFileInfo) error {
+	infoPath := m.infoPath(fileType, filename)
+	if err := os.MkdirAll(filepath.Dir(infoPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create metadata directory: %w", err)
+	}
+
+	encoded, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	if err := os.WriteFile(infoPath, encoded, 0o644); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+
+	return nil
+}
+
+func (m *LocalMedia) readInfo(fileType FileType, filename string) (*localFileInfo, error) {
+	encoded, err := os.ReadFile(m.infoPath(fileType, filename))
+	if err != nil {
+		return nil, err
+	}
+
+	var info localFileInfo
+	if err := json.Unmarshal(encoded, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// rangeReadCloser closes the underlying file or object of a range or decrypting reader
+type rangeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// contextReader stops reading once ctx is cancelled
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,236 @@
+package media
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// localUploadPolicy is the signed policy carried by a presigned form upload to the local handler
+type localUploadPolicy struct {
+	Path         string   `json:"path"`
+	Expires      int64    `json:"expires"`
+	MinSize      int64    `json:"min_size"`
+	MaxSize      int64    `json:"max_size"`
+	ContentTypes []string `json:"content_types,omitempty"`
+	TypePrefix   string   `json:"type_prefix,omitempty"`
+}
+
+func (m *LocalMedia) GetUploadURL(ctx context.Context, fileType FileType, filename string, constraints UploadConstraints) (*PresignedUpload, error) {
+	if _, err := m.resolvePath(fileType, filename); err != nil {
+		return nil, err
+	}
+
+	uploadURL := *m.baseURL
+	uploadURL.Path = fmt.Sprintf("%s/%s/%s", m.baseURL.Path, m.getDirName(fileType), filename)
+
+	expiresAt := constraints.ExpiresAt(time.Now())
+	policy := localUploadPolicy{
+		Path:         uploadURL.Path,
+		Expires:      expiresAt.Unix(),
+		MinSize:      constraints.MinSize,
+		MaxSize:      constraints.maxSize(m.maxUploadSize),
+		ContentTypes: constraints.ContentTypes,
+		TypePrefix:   contentTypePrefix(fileType),
+	}
+	encoded, err := json.Marshal(policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode upload policy: %w", err)
+	}
+	encodedPolicy := base64.RawURLEncoding.EncodeToString(encoded)
+
+	fields := map[string]string{
+		"policy":    encodedPolicy,
+		"signature": signPolicy(m.signKey, encodedPolicy),
+	}
+	if contentType, ok := constraints.singleContentType(); ok {
+		fields["Content-Type"] = contentType
+	} else {
+		fields["Content-Type"] = policy.TypePrefix
+	}
+
+	return &PresignedUpload{
+		Method:    "POST",
+		URL:       uploadURL.String(),
+		Fields:    fields,
+		Key:       fmt.Sprintf("%s/%s", m.getDirName(fileType), filename),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (m *LocalMedia) VerifyUpload(ctx context.Context, fileType FileType, filename string, constraints UploadConstraints) (*UploadedFile, error) {
+	target, err := m.resolvePath(fileType, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(target)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to verify upload: %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to verify upload: %w", err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify upload: %w", err)
+	}
+
+	declared := ""
+	if info, err := m.readInfo(fileType, filename); err == nil {
+		declared = info.ContentType
+	}
+
+	contentType, err := CheckUploaded(fileType, constraints, m.maxUploadSize, stat.Size(), declared, file)
+	if err != nil {
+		// Rejected uploads are removed so they can never be served
+		if removeErr := m.Delete(ctx, fileType, filename); removeErr != nil {
+			return nil, fmt.Errorf("%w (failed to delete rejected upload: %v)", err, removeErr)
+		}
+		return nil, err
+	}
+
+	return &UploadedFile{
+		Key:         fmt.Sprintf("%s/%s", m.getDirName(fileType), filename),
+		Size:        stat.Size(),
+		ContentType: contentType,
+	}, nil
+}
+
+// serveUpload accepts a presigned form upload produced by GetUploadURL
+func (m *LocalMedia) serveUpload(w http.ResponseWriter, r *http.Request, fileType FileType, filename string) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "expected multipart/form-data", http.StatusBadRequest)
+		return
+	}
+
+	// Form fields precede the file, as with S3 POST uploads
+	fields := make(map[string]string)
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			http.Error(w, "missing file field", http.StatusBadRequest)
+			return
+		}
+		if part.FormName() != "file" {
+			value, err := io.ReadAll(io.LimitReader(part, 64*1024))
+			if err != nil {
+				http.Error(w, "invalid form field", http.StatusBadRequest)
+				return
+			}
+			fields[part.FormName()] = string(value)
+			continue
+		}
+
+		policy, err := m.verifyUploadPolicy(fields, r.URL.Path, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		contentType := fields["Content-Type"]
+		if contentType == "" {
+			contentType = part.Header.Get("Content-Type")
+		}
+		if !policy.allowsContentType(contentType) {
+			http.Error(w, ErrContentMismatch.Error(), http.StatusForbidden)
+			return
+		}
+
+		// The size limits are enforced while Upload writes its temporary file, so a rejected
+		// upload never replaces the stored file
+		counter := &countingReader{r: part, min: policy.MinSize, max: policy.MaxSize}
+		if _, err := m.Upload(r.Context(), fileType, filename, counter, &UploadOptions{ContentType: contentType}); err != nil {
+			writeUploadError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+}
+
+// verifyUploadPolicy checks the signature, expiry and path of a presigned form upload
+func (m *LocalMedia) verifyUploadPolicy(fields map[string]string, path string, now time.Time) (*localUploadPolicy, error) {
+	encodedPolicy, signature := fields["policy"], fields["signature"]
+	if encodedPolicy == "" || signature == "" {
+		return nil, ErrSignatureMissing
+	}
+	if !hmac.Equal([]byte(signPolicy(m.signKey, encodedPolicy)), []byte(signature)) {
+		return nil, ErrSignatureInvalid
+	}
+
+	encoded, err := base64.RawURLEncoding.DecodeString(encodedPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed policy", ErrSignatureInvalid)
+	}
+	var policy localUploadPolicy
+	if err := json.Unmarshal(encoded, &policy); err != nil {
+		return nil, fmt.Errorf("%w: malformed policy", ErrSignatureInvalid)
+	}
+
+	if now.Unix() > policy.Expires {
+		return nil, ErrSignatureExpired
+	}
+	if policy.Path != path {
+		return nil, fmt.Errorf("%w: policy is for another file", ErrSignatureInvalid)
+	}
+
+	return &policy, nil
+}
+
+// allowsContentType applies the same content type rules as the S3 form policy
+func (p *localUploadPolicy) allowsContentType(contentType string) bool {
+	if len(p.ContentTypes) > 0 {
+		return UploadConstraints{ContentTypes: p.ContentTypes}.allowsContentType(contentType)
+	}
+	return strings.HasPrefix(contentType, p.TypePrefix)
+}
+
+// countingReader counts the bytes read, failing with ErrTooLarge past max and with ErrTooSmall
+// when the stream ends before min
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	min int64
+	max int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if c.max > 0 && c.n > c.max {
+		return 0, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, c.max)
+	}
+	if errors.Is(err, io.EOF) && c.n < c.min {
+		return n, fmt.Errorf("%w: %d of at least %d bytes", ErrTooSmall, c.n, c.min)
+	}
+	return n, err
+}
+
+// writeUploadError maps upload errors to HTTP status codes
+func writeUploadError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, ErrTooSmall):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrContentMismatch):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	case errors.Is(err, ErrInvalidFilename):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,356 @@
+package media
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weiawesome/wesio-live/libs/logger"
+)
+
+// uploadsDirName holds in-progress upload sessions, one directory per session
+const uploadsDirName = ".uploads"
+
+// sessionSweepInterval is how often InitiateUpload triggers a sweep of expired sessions
+const sessionSweepInterval = time.Hour
+
+// localSession is the state file stored in every session directory
+type localSession struct {
+	FileType    FileType          `json:"file_type"`
+	Filename    string            `json:"filename"`
+	ContentType string            `json:"content_type,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Size        int64             `json:"size"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// sessionDir returns the directory of a session, rejecting identifiers not produced by newSessionID
+func (m *LocalMedia) sessionDir(sessionID string) (string, error) {
+	if len(sessionID) != 32 {
+		return "", ErrSessionNotFound
+	}
+	if _, err := hex.DecodeString(sessionID); err != nil {
+		return "", ErrSessionNotFound
+	}
+	return filepath.Join(m.root, uploadsDirName, sessionID), nil
+}
+
+func (m *LocalMedia) readSession(sessionID string) (string, *localSession, error) {
+	dir, err := m.sessionDir(sessionID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	encoded, err := os.ReadFile(filepath.Join(dir, "session.json"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil, ErrSessionNotFound
+		}
+		return "", nil, fmt.Errorf("failed to read upload session: %w", err)
+	}
+
+	var session localSession
+	if err := json.Unmarshal(encoded, &session); err != nil {
+		return "", nil, fmt.Errorf("failed to decode upload session: %w", err)
+	}
+	if m.sessionExpired(session.CreatedAt, time.Now()) {
+		os.RemoveAll(dir)
+		return "", nil, ErrSessionNotFound
+	}
+	return dir, &session, nil
+}
+
+func (m *LocalMedia) sessionExpired(createdAt time.Time, now time.Time) bool {
+	return now.Sub(createdAt) > m.sessionTTL
+}
+
+// ExpireSessions removes upload sessions older than the session TTL, with their parts, and returns
+// how many were removed. InitiateUpload runs it in the background at most once per hour.
+func (m *LocalMedia) ExpireSessions(ctx context.Context) (int, error) {
+	root := filepath.Join(m.root, uploadsDirName)
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to list upload sessions: %w", err)
+	}
+
+	removed := 0
+	now := time.Now()
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+		if !entry.IsDir() {
+			continue
+		}
+
+		dir := filepath.Join(root, entry.Name())
+		createdAt, err := localSessionCreatedAt(dir, entry)
+		if err != nil {
+			return removed, err
+		}
+		if !m.sessionExpired(createdAt, now) {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return removed, fmt.Errorf("failed to remove upload session: %w", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// localSessionCreatedAt returns when a session was created, falling back to the directory's
+// modification time when its state file is missing or unreadable
+func localSessionCreatedAt(dir string, entry fs.DirEntry) (time.Time, error) {
+	if encoded, err := os.ReadFile(filepath.Join(dir, "session.json")); err == nil {
+		var session localSession
+		if json.Unmarshal(encoded, &session) == nil {
+			return session.CreatedAt, nil
+		}
+	}
+	info, err := entry.Info()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to inspect upload session: %w", err)
+	}
+	return info.ModTime(), nil
+}
+
+// sweepSessions starts a background ExpireSessions unless one ran within sessionSweepInterval
+func (m *LocalMedia) sweepSessions() {
+	now := time.Now()
+	last := m.lastSweep.Load()
+	if now.Sub(time.Unix(0, last)) < sessionSweepInterval || !m.lastSweep.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+
+	go func() {
+		removed, err := m.ExpireSessions(context.Background())
+		if err != nil {
+			logger.Error("media", "expire_sessions", "failed to expire upload sessions", err, nil)
+			return
+		}
+		if removed > 0 {
+			logger.Info("media", "expire_sessions", "expired upload sessions", map[string]interface{}{
+				"removed": removed,
+			})
+		}
+	}()
+}
+
+func (s *localSession) toUploadSession(sessionID string) *UploadSession {
+	return &UploadSession{
+		ID:          sessionID,
+		FileType:    s.FileType,
+		Filename:    s.Filename,
+		ContentType: s.ContentType,
+		Size:        s.Size,
+		CreatedAt:   s.CreatedAt,
+	}
+}
+
+func (m *LocalMedia) InitiateUpload(ctx context.Context, fileType FileType, filename string, size int64, opts *UploadOptions) (*UploadSession, error) {
+	if _, err := m.resolvePath(fileType, filename); err != nil {
+		return nil, err
+	}
+	if m.maxUploadSize > 0 && size > m.maxUploadSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrTooLarge, size)
+	}
+	if size < 0 {
+		size = -1
+	}
+	m.sweepSessions()
+
+	sessionID, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := m.sessionDir(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	session := localSession{
+		FileType:  fileType,
+		Filename:  filename,
+		Size:      size,
+		CreatedAt: time.Now().UTC(),
+	}
+	if opts != nil {
+		session.ContentType = opts.ContentType
+		session.Metadata = opts.Metadata
+	}
+
+	encoded, err := json.Marshal(session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode upload session: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create upload session: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "session.json"), encoded, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to create upload session: %w", err)
+	}
+
+	return session.toUploadSession(sessionID), nil
+}
+
+func (m *LocalMedia) GetUploadSession(ctx context.Context, sessionID string) (*UploadSession, error) {
+	_, session, err := m.readSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return session.toUploadSession(sessionID), nil
+}
+
+func (m *LocalMedia) UploadPart(ctx context.Context, sessionID string, partNumber int, data io.Reader, size int64) (*UploadPart, error) {
+	if err := validatePartNumber(partNumber); err != nil {
+		return nil, err
+	}
+	dir, session, err := m.readSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := sniffFirstPart(session.toUploadSession(sessionID), partNumber, partReader(&contextReader{ctx: ctx, r: data}, size))
+	if err != nil {
+		return nil, err
+	}
+	if m.maxUploadSize > 0 {
+		reader = io.LimitReader(reader, m.maxUploadSize+1)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload part: %w", err)
+	}
+	if m.maxUploadSize > 0 && written > m.maxUploadSize {
+		return nil, fmt.Errorf("%w: part %d exceeds %d bytes", ErrTooLarge, partNumber, m.maxUploadSize)
+	}
+
+	partPath := filepath.Join(dir, fmt.Sprintf("%05d.part", partNumber))
+	if err := os.Rename(tmp.Name(), partPath); err != nil {
+		return nil, fmt.Errorf("failed to upload part: %w", err)
+	}
+
+	stat, err := os.Stat(partPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload part: %w", err)
+	}
+	part := localPart(partNumber, stat)
+	return &part, nil
+}
+
+// localPart describes a stored part; the ETag changes whenever the part is replaced
+func localPart(partNumber int, stat fs.FileInfo) UploadPart {
+	return UploadPart{
+		Number: partNumber,
+		Size:   stat.Size(),
+		ETag:   fmt.Sprintf("%x-%x", stat.ModTime().UnixNano(), stat.Size()),
+	}
+}
+
+func (m *LocalMedia) ListParts(ctx context.Context, sessionID string) ([]UploadPart, error) {
+	dir, _, err := m.readSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return m.listParts(dir)
+}
+
+func (m *LocalMedia) listParts(dir string) ([]UploadPart, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list parts: %w", err)
+	}
+
+	parts := []UploadPart{}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".part")
+		if !ok {
+			continue
+		}
+		partNumber, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		stat, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list parts: %w", err)
+		}
+		parts = append(parts, localPart(partNumber, stat))
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Number < parts[j].Number })
+	return parts, nil
+}
+
+func (m *LocalMedia) CompleteUpload(ctx context.Context, sessionID string) (string, error) {
+	dir, session, err := m.readSession(sessionID)
+	if err != nil {
+		return "", err
+	}
+	parts, err := m.listParts(dir)
+	if err != nil {
+		return "", err
+	}
+	if _, err := checkParts(parts, session.Size, m.maxUploadSize); err != nil {
+		return "", err
+	}
+
+	readers := make([]io.Reader, 0, len(parts))
+	for _, part := range parts {
+		file, err := os.Open(filepath.Join(dir, fmt.Sprintf("%05d.part", part.Number)))
+		if err != nil {
+			return "", fmt.Errorf("failed to open part %d: %w", part.Number, err)
+		}
+		defer file.Close()
+		readers = append(readers, file)
+	}
+
+	// Upload assembles the parts atomically and records the size and checksum
+	key, err := m.Upload(ctx, session.FileType, session.Filename, io.MultiReader(readers...), &UploadOptions{
+		ContentType: session.ContentType,
+		Metadata:    session.Metadata,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return "", fmt.Errorf("failed to remove upload session: %w", err)
+	}
+	return key, nil
+}
+
+func (m *LocalMedia) AbortUpload(ctx context.Context, sessionID string) error {
+	dir, _, err := m.readSession(sessionID)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to abort upload session: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package media_test
+
+import (
+	"testing"
+
+	"github.com/weiawesome/wesio-live/storage/media"
+	"github.com/weiawesome/wesio-live/storage/media/mediatest"
+)
+
+func TestLocalMediaConformance(t *testing.T) {
+	mediatest.Run(t, func(t *testing.T) media.Media {
+		m, err := media.CreateLocalMedia(media.LocalMediaOptions{
+			RootDir: t.TempDir(),
+			BaseURL: "http://localhost:8080/media",
+			SignKey: "local-media-test-key",
+		})
+		if err != nil {
+			t.Fatalf("failed to create local media: %v", err)
+		}
+		return m
+	})
+}
@@ -2,124 +2,562 @@ package media
 
 import (
 	"context"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
-	"strconv"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/weiawesome/wesio-live/libs/logger"
 )
 
 type MinIOMedia struct {
-	minioClient *minio.Client
-	cdnDomain   string
-	cdnSignKey  string // CDN signing key for generating signed URLs
-	domain      string
-	secure      bool // true for https, false for http
+	minioClient  *minio.Client
+	cdnDomain    string
+	cdnSigner    CDNSigner // nil when CDN URLs are not configured
+	domain       string
+	secure       bool // true for https, false for http
+	layout       BucketLayout
+	provisioning BucketProvisioning
+	encryption   *objectEncryption
+	signKey      string // signs upload session IDs
+
+	maxUploadSize int64
+
+	readyBuckets sync.Map // buckets already verified or created
 }
 
-func CreateMinIOMedia(ctx context.Context, cdnDomain string, cdnSignKey string, domain string, accessKey string, secretKey string, secure bool) *MinIOMedia {
-	minioClient, err := minio.New(domain, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-		Secure: secure,
+// BucketProvisioning controls how missing buckets are created.
+// With AutoCreate the policy and lifecycle rules are applied to every bucket of the layout once per
+// process, including buckets that already exist, so a bucket left half provisioned by a failed call
+// is completed. Leave AutoCreate off for buckets shared with other environments.
+type BucketProvisioning struct {
+	AutoCreate bool
+	Region     string
+	Policy     string           // private, public-read
+	ExpireDays map[FileType]int // Lifecycle expiration per file type, 0 to keep forever
+}
+
+// MinIOMediaOptions configures a MinIOMedia backend
+type MinIOMediaOptions struct {
+	Endpoint     string
+	AccessKey    string
+	SecretKey    string
+	Secure       bool
+	CDNDomain    string
+	CDNSignKey   string    // Key for the generic HMACSigner, used when CDNSigner is nil
+	CDNSigner    CDNSigner // Signer matching the CDN in front of the buckets
+	Layout       BucketLayout
+	Provisioning BucketProvisioning
+	Encryption   EncryptionOptions
+	SignKey      string // Key signing upload session IDs, defaults to SecretKey
+
+	MaxUploadSize int64 // Maximum upload size in bytes, 0 for DefaultMaxUploadSize since uploads may be spooled to disk
+}
+
+// DefaultMaxUploadSize bounds MinIO uploads when no maximum upload size is configured
+const DefaultMaxUploadSize = 100 << 20
+
+func CreateMinIOMedia(ctx context.Context, cdnDomain string, cdnSignKey string, domain string, accessKey string, secretKey string, secure bool) (*MinIOMedia, error) {
+	return CreateMinIOMediaWithOptions(ctx, MinIOMediaOptions{
+		Endpoint:   domain,
+		AccessKey:  accessKey,
+		SecretKey:  secretKey,
+		Secure:     secure,
+		CDNDomain:  cdnDomain,
+		CDNSignKey: cdnSignKey,
+		Layout:     DefaultBucketLayout(),
+	})
+}
+
+func CreateMinIOMediaWithOptions(ctx context.Context, opts MinIOMediaOptions) (*MinIOMedia, error) {
+	minioClient, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, ""),
+		Secure: opts.Secure,
+		Region: opts.Provisioning.Region,
 	})
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("failed to create MinIO client: %w", err)
 	}
 
-	return &MinIOMedia{
-		minioClient: minioClient,
-		cdnDomain:   cdnDomain,
-		cdnSignKey:  cdnSignKey,
-		domain:      domain,
-		secure:      secure,
+	layout := opts.Layout
+	if layout.Mode == "" {
+		layout = DefaultBucketLayout()
+	}
+
+	encryption, err := newObjectEncryption(opts.Encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	signKey := opts.SignKey
+	if signKey == "" {
+		signKey = opts.SecretKey
+	}
+
+	maxUploadSize := opts.MaxUploadSize
+	if maxUploadSize <= 0 {
+		maxUploadSize = DefaultMaxUploadSize
 	}
+
+	return &MinIOMedia{
+		minioClient:  minioClient,
+		cdnDomain:    opts.CDNDomain,
+		cdnSigner:    cdnSignerOrDefault(opts.CDNSigner, opts.CDNSignKey),
+		domain:       opts.Endpoint,
+		secure:       opts.Secure,
+		layout:       layout,
+		provisioning: opts.Provisioning,
+		encryption:   encryption,
+		signKey:      signKey,
+
+		maxUploadSize: maxUploadSize,
+	}, nil
 }
 
-// getBucketName returns the bucket name based on file type
-func (m *MinIOMedia) getBucketName(fileType FileType) string {
-	switch fileType {
-	case Image:
-		return "images"
-	case Video:
-		return "videos"
-	default:
-		return "files"
+// Ping verifies connectivity and credentials by checking (or provisioning) every bucket of the layout
+func (m *MinIOMedia) Ping(ctx context.Context) error {
+	for _, bucketName := range m.layout.BucketNames() {
+		if err := m.ensureBucketExists(ctx, bucketName); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-// ensureBucketExists creates bucket if it doesn't exist and sets public read policy
+// ensureBucketExists checks the bucket exists, creating it when auto-provisioning is enabled.
+// A bucket is only marked ready once every provisioning step succeeded, so a partially
+// provisioned bucket gets its policy and lifecycle applied again on the next call.
 func (m *MinIOMedia) ensureBucketExists(ctx context.Context, bucketName string) error {
+	if _, ok := m.readyBuckets.Load(bucketName); ok {
+		return nil
+	}
+
 	exists, err := m.minioClient.BucketExists(ctx, bucketName)
 	if err != nil {
 		return fmt.Errorf("failed to check bucket existence: %w", err)
 	}
 
-	if !exists {
+	if !exists && !m.provisioning.AutoCreate {
 		return fmt.Errorf("bucket %s does not exist", bucketName)
 	}
+	if m.provisioning.AutoCreate {
+		if err := m.provisionBucket(ctx, bucketName, exists); err != nil {
+			return err
+		}
+	}
+
+	m.readyBuckets.Store(bucketName, true)
+	return nil
+}
+
+// provisionBucket creates the bucket unless it exists and applies the configured access policy and lifecycle rules
+func (m *MinIOMedia) provisionBucket(ctx context.Context, bucketName string, exists bool) error {
+	if !exists {
+		err := m.minioClient.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{Region: m.provisioning.Region})
+		if err != nil {
+			// Another instance may have created it concurrently
+			code := minio.ToErrorResponse(err).Code
+			if code != "BucketAlreadyOwnedByYou" && code != "BucketAlreadyExists" {
+				return fmt.Errorf("failed to create bucket: %w", err)
+			}
+		}
+	}
+
+	fileTypes := m.fileTypesInBucket(bucketName)
 
-	// if !exists {
-	// 	err = m.minioClient.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{})
-	// 	if err != nil {
-	// 		return fmt.Errorf("failed to create bucket: %w", err)
-	// 	}
-	// }
+	if m.provisioning.Policy == "public-read" {
+		if err := m.minioClient.SetBucketPolicy(ctx, bucketName, publicReadPolicy(bucketName, m.layout, fileTypes)); err != nil {
+			return fmt.Errorf("failed to set bucket policy: %w", err)
+		}
+	}
+
+	config := lifecycle.NewConfiguration()
+	for _, fileType := range fileTypes {
+		days := m.provisioning.ExpireDays[fileType]
+		if days <= 0 {
+			continue
+		}
+		config.Rules = append(config.Rules, lifecycle.Rule{
+			ID:         "expire-" + typeDirName(fileType),
+			Status:     "Enabled",
+			RuleFilter: lifecycle.Filter{Prefix: m.layout.KeyPrefix(fileType)},
+			Expiration: lifecycle.Expiration{Days: lifecycle.ExpirationDays(days)},
+		})
+	}
+	if len(config.Rules) > 0 {
+		if err := m.minioClient.SetBucketLifecycle(ctx, bucketName, config); err != nil {
+			return fmt.Errorf("failed to set bucket lifecycle: %w", err)
+		}
+	}
 
 	return nil
 }
 
+// fileTypesInBucket returns the file types the layout stores in a bucket
+func (m *MinIOMedia) fileTypesInBucket(bucketName string) []FileType {
+	var fileTypes []FileType
+	for _, fileType := range []FileType{Image, Video, ""} {
+		if m.layout.BucketFor(fileType) == bucketName {
+			fileTypes = append(fileTypes, fileType)
+		}
+	}
+	return fileTypes
+}
+
+// publicReadPolicy returns a bucket policy allowing anonymous reads of the layout's prefixes
+func publicReadPolicy(bucketName string, layout BucketLayout, fileTypes []FileType) string {
+	resources := make([]string, 0, len(fileTypes))
+	for _, fileType := range fileTypes {
+		resources = append(resources, fmt.Sprintf("%q", "arn:aws:s3:::"+bucketName+"/"+layout.KeyPrefix(fileType)+"*"))
+	}
+
+	return fmt.Sprintf(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":["*"]},"Action":["s3:GetObject"],"Resource":[%s]}]}`,
+		strings.Join(resources, ","))
+}
+
 func (m *MinIOMedia) Upload(ctx context.Context, fileType FileType, filename string, data io.Reader, opts *UploadOptions) (string, error) {
-	bucketName := m.getBucketName(fileType)
+	if _, err := cleanFilename(filename); err != nil {
+		return "", err
+	}
+
+	bucketName, objectName := m.layout.Location(fileType, filename)
 
 	// Ensure bucket exists
 	if err := m.ensureBucketExists(ctx, bucketName); err != nil {
 		return "", err
 	}
 
+	var metadata map[string]string
+	if opts != nil {
+		metadata = opts.Metadata
+	}
+
+	upload, err := NewUploadReader(&contextReader{ctx: ctx, r: data}, fileType, opts, m.maxUploadSize)
+	if err != nil {
+		return "", err
+	}
+
+	var body io.Reader
+	var size int64
+	var userMetadata map[string]string
+	if declaresContent(opts) {
+		// The size and checksum are declared, so the object metadata can be sent before the data is read
+		if opts.Size > m.maxUploadSize {
+			return "", fmt.Errorf("%w: more than %d bytes", ErrTooLarge, m.maxUploadSize)
+		}
+		body, size = upload, opts.Size
+		userMetadata = uploadMetadata(metadata, opts.Size, opts.Checksum)
+	} else {
+		// Spool to disk first: the size and checksum must be known before the object metadata is sent.
+		// The upload reader stops the spool at the maximum upload size.
+		spool, err := os.CreateTemp("", "wesio-upload-*")
+		if err != nil {
+			return "", fmt.Errorf("failed to create temporary file: %w", err)
+		}
+		defer func() {
+			spool.Close()
+			os.Remove(spool.Name())
+		}()
+
+		if _, err := io.Copy(spool, upload); err != nil {
+			return "", fmt.Errorf("failed to upload file: %w", err)
+		}
+		if err := upload.Verify(opts); err != nil {
+			return "", err
+		}
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			return "", fmt.Errorf("failed to upload file: %w", err)
+		}
+		body, size = spool, upload.Size()
+		userMetadata = upload.Metadata(metadata)
+	}
+
 	// Set up put object options
-	putOpts := minio.PutObjectOptions{}
+	putOpts := minio.PutObjectOptions{
+		ContentType:          upload.ContentType(),
+		UserMetadata:         userMetadata,
+		ServerSideEncryption: m.encryption.serverSide(bucketName, objectName),
+	}
 
-	if opts != nil {
-		if opts.ContentType != "" {
-			putOpts.ContentType = opts.ContentType
+	if m.encryption.clientSide() {
+		sealed, sealedSize, encryptionMetadata, err := m.encryption.seal(body, size)
+		if err != nil {
+			return "", err
 		}
-		if opts.Metadata != nil {
-			putOpts.UserMetadata = opts.Metadata
+		for k, v := range encryptionMetadata {
+			putOpts.UserMetadata[k] = v
 		}
+		body, size = sealed, sealedSize
 	}
 
 	// Upload the object
-	_, err := m.minioClient.PutObject(ctx, bucketName, filename, data, -1, putOpts)
-	if err != nil {
+	if _, err := m.minioClient.PutObject(ctx, bucketName, objectName, body, size, putOpts); err != nil {
 		return "", fmt.Errorf("failed to upload file: %w", err)
 	}
 
+	// A streamed upload is only checked once it is stored, so content not matching its declaration is removed
+	if err := upload.Verify(opts); err != nil {
+		if removeErr := m.minioClient.RemoveObject(ctx, bucketName, objectName, minio.RemoveObjectOptions{}); removeErr != nil {
+			logger.Error("media", "upload", "failed to remove mismatched upload", removeErr, map[string]interface{}{
+				"bucket": bucketName,
+				"object": objectName,
+			})
+		}
+		return "", err
+	}
+
 	// Return the file path/key
-	return fmt.Sprintf("%s/%s", bucketName, filename), nil
+	return fmt.Sprintf("%s/%s", bucketName, objectName), nil
 }
 
 func (m *MinIOMedia) Download(ctx context.Context, fileType FileType, filename string) (io.ReadCloser, error) {
-	bucketName := m.getBucketName(fileType)
+	if _, err := cleanFilename(filename); err != nil {
+		return nil, err
+	}
 
-	object, err := m.minioClient.GetObject(ctx, bucketName, filename, minio.GetObjectOptions{})
+	bucketName, objectName := m.layout.Location(fileType, filename)
+
+	var (
+		object *minio.Object
+		info   minio.ObjectInfo
+	)
+	err := m.withSSECKeys(bucketName, objectName, func(sse encrypt.ServerSide) error {
+		var err error
+		object, err = m.minioClient.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{
+			ServerSideEncryption: sse,
+		})
+		if err != nil {
+			return err
+		}
+
+		// GetObject is lazy; stat the object so a missing file fails here instead of on the first Read
+		if info, err = object.Stat(); err != nil {
+			object.Close()
+			return err
+		}
+		return nil
+	})
 	if err != nil {
+		if isMinIONotFound(err) {
+			return nil, fmt.Errorf("failed to get object: %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+
+	metadata := lowerMetadata(info.UserMetadata)
+	if !isEnveloped(metadata) {
+		return object, nil
+	}
+	size, err := plaintextSize(metadata)
+	if err != nil {
+		object.Close()
+		return nil, err
+	}
+	plaintext, err := m.encryption.open(metadata, object, 0, size)
+	if err != nil {
+		object.Close()
+		return nil, err
+	}
+	return &rangeReadCloser{Reader: plaintext, Closer: object}, nil
+}
+
+func (m *MinIOMedia) DownloadRange(ctx context.Context, fileType FileType, filename string, offset int64, length int64) (io.ReadCloser, error) {
+	if _, err := cleanFilename(filename); err != nil {
+		return nil, err
+	}
+	if offset < 0 || length < -1 {
+		return nil, ErrInvalidRange
+	}
+	if length == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+
+	bucketName, objectName := m.layout.Location(fileType, filename)
+	if m.encryption.clientSide() {
+		info, err := m.Stat(ctx, fileType, filename)
+		if err != nil {
+			return nil, err
+		}
+		// Objects stored before envelope encryption was enabled are read as they are
+		if isEnveloped(info.Metadata) {
+			return m.downloadEnvelopeRange(ctx, bucketName, objectName, info, offset, length)
+		}
+	}
+
+	getOpts := minio.GetObjectOptions{}
+	if offset > 0 || length > 0 {
+		end := int64(0) // 0 reads to the end of the object
+		if length > 0 {
+			end = offset + length - 1
+		}
+		if err := getOpts.SetRange(offset, end); err != nil {
+			return nil, fmt.Errorf("failed to get object: %w", ErrInvalidRange)
+		}
+	}
+
+	// Core.GetObject sends the request at once, so a missing file or bad range fails here instead of on
+	// the first Read. Stat on a lazy minio.Object would make its reads ignore the range.
+	core := minio.Core{Client: m.minioClient}
+	var object io.ReadCloser
+	err := m.withSSECKeys(bucketName, objectName, func(sse encrypt.ServerSide) error {
+		getOpts.ServerSideEncryption = sse
+		var err error
+		object, _, _, err = core.GetObject(ctx, bucketName, objectName, getOpts)
+		return err
+	})
+	if err != nil {
+		switch {
+		case isMinIONotFound(err):
+			return nil, fmt.Errorf("failed to get object: %w", ErrNotFound)
+		case minio.ToErrorResponse(err).Code == minio.InvalidRange:
+			return nil, fmt.Errorf("failed to get object: %w", ErrInvalidRange)
+		}
 		return nil, fmt.Errorf("failed to get object: %w", err)
 	}
 
 	return object, nil
 }
 
+// downloadEnvelopeRange decrypts a range of an envelope encrypted object, fetching only the chunks holding it
+func (m *MinIOMedia) downloadEnvelopeRange(ctx context.Context, bucketName string, objectName string, info *FileInfo, offset int64, length int64) (io.ReadCloser, error) {
+	if offset > 0 && offset >= info.Size {
+		return nil, fmt.Errorf("failed to get object: %w", ErrInvalidRange)
+	}
+	r := newEnvelopeRange(offset, length, info.Size)
+	getOpts := minio.GetObjectOptions{}
+	if err := getOpts.SetRange(r.start, r.end); err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", ErrInvalidRange)
+	}
+
+	object, err := m.minioClient.GetObject(ctx, bucketName, objectName, getOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	plaintext, err := m.encryption.open(info.Metadata, object, r.firstChunk, info.Size)
+	if err != nil {
+		object.Close()
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, plaintext, r.skip); err != nil {
+		object.Close()
+		if isMinIONotFound(err) {
+			return nil, fmt.Errorf("failed to get object: %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	return &rangeReadCloser{Reader: io.LimitReader(plaintext, r.length), Closer: object}, nil
+}
+
+func (m *MinIOMedia) Stat(ctx context.Context, fileType FileType, filename string) (*FileInfo, error) {
+	if _, err := cleanFilename(filename); err != nil {
+		return nil, err
+	}
+
+	bucketName, objectName := m.layout.Location(fileType, filename)
+	var info minio.ObjectInfo
+	err := m.withSSECKeys(bucketName, objectName, func(sse encrypt.ServerSide) error {
+		var err error
+		info, err = m.minioClient.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{
+			ServerSideEncryption: sse,
+		})
+		return err
+	})
+	if err != nil {
+		if isMinIONotFound(err) {
+			return nil, fmt.Errorf("failed to stat object: %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to stat object: %w", err)
+	}
+
+	metadata := lowerMetadata(info.UserMetadata)
+	size := info.Size
+	if isEnveloped(metadata) {
+		if size, err = plaintextSize(metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	return &FileInfo{
+		Key:          fmt.Sprintf("%s/%s", bucketName, objectName),
+		Filename:     filename,
+		Size:         size,
+		ContentType:  info.ContentType,
+		ETag:         info.ETag,
+		Metadata:     metadata,
+		LastModified: info.LastModified,
+	}, nil
+}
+
+func (m *MinIOMedia) UpdateMetadata(ctx context.Context, fileType FileType, filename string, metadata map[string]string) error {
+	info, err := m.Stat(ctx, fileType, filename)
+	if err != nil {
+		return err
+	}
+
+	// S3 objects are immutable, so the metadata is replaced by copying the object onto itself.
+	// ComposeObject switches to a multipart copy for objects over the 5 GiB single copy limit.
+	bucketName, objectName := m.layout.Location(fileType, filename)
+	merged := mergeMetadata(info.Metadata, metadata)
+	// The keys needed to decrypt or size an envelope encrypted object can never be changed
+	if isEnveloped(info.Metadata) {
+		for _, k := range []string{MetadataEncryption, MetadataEncryptionKeyID, MetadataEncryptionKey, MetadataSize} {
+			merged[k] = info.Metadata[k]
+		}
+	}
+
+	// ComposeObject may copy through a multipart upload, which ignores ContentType but sends standard
+	// headers found in the metadata
+	if info.ContentType != "" {
+		merged["Content-Type"] = info.ContentType
+	}
+
+	// The copy is encrypted with the current key, re-encrypting SSE-C objects stored with an old one
+	sse := m.encryption.serverSide(bucketName, objectName)
+	err = m.withSSECKeys(bucketName, objectName, func(srcSSE encrypt.ServerSide) error {
+		src := minio.CopySrcOptions{
+			Bucket:    bucketName,
+			Object:    objectName,
+			MatchETag: info.ETag,
+		}
+		if srcSSE != nil && srcSSE.Type() == encrypt.SSEC {
+			src.Encryption = srcSSE
+		}
+		_, err := m.minioClient.ComposeObject(ctx, minio.CopyDestOptions{
+			Bucket:          bucketName,
+			Object:          objectName,
+			UserMetadata:    merged,
+			ReplaceMetadata: true,
+			ContentType:     info.ContentType,
+			Encryption:      sse,
+		}, src)
+		return err
+	})
+	if err != nil {
+		if isMinIONotFound(err) {
+			return fmt.Errorf("failed to update metadata: %w", ErrNotFound)
+		}
+		return fmt.Errorf("failed to update metadata: %w", err)
+	}
+	return nil
+}
+
 func (m *MinIOMedia) GetURL(ctx context.Context, fileType FileType, filename string, expiration time.Duration) (string, error) {
-	bucketName := m.getBucketName(fileType)
+	if !m.encryption.presignable() {
+		return "", fmt.Errorf("%w: %s objects can only be read through Download", ErrEncryptionUnsupported, m.encryption.mode)
+	}
+
+	bucketName, objectName := m.layout.Location(fileType, filename)
 
 	// Always generate a presigned URL with the specified expiration
-	presignedURL, err := m.minioClient.PresignedGetObject(ctx, bucketName, filename, expiration, nil)
+	presignedURL, err := m.minioClient.PresignedGetObject(ctx, bucketName, objectName, expiration, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate presigned URL: %w", err)
 	}
@@ -131,11 +569,14 @@ func (m *MinIOMedia) GetCDNURL(ctx context.Context, fileType FileType, filename
 		return "", fmt.Errorf("CDN URL not configured")
 	}
 
-	if m.cdnSignKey == "" {
+	if m.cdnSigner == nil {
 		return "", fmt.Errorf("CDN signing key not configured")
 	}
+	if !m.encryption.presignable() {
+		return "", fmt.Errorf("%w: %s objects can only be read through Download", ErrEncryptionUnsupported, m.encryption.mode)
+	}
 
-	bucketName := m.getBucketName(fileType)
+	bucketName, objectName := m.layout.Location(fileType, filename)
 
 	// Parse CDN URL and append the file path
 	cdnURL, err := url.Parse(m.cdnDomain)
@@ -144,10 +585,10 @@ func (m *MinIOMedia) GetCDNURL(ctx context.Context, fileType FileType, filename
 	}
 
 	// Construct the full CDN URL path
-	cdnURL.Path = fmt.Sprintf("/%s/%s", bucketName, filename)
+	cdnURL.Path = fmt.Sprintf("/%s/%s", bucketName, objectName)
 
 	// Generate signed CDN URL
-	signedURL, err := m.generateCDNSignedURL(cdnURL.String(), expiration)
+	signedURL, err := m.cdnSigner.SignURL(cdnURL.String(), expiration)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate CDN signed URL: %w", err)
 	}
@@ -155,42 +596,136 @@ func (m *MinIOMedia) GetCDNURL(ctx context.Context, fileType FileType, filename
 	return signedURL, nil
 }
 
-// generateCDNSignedURL generates a signed URL for CDN access
-// This is a generic implementation - you may need to adapt it for specific CDN providers
-func (m *MinIOMedia) generateCDNSignedURL(baseURL string, expiration time.Duration) (string, error) {
-	// Calculate expiration timestamp
-	expirationTime := time.Now().Add(expiration).Unix()
+func (m *MinIOMedia) Delete(ctx context.Context, fileType FileType, filename string) error {
+	if _, err := cleanFilename(filename); err != nil {
+		return err
+	}
+
+	bucketName, objectName := m.layout.Location(fileType, filename)
 
-	// Parse the URL to add parameters
-	parsedURL, err := url.Parse(baseURL)
+	err := m.minioClient.RemoveObject(ctx, bucketName, objectName, minio.RemoveObjectOptions{})
 	if err != nil {
-		return "", err
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+
+	return nil
+}
+
+func (m *MinIOMedia) List(ctx context.Context, fileType FileType, prefix string, cursor string, limit int) (*ListPage, error) {
+	if limit <= 0 {
+		limit = defaultListLimit
 	}
 
-	// Create the string to sign (URL path + expiration)
-	stringToSign := parsedURL.Path + strconv.FormatInt(expirationTime, 10)
+	bucketName := m.layout.BucketFor(fileType)
+	keyPrefix := m.layout.KeyPrefix(fileType)
 
-	// Generate HMAC signature
-	h := hmac.New(sha256.New, []byte(m.cdnSignKey))
-	h.Write([]byte(stringToSign))
-	signature := hex.EncodeToString(h.Sum(nil))
+	listOpts := minio.ListObjectsOptions{
+		Prefix:    keyPrefix + prefix,
+		Recursive: true,
+		MaxKeys:   min(limit+1, 1000),
+	}
+	if cursor != "" {
+		listOpts.StartAfter = keyPrefix + cursor
+	}
+
+	// Stop the listing goroutine once enough objects have been read
+	listCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	page := &ListPage{}
+	for object := range m.minioClient.ListObjects(listCtx, bucketName, listOpts) {
+		if object.Err != nil {
+			if isMinIONotFound(object.Err) {
+				break
+			}
+			return nil, fmt.Errorf("failed to list objects: %w", object.Err)
+		}
+		if len(page.Files) == limit {
+			page.NextCursor = page.Files[len(page.Files)-1].Filename
+			break
+		}
 
-	// Add signature and expiration as query parameters
-	query := parsedURL.Query()
-	query.Set("expires", strconv.FormatInt(expirationTime, 10))
-	query.Set("signature", signature)
-	parsedURL.RawQuery = query.Encode()
+		filename := strings.TrimPrefix(object.Key, keyPrefix)
+		page.Files = append(page.Files, FileInfo{
+			Key:          fmt.Sprintf("%s/%s", bucketName, object.Key),
+			Filename:     filename,
+			Size:         object.Size,
+			ETag:         object.ETag,
+			LastModified: object.LastModified,
+		})
+	}
 
-	return parsedURL.String(), nil
+	return page, nil
 }
 
-func (m *MinIOMedia) Delete(ctx context.Context, fileType FileType, filename string) error {
-	bucketName := m.getBucketName(fileType)
+func (m *MinIOMedia) DeleteMany(ctx context.Context, fileType FileType, filenames []string) error {
+	failed := DeleteErrors{}
+	bucketName := m.layout.BucketFor(fileType)
 
-	err := m.minioClient.RemoveObject(ctx, bucketName, filename, minio.RemoveObjectOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to delete object: %w", err)
+	objectNames := make(map[string]string, len(filenames)) // object name -> filename
+	objectsCh := make(chan minio.ObjectInfo, len(filenames))
+	for _, filename := range filenames {
+		if _, err := cleanFilename(filename); err != nil {
+			failed[filename] = err
+			continue
+		}
+		_, objectName := m.layout.Location(fileType, filename)
+		objectNames[objectName] = filename
+		objectsCh <- minio.ObjectInfo{Key: objectName}
+	}
+	close(objectsCh)
+
+	for removeErr := range m.minioClient.RemoveObjects(ctx, bucketName, objectsCh, minio.RemoveObjectsOptions{}) {
+		if isMinIONotFound(removeErr.Err) {
+			continue
+		}
+		filename, ok := objectNames[removeErr.ObjectName]
+		if !ok {
+			filename = removeErr.ObjectName
+		}
+		failed[filename] = fmt.Errorf("failed to delete object: %w", removeErr.Err)
 	}
 
+	if len(failed) > 0 {
+		return failed
+	}
 	return nil
 }
+
+// lowerMetadata returns user metadata with lower-case keys; S3 returns them with canonical header casing
+func lowerMetadata(userMetadata map[string]string) map[string]string {
+	metadata := make(map[string]string, len(userMetadata))
+	for k, v := range userMetadata {
+		metadata[strings.ToLower(k)] = v
+	}
+	return metadata
+}
+
+// withSSECKeys calls fn with the server-side encryption of an object under the current key. While fn fails
+// because an SSE-C object was stored with another key, it is called again with the keys derived from OldKeys.
+func (m *MinIOMedia) withSSECKeys(bucketName string, objectName string, fn func(sse encrypt.ServerSide) error) error {
+	err := fn(m.encryption.serverSide(bucketName, objectName))
+	for _, sse := range m.encryption.oldServerSide(bucketName, objectName) {
+		if !isSSECKeyMismatch(err) {
+			break
+		}
+		err = fn(sse)
+	}
+	return err
+}
+
+// isSSECKeyMismatch reports whether err may mean an SSE-C key does not match the object's key.
+// S3 and MinIO answer such requests with 403 Forbidden.
+func isSSECKeyMismatch(err error) bool {
+	return err != nil && minio.ToErrorResponse(err).StatusCode == http.StatusForbidden
+}
+
+// isMinIONotFound reports whether err means the bucket or object does not exist
+func isMinIONotFound(err error) bool {
+	switch minio.ToErrorResponse(err).Code {
+	case minio.NoSuchKey, minio.NoSuchBucket:
+		return true
+	default:
+		return false
+	}
+}
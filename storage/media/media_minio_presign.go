@@ -0,0 +1,108 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func (m *MinIOMedia) GetUploadURL(ctx context.Context, fileType FileType, filename string, constraints UploadConstraints) (*PresignedUpload, error) {
+	if _, err := cleanFilename(filename); err != nil {
+		return nil, err
+	}
+	if !m.encryption.presignable() {
+		return nil, fmt.Errorf("%w: %s objects must be uploaded through Upload", ErrEncryptionUnsupported, m.encryption.mode)
+	}
+
+	bucketName, objectName := m.layout.Location(fileType, filename)
+	if err := m.ensureBucketExists(ctx, bucketName); err != nil {
+		return nil, err
+	}
+
+	expiresAt := constraints.ExpiresAt(time.Now())
+	policy := minio.NewPostPolicy()
+	if err := policy.SetBucket(bucketName); err != nil {
+		return nil, fmt.Errorf("invalid upload policy: %w", err)
+	}
+	if err := policy.SetKey(objectName); err != nil {
+		return nil, fmt.Errorf("invalid upload policy: %w", err)
+	}
+	if err := policy.SetExpires(expiresAt); err != nil {
+		return nil, fmt.Errorf("invalid upload policy: %w", err)
+	}
+	if err := policy.SetContentLengthRange(constraints.MinSize, constraints.maxSize(m.maxUploadSize)); err != nil {
+		return nil, fmt.Errorf("invalid upload policy: %w", err)
+	}
+
+	if sse := m.encryption.serverSide(bucketName, objectName); sse != nil {
+		policy.SetEncryption(sse)
+	}
+
+	// A policy can only enforce one exact type or a prefix; VerifyUpload checks the full list
+	var err error
+	if contentType, ok := constraints.singleContentType(); ok {
+		err = policy.SetContentType(contentType)
+	} else {
+		err = policy.SetContentTypeStartsWith(contentTypePrefix(fileType))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload policy: %w", err)
+	}
+
+	postURL, fields, err := m.minioClient.PresignedPostPolicy(ctx, policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate presigned upload: %w", err)
+	}
+
+	return &PresignedUpload{
+		Method:    "POST",
+		URL:       postURL.String(),
+		Fields:    fields,
+		Key:       fmt.Sprintf("%s/%s", bucketName, objectName),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (m *MinIOMedia) VerifyUpload(ctx context.Context, fileType FileType, filename string, constraints UploadConstraints) (*UploadedFile, error) {
+	if _, err := cleanFilename(filename); err != nil {
+		return nil, err
+	}
+
+	bucketName, objectName := m.layout.Location(fileType, filename)
+	info, err := m.minioClient.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		if isMinIONotFound(err) {
+			return nil, fmt.Errorf("failed to verify upload: %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to verify upload: %w", err)
+	}
+
+	getOpts := minio.GetObjectOptions{}
+	if info.Size > 0 {
+		if err := getOpts.SetRange(0, min(info.Size, sniffLen)-1); err != nil {
+			return nil, fmt.Errorf("failed to verify upload: %w", err)
+		}
+	}
+	head, err := m.minioClient.GetObject(ctx, bucketName, objectName, getOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify upload: %w", err)
+	}
+	defer head.Close()
+
+	contentType, err := CheckUploaded(fileType, constraints, m.maxUploadSize, info.Size, info.ContentType, head)
+	if err != nil {
+		// Rejected uploads are removed so they can never be served
+		if removeErr := m.minioClient.RemoveObject(ctx, bucketName, objectName, minio.RemoveObjectOptions{}); removeErr != nil {
+			return nil, fmt.Errorf("%w (failed to delete rejected upload: %v)", err, removeErr)
+		}
+		return nil, err
+	}
+
+	return &UploadedFile{
+		Key:         fmt.Sprintf("%s/%s", bucketName, objectName),
+		Size:        info.Size,
+		ContentType: contentType,
+	}, nil
+}
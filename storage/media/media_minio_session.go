@@ -0,0 +1,287 @@
+package media
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// minioSession is encoded into the session ID, so sessions survive restarts and work across instances
+// without extra state. The ID is signed, so callers cannot change the target file, content type or
+// declared size of a session they were given.
+type minioSession struct {
+	FileType    FileType `json:"t"`
+	Filename    string   `json:"f"`
+	UploadID    string   `json:"u"`
+	ContentType string   `json:"c,omitempty"`
+	Size        int64    `json:"s"`
+	CreatedAt   int64    `json:"a"`
+}
+
+// encode returns the session ID: the encoded session and its HMAC-SHA256 signature, joined by a dot
+func (s *minioSession) encode(signKey string) (string, error) {
+	encoded, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode upload session: %w", err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(encoded)
+	return payload + "." + signSession(signKey, payload), nil
+}
+
+func decodeMinIOSession(sessionID string, signKey string) (*minioSession, error) {
+	payload, signature, ok := strings.Cut(sessionID, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(signSession(signKey, payload))) {
+		return nil, ErrSessionNotFound
+	}
+	encoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+
+	var session minioSession
+	if err := json.Unmarshal(encoded, &session); err != nil || session.UploadID == "" {
+		return nil, ErrSessionNotFound
+	}
+	if _, err := cleanFilename(session.Filename); err != nil {
+		return nil, ErrSessionNotFound
+	}
+	return &session, nil
+}
+
+// signSession returns the base64 HMAC-SHA256 of an encoded session
+func signSession(signKey string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(signKey))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *minioSession) toUploadSession(sessionID string) *UploadSession {
+	return &UploadSession{
+		ID:          sessionID,
+		FileType:    s.FileType,
+		Filename:    s.Filename,
+		ContentType: s.ContentType,
+		Size:        s.Size,
+		CreatedAt:   time.Unix(s.CreatedAt, 0).UTC(),
+	}
+}
+
+// mapMinIOSessionError maps S3 multipart errors to the media session errors
+func mapMinIOSessionError(err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchUpload":
+		return ErrSessionNotFound
+	case "EntityTooSmall":
+		return fmt.Errorf("%w: %v", ErrPartTooSmall, err)
+	default:
+		return err
+	}
+}
+
+func (m *MinIOMedia) InitiateUpload(ctx context.Context, fileType FileType, filename string, size int64, opts *UploadOptions) (*UploadSession, error) {
+	if _, err := cleanFilename(filename); err != nil {
+		return nil, err
+	}
+	if m.maxUploadSize > 0 && size > m.maxUploadSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrTooLarge, size)
+	}
+	// Parts are stored as uploaded, so they cannot be sealed chunk by chunk
+	if m.encryption.clientSide() {
+		return nil, fmt.Errorf("%w: %s objects must be uploaded through Upload", ErrEncryptionUnsupported, m.encryption.mode)
+	}
+	if size < 0 {
+		size = -1
+	}
+
+	bucketName, objectName := m.layout.Location(fileType, filename)
+	if err := m.ensureBucketExists(ctx, bucketName); err != nil {
+		return nil, err
+	}
+
+	// Metadata can only be set when the upload is created, so the size and checksum
+	// recorded by Upload are not available for multipart uploads
+	putOpts := minio.PutObjectOptions{
+		ServerSideEncryption: m.encryption.serverSide(bucketName, objectName),
+	}
+	session := minioSession{
+		FileType:  fileType,
+		Filename:  filename,
+		Size:      size,
+		CreatedAt: time.Now().Unix(),
+	}
+	if opts != nil {
+		putOpts.ContentType = opts.ContentType
+		putOpts.UserMetadata = opts.Metadata
+		session.ContentType = opts.ContentType
+	}
+
+	core := minio.Core{Client: m.minioClient}
+	uploadID, err := core.NewMultipartUpload(ctx, bucketName, objectName, putOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initiate upload: %w", err)
+	}
+	session.UploadID = uploadID
+
+	sessionID, err := session.encode(m.signKey)
+	if err != nil {
+		return nil, err
+	}
+	return session.toUploadSession(sessionID), nil
+}
+
+func (m *MinIOMedia) GetUploadSession(ctx context.Context, sessionID string) (*UploadSession, error) {
+	session, err := decodeMinIOSession(sessionID, m.signKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Listing a single part verifies the upload has not been completed or aborted
+	bucketName, objectName := m.layout.Location(session.FileType, session.Filename)
+	core := minio.Core{Client: m.minioClient}
+	if _, err := core.ListObjectParts(ctx, bucketName, objectName, session.UploadID, 0, 1); err != nil {
+		return nil, fmt.Errorf("failed to get upload session: %w", mapMinIOSessionError(err))
+	}
+
+	return session.toUploadSession(sessionID), nil
+}
+
+func (m *MinIOMedia) UploadPart(ctx context.Context, sessionID string, partNumber int, data io.Reader, size int64) (*UploadPart, error) {
+	if err := validatePartNumber(partNumber); err != nil {
+		return nil, err
+	}
+	session, err := decodeMinIOSession(sessionID, m.signKey)
+	if err != nil {
+		return nil, err
+	}
+	if m.maxUploadSize > 0 && size > m.maxUploadSize {
+		return nil, fmt.Errorf("%w: part %d exceeds %d bytes", ErrTooLarge, partNumber, m.maxUploadSize)
+	}
+
+	reader, err := sniffFirstPart(session.toUploadSession(sessionID), partNumber, partReader(&contextReader{ctx: ctx, r: data}, size))
+	if err != nil {
+		return nil, err
+	}
+
+	// S3 needs the part size up front; spool parts of unknown size to disk first
+	if size < 0 {
+		spool, err := os.CreateTemp("", "wesio-part-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temporary file: %w", err)
+		}
+		defer func() {
+			spool.Close()
+			os.Remove(spool.Name())
+		}()
+
+		limited := reader
+		if m.maxUploadSize > 0 {
+			limited = io.LimitReader(reader, m.maxUploadSize+1)
+		}
+		if size, err = io.Copy(spool, limited); err != nil {
+			return nil, fmt.Errorf("failed to upload part: %w", err)
+		}
+		if m.maxUploadSize > 0 && size > m.maxUploadSize {
+			return nil, fmt.Errorf("%w: part %d exceeds %d bytes", ErrTooLarge, partNumber, m.maxUploadSize)
+		}
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to upload part: %w", err)
+		}
+		reader = spool
+	}
+
+	bucketName, objectName := m.layout.Location(session.FileType, session.Filename)
+	core := minio.Core{Client: m.minioClient}
+	part, err := core.PutObjectPart(ctx, bucketName, objectName, session.UploadID, partNumber, reader, size, minio.PutObjectPartOptions{
+		SSE: m.encryption.serverSide(bucketName, objectName),
+	})
+	if err != nil {
+		if errors.Is(err, ErrInvalidPart) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to upload part: %w", mapMinIOSessionError(err))
+	}
+
+	return &UploadPart{Number: part.PartNumber, Size: part.Size, ETag: part.ETag}, nil
+}
+
+func (m *MinIOMedia) ListParts(ctx context.Context, sessionID string) ([]UploadPart, error) {
+	session, err := decodeMinIOSession(sessionID, m.signKey)
+	if err != nil {
+		return nil, err
+	}
+	return m.listParts(ctx, session)
+}
+
+func (m *MinIOMedia) listParts(ctx context.Context, session *minioSession) ([]UploadPart, error) {
+	bucketName, objectName := m.layout.Location(session.FileType, session.Filename)
+	core := minio.Core{Client: m.minioClient}
+
+	parts := []UploadPart{}
+	marker := 0
+	for {
+		result, err := core.ListObjectParts(ctx, bucketName, objectName, session.UploadID, marker, 1000)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list parts: %w", mapMinIOSessionError(err))
+		}
+		for _, part := range result.ObjectParts {
+			parts = append(parts, UploadPart{Number: part.PartNumber, Size: part.Size, ETag: part.ETag})
+		}
+		if !result.IsTruncated {
+			return parts, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+func (m *MinIOMedia) CompleteUpload(ctx context.Context, sessionID string) (string, error) {
+	session, err := decodeMinIOSession(sessionID, m.signKey)
+	if err != nil {
+		return "", err
+	}
+	parts, err := m.listParts(ctx, session)
+	if err != nil {
+		return "", err
+	}
+	if _, err := checkParts(parts, session.Size, m.maxUploadSize); err != nil {
+		return "", err
+	}
+
+	completeParts := make([]minio.CompletePart, 0, len(parts))
+	for _, part := range parts {
+		completeParts = append(completeParts, minio.CompletePart{PartNumber: part.Number, ETag: part.ETag})
+	}
+
+	bucketName, objectName := m.layout.Location(session.FileType, session.Filename)
+	core := minio.Core{Client: m.minioClient}
+	if _, err := core.CompleteMultipartUpload(ctx, bucketName, objectName, session.UploadID, completeParts, minio.PutObjectOptions{
+		ServerSideEncryption: m.encryption.serverSide(bucketName, objectName),
+	}); err != nil {
+		return "", fmt.Errorf("failed to complete upload: %w", mapMinIOSessionError(err))
+	}
+
+	return fmt.Sprintf("%s/%s", bucketName, objectName), nil
+}
+
+func (m *MinIOMedia) AbortUpload(ctx context.Context, sessionID string) error {
+	session, err := decodeMinIOSession(sessionID, m.signKey)
+	if err != nil {
+		return err
+	}
+
+	bucketName, objectName := m.layout.Location(session.FileType, session.Filename)
+	core := minio.Core{Client: m.minioClient}
+	if err := core.AbortMultipartUpload(ctx, bucketName, objectName, session.UploadID); err != nil {
+		return fmt.Errorf("failed to abort upload: %w", mapMinIOSessionError(err))
+	}
+	return nil
+}
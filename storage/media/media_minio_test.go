@@ -0,0 +1,76 @@
+package media_test
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/weiawesome/wesio-live/storage/media"
+	"github.com/weiawesome/wesio-live/storage/media/mediatest"
+)
+
+// TestMinIOMediaConformance runs against the server at MINIO_ENDPOINT, e.g. the docker compose MinIO.
+// Every behaviour gets its own key prefix in MINIO_TEST_BUCKET, which is created when missing.
+func TestMinIOMediaConformance(t *testing.T) {
+	endpoint := os.Getenv("MINIO_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("MINIO_ENDPOINT not set")
+	}
+	bucket := os.Getenv("MINIO_TEST_BUCKET")
+	if bucket == "" {
+		bucket = "wesio-media-test"
+	}
+	secure, _ := strconv.ParseBool(os.Getenv("MINIO_USE_SSL"))
+
+	mediatest.Run(t, func(t *testing.T) media.Media {
+		ctx := context.Background()
+		m, err := media.CreateMinIOMediaWithOptions(ctx, media.MinIOMediaOptions{
+			Endpoint:  endpoint,
+			AccessKey: os.Getenv("MINIO_ACCESS_KEY"),
+			SecretKey: os.Getenv("MINIO_SECRET_KEY"),
+			Secure:    secure,
+			Layout: media.BucketLayout{
+				Mode:   media.LayoutSingle,
+				Bucket: bucket,
+				Prefix: "conformance-" + uuid.NewString(),
+			},
+			Provisioning: media.BucketProvisioning{AutoCreate: true},
+		})
+		if err != nil {
+			t.Fatalf("failed to create MinIO media: %v", err)
+		}
+		if err := m.Ping(ctx); err != nil {
+			t.Fatalf("MinIO not reachable: %v", err)
+		}
+		t.Cleanup(func() { removeAll(t, m) })
+		return m
+	})
+}
+
+// removeAll deletes every file a behaviour left behind under its prefix
+func removeAll(t *testing.T, m media.Media) {
+	ctx := context.Background()
+	for _, fileType := range []media.FileType{media.Image, media.Video, ""} {
+		cursor := ""
+		for {
+			page, err := m.List(ctx, fileType, "", cursor, 1000)
+			if err != nil {
+				t.Logf("failed to list leftover files: %v", err)
+				break
+			}
+			filenames := make([]string, 0, len(page.Files))
+			for _, file := range page.Files {
+				filenames = append(filenames, file.Filename)
+			}
+			if err := m.DeleteMany(ctx, fileType, filenames); err != nil {
+				t.Logf("failed to delete leftover files: %v", err)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+	}
+}
@@ -0,0 +1,720 @@
+// Package mediatest provides a conformance suite for media.Media implementations
+// and an in-memory backend for unit tests.
+//
+// A backend passes the suite with:
+//
+//	func TestConformance(t *testing.T) {
+//		mediatest.Run(t, func(t *testing.T) media.Media {
+//			return newBackend(t)
+//		})
+//	}
+package mediatest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/weiawesome/wesio-live/storage/media"
+)
+
+// Factory returns the backend under test. It is called once per behaviour.
+type Factory func(t *testing.T) media.Media
+
+// Behaviour is a single contract check run against a backend
+type Behaviour struct {
+	Name string
+	Test func(t *testing.T, m media.Media)
+}
+
+// Behaviours is the table of contract checks every media.Media implementation must satisfy
+var Behaviours = []Behaviour{
+	{"UploadReturnsKeyEndingInFilename", testUploadReturnsKey},
+	{"DownloadReturnsUploadedBytes", testRoundTrip},
+	{"UploadWithoutOptions", testUploadWithoutOptions},
+	{"UploadNestedFilename", testNestedFilename},
+	{"UploadOverwritesExistingFile", testOverwrite},
+	{"UploadLargeFile", testLargeFile},
+	{"FileTypesAreIsolated", testFileTypeIsolation},
+	{"DownloadMissingFileFailsImmediately", testDownloadMissing},
+	{"DeleteRemovesFile", testDelete},
+	{"DeleteMissingFileSucceeds", testDeleteMissing},
+	{"GetURLReturnsAbsoluteURL", testGetURL},
+	{"RejectsInvalidFilenames", testInvalidFilenames},
+	{"UploadHonoursCancelledContext", testCancelledContext},
+	{"UploadRejectsContentNotMatchingFileType", testFileTypeMismatch},
+	{"UploadRejectsContentNotMatchingContentType", testContentTypeMismatch},
+	{"UploadSessionAssemblesParts", testSessionAssemblesParts},
+	{"UploadSessionReplacesPart", testSessionReplacesPart},
+	{"UploadSessionRejectsSmallParts", testSessionSmallParts},
+	{"UploadSessionRejectsIncompleteUpload", testSessionIncomplete},
+	{"UploadPartRejectsShortStream", testSessionShortPart},
+	{"AbortUploadDiscardsSession", testSessionAbort},
+	{"GetUploadURLReturnsPresignedForm", testGetUploadURL},
+	{"VerifyUploadAcceptsMatchingFile", testVerifyUpload},
+	{"VerifyUploadRejectsOversizedFile", testVerifyUploadTooLarge},
+	{"VerifyUploadRejectsDisallowedContentType", testVerifyUploadContentType},
+	{"VerifyUploadMissingFile", testVerifyUploadMissing},
+	{"StatReturnsFileInfo", testStat},
+	{"StatMissingFile", testStatMissing},
+	{"StatETagChangesOnOverwrite", testStatETag},
+	{"UpdateMetadataMergesKeys", testUpdateMetadata},
+	{"DownloadRangeReturnsSlice", testDownloadRange},
+	{"DownloadRangePastEndFails", testDownloadRangePastEnd},
+	{"ListPaginatesWithPrefixAndCursor", testList},
+	{"DeleteManyRemovesFiles", testDeleteMany},
+	{"DeleteManyReportsPerFileErrors", testDeleteManyErrors},
+}
+
+// Run runs every behaviour as a subtest against backends returned by newMedia
+func Run(t *testing.T, newMedia Factory) {
+	t.Helper()
+	for _, behaviour := range Behaviours {
+		t.Run(behaviour.Name, func(t *testing.T) {
+			behaviour.Test(t, newMedia(t))
+		})
+	}
+}
+
+// PNG returns payload prefixed with a PNG signature, so it is sniffed as image/png
+func PNG(payload []byte) []byte {
+	return append([]byte("\x89PNG\r\n\x1a\n"), payload...)
+}
+
+// MP4 returns payload prefixed with an MP4 ftyp box, so it is sniffed as video/mp4
+func MP4(payload []byte) []byte {
+	ftyp := []byte("\x00\x00\x00\x18ftypisom\x00\x00\x02\x00isommp41")
+	return append(ftyp, payload...)
+}
+
+var filenameSeq atomic.Int64
+
+// uniqueName returns a filename that does not collide across behaviours sharing a backend
+func uniqueName(ext string) string {
+	return fmt.Sprintf("mediatest-%d-%d%s", time.Now().UnixNano(), filenameSeq.Add(1), ext)
+}
+
+func upload(t *testing.T, m media.Media, fileType media.FileType, filename string, data []byte) string {
+	t.Helper()
+	key, err := m.Upload(context.Background(), fileType, filename, bytes.NewReader(data), &media.UploadOptions{
+		ContentType: "application/octet-stream",
+		Metadata:    map[string]string{"source": "mediatest"},
+	})
+	if err != nil {
+		t.Fatalf("Upload(%s, %q) failed: %v", fileType, filename, err)
+	}
+	t.Cleanup(func() {
+		_ = m.Delete(context.Background(), fileType, filename)
+	})
+	return key
+}
+
+func download(t *testing.T, m media.Media, fileType media.FileType, filename string) []byte {
+	t.Helper()
+	rc, err := m.Download(context.Background(), fileType, filename)
+	if err != nil {
+		t.Fatalf("Download(%s, %q) failed: %v", fileType, filename, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("reading Download(%s, %q) failed: %v", fileType, filename, err)
+	}
+	return data
+}
+
+func assertNotFound(t *testing.T, m media.Media, fileType media.FileType, filename string) {
+	t.Helper()
+	rc, err := m.Download(context.Background(), fileType, filename)
+	if err == nil {
+		rc.Close()
+		t.Fatalf("Download(%s, %q) succeeded, want error wrapping media.ErrNotFound", fileType, filename)
+	}
+	if !errors.Is(err, media.ErrNotFound) {
+		t.Fatalf("Download(%s, %q) error = %v, want error wrapping media.ErrNotFound", fileType, filename, err)
+	}
+}
+
+func testUploadReturnsKey(t *testing.T, m media.Media) {
+	filename := uniqueName(".bin")
+	key := upload(t, m, media.Image, filename, PNG([]byte("key")))
+	if !strings.HasSuffix(key, "/"+filename) {
+		t.Fatalf("Upload returned key %q, want a key ending in %q", key, "/"+filename)
+	}
+}
+
+func testRoundTrip(t *testing.T, m media.Media) {
+	filename := uniqueName(".bin")
+	want := PNG([]byte("hello, wesio"))
+	upload(t, m, media.Image, filename, want)
+
+	if got := download(t, m, media.Image, filename); !bytes.Equal(got, want) {
+		t.Fatalf("Download returned %q, want %q", got, want)
+	}
+}
+
+func testUploadWithoutOptions(t *testing.T, m media.Media) {
+	filename := uniqueName(".bin")
+	if _, err := m.Upload(context.Background(), "", filename, strings.NewReader("no options"), nil); err != nil {
+		t.Fatalf("Upload with nil options failed: %v", err)
+	}
+	t.Cleanup(func() { _ = m.Delete(context.Background(), "", filename) })
+
+	if got := download(t, m, "", filename); string(got) != "no options" {
+		t.Fatalf("Download returned %q, want %q", got, "no options")
+	}
+}
+
+func testNestedFilename(t *testing.T, m media.Media) {
+	filename := "rooms/" + uniqueName("") + "/segment-0001.ts"
+	want := MP4([]byte("segment"))
+	upload(t, m, media.Video, filename, want)
+
+	if got := download(t, m, media.Video, filename); !bytes.Equal(got, want) {
+		t.Fatalf("Download returned %q, want %q", got, want)
+	}
+}
+
+func testOverwrite(t *testing.T, m media.Media) {
+	filename := uniqueName(".bin")
+	upload(t, m, media.Image, filename, PNG([]byte("first")))
+	want := PNG([]byte("second"))
+	upload(t, m, media.Image, filename, want)
+
+	if got := download(t, m, media.Image, filename); !bytes.Equal(got, want) {
+		t.Fatalf("Download returned %q, want %q", got, want)
+	}
+}
+
+func testLargeFile(t *testing.T, m media.Media) {
+	filename := uniqueName(".bin")
+	want := MP4(bytes.Repeat([]byte("0123456789abcdef"), 256*1024)) // 4 MiB
+	upload(t, m, media.Video, filename, want)
+
+	if got := download(t, m, media.Video, filename); !bytes.Equal(got, want) {
+		t.Fatalf("Download returned %d bytes, want %d identical bytes", len(got), len(want))
+	}
+}
+
+func testFileTypeIsolation(t *testing.T, m media.Media) {
+	filename := uniqueName(".bin")
+	upload(t, m, media.Image, filename, PNG([]byte("image")))
+
+	assertNotFound(t, m, media.Video, filename)
+}
+
+func testDownloadMissing(t *testing.T, m media.Media) {
+	assertNotFound(t, m, media.Image, uniqueName(".missing"))
+}
+
+func testDelete(t *testing.T, m media.Media) {
+	filename := uniqueName(".bin")
+	upload(t, m, media.Image, filename, PNG([]byte("delete me")))
+
+	if err := m.Delete(context.Background(), media.Image, filename); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	assertNotFound(t, m, media.Image, filename)
+}
+
+func testDeleteMissing(t *testing.T, m media.Media) {
+	if err := m.Delete(context.Background(), media.Image, uniqueName(".missing")); err != nil {
+		t.Fatalf("Delete of a missing file failed: %v", err)
+	}
+}
+
+func testGetURL(t *testing.T, m media.Media) {
+	filename := uniqueName(".bin")
+	upload(t, m, media.Image, filename, PNG([]byte("url")))
+
+	raw, err := m.GetURL(context.Background(), media.Image, filename, time.Minute)
+	if err != nil {
+		t.Fatalf("GetURL failed: %v", err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("GetURL returned unparsable URL %q: %v", raw, err)
+	}
+	if !u.IsAbs() {
+		t.Fatalf("GetURL returned relative URL %q", raw)
+	}
+	if !strings.Contains(u.Path, filename) {
+		t.Fatalf("GetURL returned %q, want a path containing %q", raw, filename)
+	}
+}
+
+func testInvalidFilenames(t *testing.T, m media.Media) {
+	for _, filename := range []string{"", "../escape", "a/../../escape", "/absolute", "a//b", "./a"} {
+		_, err := m.Upload(context.Background(), media.Image, filename, strings.NewReader("x"), nil)
+		if !errors.Is(err, media.ErrInvalidFilename) {
+			t.Errorf("Upload(%q) error = %v, want media.ErrInvalidFilename", filename, err)
+		}
+		if _, err := m.Download(context.Background(), media.Image, filename); !errors.Is(err, media.ErrInvalidFilename) {
+			t.Errorf("Download(%q) error = %v, want media.ErrInvalidFilename", filename, err)
+		}
+		if err := m.Delete(context.Background(), media.Image, filename); !errors.Is(err, media.ErrInvalidFilename) {
+			t.Errorf("Delete(%q) error = %v, want media.ErrInvalidFilename", filename, err)
+		}
+	}
+}
+
+func testCancelledContext(t *testing.T, m media.Media) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	filename := uniqueName(".bin")
+	if _, err := m.Upload(ctx, media.Image, filename, bytes.NewReader(PNG([]byte("cancelled"))), nil); err == nil {
+		_ = m.Delete(context.Background(), media.Image, filename)
+		t.Fatal("Upload with a cancelled context succeeded, want error")
+	}
+}
+
+func testFileTypeMismatch(t *testing.T, m media.Media) {
+	for _, tc := range []struct {
+		fileType media.FileType
+		data     []byte
+	}{
+		{media.Image, []byte("plain text is not an image")},
+		{media.Image, MP4([]byte("video"))},
+		{media.Video, PNG([]byte("image"))},
+		{"", []byte("<html><script>alert(1)</script></html>")},
+	} {
+		filename := uniqueName(".bin")
+		if _, err := m.Upload(context.Background(), tc.fileType, filename, bytes.NewReader(tc.data), nil); !errors.Is(err, media.ErrContentMismatch) {
+			_ = m.Delete(context.Background(), tc.fileType, filename)
+			t.Errorf("Upload(%s, %q) error = %v, want media.ErrContentMismatch", tc.fileType, tc.data[:8], err)
+		}
+	}
+}
+
+func testContentTypeMismatch(t *testing.T, m media.Media) {
+	filename := uniqueName(".png")
+	_, err := m.Upload(context.Background(), media.Image, filename, bytes.NewReader(PNG([]byte("png"))), &media.UploadOptions{
+		ContentType: "image/jpeg",
+	})
+	if !errors.Is(err, media.ErrContentMismatch) {
+		_ = m.Delete(context.Background(), media.Image, filename)
+		t.Fatalf("Upload of a PNG declared as image/jpeg error = %v, want media.ErrContentMismatch", err)
+	}
+}
+
+func initiate(t *testing.T, m media.Media, fileType media.FileType, filename string, size int64) *media.UploadSession {
+	t.Helper()
+	session, err := m.InitiateUpload(context.Background(), fileType, filename, size, &media.UploadOptions{
+		Metadata: map[string]string{"source": "mediatest"},
+	})
+	if err != nil {
+		t.Fatalf("InitiateUpload(%s, %q) failed: %v", fileType, filename, err)
+	}
+	t.Cleanup(func() {
+		_ = m.AbortUpload(context.Background(), session.ID)
+		_ = m.Delete(context.Background(), fileType, filename)
+	})
+	return session
+}
+
+func uploadPart(t *testing.T, m media.Media, sessionID string, partNumber int, data []byte) *media.UploadPart {
+	t.Helper()
+	part, err := m.UploadPart(context.Background(), sessionID, partNumber, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("UploadPart(%d) failed: %v", partNumber, err)
+	}
+	if part.Number != partNumber || part.Size != int64(len(data)) {
+		t.Fatalf("UploadPart(%d) returned part %d of %d bytes, want %d bytes", partNumber, part.Number, part.Size, len(data))
+	}
+	return part
+}
+
+func testSessionAssemblesParts(t *testing.T, m media.Media) {
+	filename := uniqueName(".mp4")
+	first := MP4(bytes.Repeat([]byte{1}, media.MinPartSize))
+	last := []byte("tail")
+	session := initiate(t, m, media.Video, filename, int64(len(first)+len(last)))
+
+	// Parts may arrive out of order
+	uploadPart(t, m, session.ID, 2, last)
+	uploadPart(t, m, session.ID, 1, first)
+
+	parts, err := m.ListParts(context.Background(), session.ID)
+	if err != nil {
+		t.Fatalf("ListParts failed: %v", err)
+	}
+	if len(parts) != 2 || parts[0].Number != 1 || parts[1].Number != 2 {
+		t.Fatalf("ListParts returned %+v, want parts 1 and 2 in order", parts)
+	}
+
+	key, err := m.CompleteUpload(context.Background(), session.ID)
+	if err != nil {
+		t.Fatalf("CompleteUpload failed: %v", err)
+	}
+	if !strings.HasSuffix(key, "/"+filename) {
+		t.Fatalf("CompleteUpload returned key %q, want a key ending in %q", key, "/"+filename)
+	}
+	if got := download(t, m, media.Video, filename); !bytes.Equal(got, append(first, last...)) {
+		t.Fatalf("Download returned %d bytes, want the %d assembled bytes", len(got), len(first)+len(last))
+	}
+	if _, err := m.GetUploadSession(context.Background(), session.ID); !errors.Is(err, media.ErrSessionNotFound) {
+		t.Fatalf("GetUploadSession after CompleteUpload error = %v, want media.ErrSessionNotFound", err)
+	}
+}
+
+func testSessionReplacesPart(t *testing.T, m media.Media) {
+	filename := uniqueName(".png")
+	session := initiate(t, m, media.Image, filename, -1)
+
+	uploadPart(t, m, session.ID, 1, PNG([]byte("first")))
+	want := PNG([]byte("second"))
+	uploadPart(t, m, session.ID, 1, want)
+
+	if _, err := m.CompleteUpload(context.Background(), session.ID); err != nil {
+		t.Fatalf("CompleteUpload failed: %v", err)
+	}
+	if got := download(t, m, media.Image, filename); !bytes.Equal(got, want) {
+		t.Fatalf("Download returned %q, want %q", got, want)
+	}
+}
+
+func testSessionSmallParts(t *testing.T, m media.Media) {
+	session := initiate(t, m, media.Video, uniqueName(".mp4"), -1)
+	uploadPart(t, m, session.ID, 1, MP4([]byte("too small")))
+	uploadPart(t, m, session.ID, 2, []byte("tail"))
+
+	if _, err := m.CompleteUpload(context.Background(), session.ID); !errors.Is(err, media.ErrPartTooSmall) {
+		t.Fatalf("CompleteUpload error = %v, want media.ErrPartTooSmall", err)
+	}
+}
+
+func testSessionIncomplete(t *testing.T, m media.Media) {
+	data := PNG([]byte("partial"))
+	session := initiate(t, m, media.Image, uniqueName(".png"), int64(len(data)+10))
+	uploadPart(t, m, session.ID, 1, data)
+
+	if _, err := m.CompleteUpload(context.Background(), session.ID); !errors.Is(err, media.ErrUploadIncomplete) {
+		t.Fatalf("CompleteUpload error = %v, want media.ErrUploadIncomplete", err)
+	}
+}
+
+func testSessionShortPart(t *testing.T, m media.Media) {
+	session := initiate(t, m, media.Image, uniqueName(".png"), -1)
+	data := PNG([]byte("short"))
+
+	if _, err := m.UploadPart(context.Background(), session.ID, 1, bytes.NewReader(data), int64(len(data)+10)); err == nil {
+		t.Fatal("UploadPart with a stream shorter than its size succeeded, want error")
+	}
+	parts, err := m.ListParts(context.Background(), session.ID)
+	if err != nil {
+		t.Fatalf("ListParts failed: %v", err)
+	}
+	if len(parts) != 0 {
+		t.Fatalf("ListParts returned %+v after a failed part, want no parts", parts)
+	}
+}
+
+func testSessionAbort(t *testing.T, m media.Media) {
+	session := initiate(t, m, media.Image, uniqueName(".png"), -1)
+	uploadPart(t, m, session.ID, 1, PNG([]byte("abort")))
+
+	if err := m.AbortUpload(context.Background(), session.ID); err != nil {
+		t.Fatalf("AbortUpload failed: %v", err)
+	}
+	if _, err := m.GetUploadSession(context.Background(), session.ID); !errors.Is(err, media.ErrSessionNotFound) {
+		t.Fatalf("GetUploadSession after AbortUpload error = %v, want media.ErrSessionNotFound", err)
+	}
+	if _, err := m.CompleteUpload(context.Background(), session.ID); !errors.Is(err, media.ErrSessionNotFound) {
+		t.Fatalf("CompleteUpload after AbortUpload error = %v, want media.ErrSessionNotFound", err)
+	}
+}
+
+func testGetUploadURL(t *testing.T, m media.Media) {
+	filename := uniqueName(".png")
+	upload, err := m.GetUploadURL(context.Background(), media.Image, filename, media.UploadConstraints{
+		Expiration:   time.Minute,
+		MaxSize:      1024,
+		ContentTypes: []string{"image/png"},
+	})
+	if err != nil {
+		t.Fatalf("GetUploadURL failed: %v", err)
+	}
+
+	u, err := url.Parse(upload.URL)
+	if err != nil || !u.IsAbs() {
+		t.Fatalf("GetUploadURL returned URL %q, want an absolute URL", upload.URL)
+	}
+	if upload.Method == "" || len(upload.Fields) == 0 {
+		t.Fatalf("GetUploadURL returned method %q and fields %v, want a form upload", upload.Method, upload.Fields)
+	}
+	if !strings.HasSuffix(upload.Key, "/"+filename) {
+		t.Fatalf("GetUploadURL returned key %q, want a key ending in %q", upload.Key, "/"+filename)
+	}
+	if !upload.ExpiresAt.After(time.Now()) {
+		t.Fatalf("GetUploadURL returned expiry %v, want a time in the future", upload.ExpiresAt)
+	}
+}
+
+func testVerifyUpload(t *testing.T, m media.Media) {
+	filename := uniqueName(".png")
+	data := PNG([]byte("verified"))
+	upload(t, m, media.Image, filename, data)
+
+	file, err := m.VerifyUpload(context.Background(), media.Image, filename, media.UploadConstraints{
+		MaxSize:      1024,
+		ContentTypes: []string{"image/png"},
+	})
+	if err != nil {
+		t.Fatalf("VerifyUpload failed: %v", err)
+	}
+	if file.Size != int64(len(data)) || file.ContentType != "image/png" {
+		t.Fatalf("VerifyUpload returned %+v, want %d bytes of image/png", file, len(data))
+	}
+}
+
+func testVerifyUploadTooLarge(t *testing.T, m media.Media) {
+	filename := uniqueName(".png")
+	upload(t, m, media.Image, filename, PNG(make([]byte, 100)))
+
+	if _, err := m.VerifyUpload(context.Background(), media.Image, filename, media.UploadConstraints{MaxSize: 50}); !errors.Is(err, media.ErrTooLarge) {
+		t.Fatalf("VerifyUpload error = %v, want media.ErrTooLarge", err)
+	}
+	assertNotFound(t, m, media.Image, filename)
+}
+
+func testVerifyUploadContentType(t *testing.T, m media.Media) {
+	filename := uniqueName(".png")
+	upload(t, m, media.Image, filename, PNG([]byte("png")))
+
+	_, err := m.VerifyUpload(context.Background(), media.Image, filename, media.UploadConstraints{
+		ContentTypes: []string{"image/jpeg", "image/webp"},
+	})
+	if !errors.Is(err, media.ErrContentMismatch) {
+		t.Fatalf("VerifyUpload error = %v, want media.ErrContentMismatch", err)
+	}
+	assertNotFound(t, m, media.Image, filename)
+}
+
+func testVerifyUploadMissing(t *testing.T, m media.Media) {
+	if _, err := m.VerifyUpload(context.Background(), media.Image, uniqueName(".png"), media.UploadConstraints{}); !errors.Is(err, media.ErrNotFound) {
+		t.Fatalf("VerifyUpload of a missing file error = %v, want media.ErrNotFound", err)
+	}
+}
+
+func testStat(t *testing.T, m media.Media) {
+	filename := uniqueName(".png")
+	data := PNG([]byte("stat"))
+	key := upload(t, m, media.Image, filename, data)
+
+	info, err := m.Stat(context.Background(), media.Image, filename)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Key != key {
+		t.Errorf("Stat returned key %q, want %q", info.Key, key)
+	}
+	if info.Size != int64(len(data)) {
+		t.Errorf("Stat returned size %d, want %d", info.Size, len(data))
+	}
+	if info.ContentType != "image/png" {
+		t.Errorf("Stat returned content type %q, want %q", info.ContentType, "image/png")
+	}
+	if info.ETag == "" {
+		t.Error("Stat returned an empty ETag")
+	}
+	if info.Metadata["source"] != "mediatest" {
+		t.Errorf("Stat returned metadata %v, want source=mediatest", info.Metadata)
+	}
+	if info.Metadata[media.MetadataSize] != strconv.Itoa(len(data)) || info.Metadata[media.MetadataChecksum] == "" {
+		t.Errorf("Stat returned metadata %v, want the recorded size and checksum", info.Metadata)
+	}
+	if time.Since(info.LastModified) > time.Hour || time.Until(info.LastModified) > time.Minute {
+		t.Errorf("Stat returned last modified %v, want about now", info.LastModified)
+	}
+}
+
+func testStatMissing(t *testing.T, m media.Media) {
+	if _, err := m.Stat(context.Background(), media.Image, uniqueName(".missing")); !errors.Is(err, media.ErrNotFound) {
+		t.Fatalf("Stat of a missing file error = %v, want media.ErrNotFound", err)
+	}
+}
+
+func testStatETag(t *testing.T, m media.Media) {
+	filename := uniqueName(".png")
+	upload(t, m, media.Image, filename, PNG([]byte("first")))
+	first, err := m.Stat(context.Background(), media.Image, filename)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+
+	upload(t, m, media.Image, filename, PNG([]byte("second")))
+	second, err := m.Stat(context.Background(), media.Image, filename)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if first.ETag == second.ETag {
+		t.Fatalf("Stat returned ETag %q after the content changed", second.ETag)
+	}
+}
+
+func readRange(t *testing.T, m media.Media, filename string, offset, length int64) []byte {
+	t.Helper()
+	rc, err := m.DownloadRange(context.Background(), media.Video, filename, offset, length)
+	if err != nil {
+		t.Fatalf("DownloadRange(%d, %d) failed: %v", offset, length, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("reading DownloadRange(%d, %d) failed: %v", offset, length, err)
+	}
+	return data
+}
+
+func testDownloadRange(t *testing.T, m media.Media) {
+	filename := uniqueName(".mp4")
+	data := MP4([]byte("0123456789"))
+	upload(t, m, media.Video, filename, data)
+	size := int64(len(data))
+
+	for _, tc := range []struct {
+		offset, length int64
+		want           []byte
+	}{
+		{0, -1, data},
+		{size - 10, 4, []byte("0123")},
+		{size - 4, -1, []byte("6789")},
+		{size - 2, 100, []byte("89")},
+	} {
+		if got := readRange(t, m, filename, tc.offset, tc.length); !bytes.Equal(got, tc.want) {
+			t.Errorf("DownloadRange(%d, %d) returned %q, want %q", tc.offset, tc.length, got, tc.want)
+		}
+	}
+}
+
+func testDownloadRangePastEnd(t *testing.T, m media.Media) {
+	filename := uniqueName(".mp4")
+	data := MP4([]byte("end"))
+	upload(t, m, media.Video, filename, data)
+
+	rc, err := m.DownloadRange(context.Background(), media.Video, filename, int64(len(data)), -1)
+	if err == nil {
+		rc.Close()
+	}
+	if !errors.Is(err, media.ErrInvalidRange) {
+		t.Fatalf("DownloadRange past the end error = %v, want media.ErrInvalidRange", err)
+	}
+
+	if _, err := m.DownloadRange(context.Background(), media.Video, uniqueName(".missing"), 0, -1); !errors.Is(err, media.ErrNotFound) {
+		t.Fatalf("DownloadRange of a missing file error = %v, want media.ErrNotFound", err)
+	}
+}
+
+func testList(t *testing.T, m media.Media) {
+	prefix := uniqueName("/")
+	var want []string
+	for i := 0; i < 5; i++ {
+		filename := fmt.Sprintf("%s%d.png", prefix, i)
+		upload(t, m, media.Image, filename, PNG([]byte("list")))
+		want = append(want, filename)
+	}
+	upload(t, m, media.Image, uniqueName(".png"), PNG([]byte("other")))
+
+	var got []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > len(want) {
+			t.Fatalf("List did not finish after %d pages", pages)
+		}
+		page, err := m.List(context.Background(), media.Image, prefix, cursor, 2)
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		if len(page.Files) > 2 {
+			t.Fatalf("List returned %d files, want at most 2", len(page.Files))
+		}
+		for _, file := range page.Files {
+			if !strings.HasSuffix(file.Key, "/"+file.Filename) {
+				t.Errorf("List returned key %q not ending in filename %q", file.Key, file.Filename)
+			}
+			got = append(got, file.Filename)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("List returned %v, want %v", got, want)
+	}
+}
+
+func testDeleteMany(t *testing.T, m media.Media) {
+	first, second := uniqueName(".png"), uniqueName(".png")
+	upload(t, m, media.Image, first, PNG([]byte("first")))
+	upload(t, m, media.Image, second, PNG([]byte("second")))
+
+	err := m.DeleteMany(context.Background(), media.Image, []string{first, second, uniqueName(".missing")})
+	if err != nil {
+		t.Fatalf("DeleteMany failed: %v", err)
+	}
+	assertNotFound(t, m, media.Image, first)
+	assertNotFound(t, m, media.Image, second)
+}
+
+func testDeleteManyErrors(t *testing.T, m media.Media) {
+	filename := uniqueName(".png")
+	upload(t, m, media.Image, filename, PNG([]byte("valid")))
+
+	err := m.DeleteMany(context.Background(), media.Image, []string{filename, "../escape"})
+	var failed media.DeleteErrors
+	if !errors.As(err, &failed) {
+		t.Fatalf("DeleteMany error = %v, want media.DeleteErrors", err)
+	}
+	if len(failed) != 1 || !errors.Is(failed["../escape"], media.ErrInvalidFilename) {
+		t.Fatalf("DeleteMany reported %v, want only ../escape failing with media.ErrInvalidFilename", failed)
+	}
+	assertNotFound(t, m, media.Image, filename)
+}
+
+func testUpdateMetadata(t *testing.T, m media.Media) {
+	filename := uniqueName(".mp4")
+	data := MP4([]byte("metadata"))
+	upload(t, m, media.Video, filename, data)
+
+	ctx := context.Background()
+	if err := m.UpdateMetadata(ctx, media.Video, filename, map[string]string{"Duration": "1.5", "source": ""}); err != nil {
+		t.Fatalf("UpdateMetadata failed: %v", err)
+	}
+
+	info, err := m.Stat(ctx, media.Video, filename)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Metadata["duration"] != "1.5" {
+		t.Errorf("Stat returned metadata %v, want duration=1.5", info.Metadata)
+	}
+	if _, ok := info.Metadata["source"]; ok {
+		t.Errorf("Stat returned metadata %v, want source removed", info.Metadata)
+	}
+	if info.Metadata[media.MetadataChecksum] == "" {
+		t.Errorf("Stat returned metadata %v, want the checksum kept", info.Metadata)
+	}
+	if info.ContentType != "video/mp4" {
+		t.Errorf("Stat returned content type %q, want %q", info.ContentType, "video/mp4")
+	}
+	if got := download(t, m, media.Video, filename); !bytes.Equal(got, data) {
+		t.Fatalf("Download after UpdateMetadata returned %q, want %q", got, data)
+	}
+
+	if err := m.UpdateMetadata(ctx, media.Video, uniqueName(".missing"), map[string]string{"a": "b"}); !errors.Is(err, media.ErrNotFound) {
+		t.Fatalf("UpdateMetadata of a missing file error = %v, want media.ErrNotFound", err)
+	}
+}
@@ -0,0 +1,318 @@
+package mediatest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/weiawesome/wesio-live/storage/media"
+)
+
+// Object is a file stored by MemoryMedia
+type Object struct {
+	Data        []byte
+	ContentType string
+	Metadata    map[string]string
+	UploadedAt  time.Time
+}
+
+// MemoryMedia is an in-memory media.Media for unit tests.
+// It follows the same contract as the real backends, verified by Run.
+type MemoryMedia struct {
+	mu       sync.RWMutex
+	objects  map[string]*Object // "<dir>/<filename>" -> object
+	sessions map[string]*memorySession
+
+	maxUploadSize int64
+}
+
+var _ media.Media = (*MemoryMedia)(nil)
+
+func CreateMemoryMedia() *MemoryMedia {
+	return &MemoryMedia{
+		objects:  make(map[string]*Object),
+		sessions: make(map[string]*memorySession),
+	}
+}
+
+// SetMaxUploadSize limits the size of uploads, 0 for unlimited
+func (m *MemoryMedia) SetMaxUploadSize(size int64) {
+	m.mu.Lock()
+	m.maxUploadSize = size
+	m.mu.Unlock()
+}
+
+// getDirName returns the directory name based on file type
+func (m *MemoryMedia) getDirName(fileType media.FileType) string {
+	switch fileType {
+	case media.Image:
+		return "images"
+	case media.Video:
+		return "videos"
+	default:
+		return "files"
+	}
+}
+
+func (m *MemoryMedia) key(fileType media.FileType, filename string) (string, error) {
+	if filename == "" || strings.ContainsAny(filename, "\x00\\") ||
+		strings.HasPrefix(filename, "/") || path.Clean("/"+filename) != "/"+filename {
+		return "", media.ErrInvalidFilename
+	}
+	return m.getDirName(fileType) + "/" + filename, nil
+}
+
+func (m *MemoryMedia) Upload(ctx context.Context, fileType media.FileType, filename string, data io.Reader, opts *media.UploadOptions) (string, error) {
+	key, err := m.key(fileType, filename)
+	if err != nil {
+		return "", err
+	}
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	var metadata map[string]string
+	if opts != nil {
+		metadata = opts.Metadata
+	}
+
+	m.mu.RLock()
+	maxUploadSize := m.maxUploadSize
+	m.mu.RUnlock()
+
+	upload, err := media.NewUploadReader(data, fileType, opts, maxUploadSize)
+	if err != nil {
+		return "", err
+	}
+
+	buf, err := io.ReadAll(upload)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload file: %w", err)
+	}
+	if err := upload.Verify(opts); err != nil {
+		return "", err
+	}
+
+	object := &Object{
+		Data:        buf,
+		ContentType: upload.ContentType(),
+		Metadata:    upload.Metadata(metadata),
+		UploadedAt:  time.Now(),
+	}
+
+	m.mu.Lock()
+	m.objects[key] = object
+	m.mu.Unlock()
+
+	return key, nil
+}
+
+func (m *MemoryMedia) Download(ctx context.Context, fileType media.FileType, filename string) (io.ReadCloser, error) {
+	key, err := m.key(fileType, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	object, ok := m.objects[key]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("failed to get object: %w", media.ErrNotFound)
+	}
+
+	return io.NopCloser(bytes.NewReader(object.Data)), nil
+}
+
+func (m *MemoryMedia) DownloadRange(ctx context.Context, fileType media.FileType, filename string, offset int64, length int64) (io.ReadCloser, error) {
+	if offset < 0 || length < -1 {
+		return nil, media.ErrInvalidRange
+	}
+	object, err := m.lookup(fileType, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int64(len(object.Data))
+	if offset > 0 && offset >= size {
+		return nil, fmt.Errorf("failed to get object: %w", media.ErrInvalidRange)
+	}
+	end := size
+	if length >= 0 && offset+length < size {
+		end = offset + length
+	}
+
+	return io.NopCloser(bytes.NewReader(object.Data[offset:end])), nil
+}
+
+func (m *MemoryMedia) Stat(ctx context.Context, fileType media.FileType, filename string) (*media.FileInfo, error) {
+	object, err := m.lookup(fileType, filename)
+	if err != nil {
+		return nil, err
+	}
+	key, _ := m.key(fileType, filename)
+
+	metadata := make(map[string]string, len(object.Metadata))
+	for k, v := range object.Metadata {
+		metadata[strings.ToLower(k)] = v
+	}
+
+	return &media.FileInfo{
+		Key:          key,
+		Filename:     filename,
+		Size:         int64(len(object.Data)),
+		ContentType:  object.ContentType,
+		ETag:         partETag(object.Data),
+		Metadata:     metadata,
+		LastModified: object.UploadedAt,
+	}, nil
+}
+
+func (m *MemoryMedia) UpdateMetadata(ctx context.Context, fileType media.FileType, filename string, metadata map[string]string) error {
+	key, err := m.key(fileType, filename)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, ok := m.objects[key]
+	if !ok {
+		return fmt.Errorf("failed to update metadata: %w", media.ErrNotFound)
+	}
+
+	merged := make(map[string]string, len(obj.Metadata)+len(metadata))
+	for k, v := range obj.Metadata {
+		merged[strings.ToLower(k)] = v
+	}
+	for k, v := range metadata {
+		if v == "" {
+			delete(merged, strings.ToLower(k))
+		} else {
+			merged[strings.ToLower(k)] = v
+		}
+	}
+
+	// Objects are replaced rather than mutated, so readers holding the old one are unaffected
+	updated := *obj
+	updated.Metadata = merged
+	m.objects[key] = &updated
+	return nil
+}
+
+// lookup returns a stored object or an error wrapping media.ErrNotFound
+func (m *MemoryMedia) lookup(fileType media.FileType, filename string) (*Object, error) {
+	key, err := m.key(fileType, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	object, ok := m.objects[key]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("failed to get object: %w", media.ErrNotFound)
+	}
+	return object, nil
+}
+
+func (m *MemoryMedia) GetURL(ctx context.Context, fileType media.FileType, filename string, expiration time.Duration) (string, error) {
+	key, err := m.key(fileType, filename)
+	if err != nil {
+		return "", err
+	}
+
+	u := url.URL{Scheme: "memory", Path: "/" + key}
+	u.RawQuery = url.Values{"expires": {strconv.FormatInt(time.Now().Add(expiration).Unix(), 10)}}.Encode()
+	return u.String(), nil
+}
+
+func (m *MemoryMedia) GetCDNURL(ctx context.Context, fileType media.FileType, filename string, expiration time.Duration) (string, error) {
+	return m.GetURL(ctx, fileType, filename, expiration)
+}
+
+func (m *MemoryMedia) Delete(ctx context.Context, fileType media.FileType, filename string) error {
+	key, err := m.key(fileType, filename)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	delete(m.objects, key)
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *MemoryMedia) List(ctx context.Context, fileType media.FileType, prefix string, cursor string, limit int) (*media.ListPage, error) {
+	if limit <= 0 {
+		limit = 1000
+	}
+	dir := m.getDirName(fileType) + "/"
+
+	m.mu.RLock()
+	var filenames []string
+	for key := range m.objects {
+		filename, ok := strings.CutPrefix(key, dir)
+		if ok && strings.HasPrefix(filename, prefix) && filename > cursor {
+			filenames = append(filenames, filename)
+		}
+	}
+	m.mu.RUnlock()
+	sort.Strings(filenames)
+
+	page := &media.ListPage{}
+	if len(filenames) > limit {
+		filenames = filenames[:limit]
+		page.NextCursor = filenames[limit-1]
+	}
+	for _, filename := range filenames {
+		info, err := m.Stat(ctx, fileType, filename)
+		if err != nil {
+			continue
+		}
+		page.Files = append(page.Files, *info)
+	}
+
+	return page, nil
+}
+
+func (m *MemoryMedia) DeleteMany(ctx context.Context, fileType media.FileType, filenames []string) error {
+	failed := media.DeleteErrors{}
+	for _, filename := range filenames {
+		if err := m.Delete(ctx, fileType, filename); err != nil {
+			failed[filename] = err
+		}
+	}
+
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// Object returns a stored object for assertions, or nil if it does not exist
+func (m *MemoryMedia) Object(fileType media.FileType, filename string) *Object {
+	key, err := m.key(fileType, filename)
+	if err != nil {
+		return nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.objects[key]
+}
+
+// Len returns the number of stored objects
+func (m *MemoryMedia) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.objects)
+}
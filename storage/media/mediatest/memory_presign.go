@@ -0,0 +1,52 @@
+package mediatest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/weiawesome/wesio-live/storage/media"
+)
+
+func (m *MemoryMedia) GetUploadURL(ctx context.Context, fileType media.FileType, filename string, constraints media.UploadConstraints) (*media.PresignedUpload, error) {
+	key, err := m.key(fileType, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := constraints.ExpiresAt(time.Now())
+	u := url.URL{Scheme: "memory", Path: "/" + key}
+	return &media.PresignedUpload{
+		Method:    "POST",
+		URL:       u.String(),
+		Fields:    map[string]string{"key": key},
+		Key:       key,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (m *MemoryMedia) VerifyUpload(ctx context.Context, fileType media.FileType, filename string, constraints media.UploadConstraints) (*media.UploadedFile, error) {
+	key, err := m.key(fileType, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	object, ok := m.objects[key]
+	maxUploadSize := m.maxUploadSize
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("failed to verify upload: %w", media.ErrNotFound)
+	}
+
+	size := int64(len(object.Data))
+	contentType, err := media.CheckUploaded(fileType, constraints, maxUploadSize, size, object.ContentType, bytes.NewReader(object.Data))
+	if err != nil {
+		_ = m.Delete(ctx, fileType, filename)
+		return nil, err
+	}
+
+	return &media.UploadedFile{Key: key, Size: size, ContentType: contentType}, nil
+}
@@ -0,0 +1,206 @@
+package mediatest
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/weiawesome/wesio-live/storage/media"
+)
+
+// memorySession is an in-progress upload session of MemoryMedia
+type memorySession struct {
+	session  media.UploadSession
+	metadata map[string]string
+	parts    map[int][]byte
+}
+
+func (m *MemoryMedia) InitiateUpload(ctx context.Context, fileType media.FileType, filename string, size int64, opts *media.UploadOptions) (*media.UploadSession, error) {
+	if _, err := m.key(fileType, filename); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.maxUploadSize > 0 && size > m.maxUploadSize {
+		return nil, fmt.Errorf("%w: %d bytes", media.ErrTooLarge, size)
+	}
+	if size < 0 {
+		size = -1
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate session id: %w", err)
+	}
+
+	s := &memorySession{
+		session: media.UploadSession{
+			ID:        hex.EncodeToString(id),
+			FileType:  fileType,
+			Filename:  filename,
+			Size:      size,
+			CreatedAt: time.Now(),
+		},
+		parts: make(map[int][]byte),
+	}
+	if opts != nil {
+		s.session.ContentType = opts.ContentType
+		s.metadata = opts.Metadata
+	}
+	m.sessions[s.session.ID] = s
+
+	session := s.session
+	return &session, nil
+}
+
+func (m *MemoryMedia) GetUploadSession(ctx context.Context, sessionID string) (*media.UploadSession, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, media.ErrSessionNotFound
+	}
+	session := s.session
+	return &session, nil
+}
+
+func (m *MemoryMedia) UploadPart(ctx context.Context, sessionID string, partNumber int, data io.Reader, size int64) (*media.UploadPart, error) {
+	if partNumber < 1 || partNumber > media.MaxParts {
+		return nil, fmt.Errorf("%w: part number %d", media.ErrInvalidPart, partNumber)
+	}
+
+	session, err := m.GetUploadSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to upload part: %w", err)
+	}
+
+	if partNumber == 1 {
+		data, err = media.NewUploadReader(data, session.FileType, &media.UploadOptions{ContentType: session.ContentType}, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if size >= 0 {
+		data = io.LimitReader(data, size)
+	}
+
+	buf, err := io.ReadAll(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload part: %w", err)
+	}
+	if size >= 0 && int64(len(buf)) != size {
+		return nil, fmt.Errorf("%w: got %d of %d bytes", media.ErrInvalidPart, len(buf), size)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.maxUploadSize > 0 && int64(len(buf)) > m.maxUploadSize {
+		return nil, fmt.Errorf("%w: part %d exceeds %d bytes", media.ErrTooLarge, partNumber, m.maxUploadSize)
+	}
+	s, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, media.ErrSessionNotFound
+	}
+	s.parts[partNumber] = buf
+
+	return &media.UploadPart{Number: partNumber, Size: int64(len(buf)), ETag: partETag(buf)}, nil
+}
+
+func partETag(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *MemoryMedia) ListParts(ctx context.Context, sessionID string) ([]media.UploadPart, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, media.ErrSessionNotFound
+	}
+
+	parts := make([]media.UploadPart, 0, len(s.parts))
+	for number, data := range s.parts {
+		parts = append(parts, media.UploadPart{Number: number, Size: int64(len(data)), ETag: partETag(data)})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Number < parts[j].Number })
+	return parts, nil
+}
+
+func (m *MemoryMedia) CompleteUpload(ctx context.Context, sessionID string) (string, error) {
+	m.mu.RLock()
+	s, ok := m.sessions[sessionID]
+	if !ok {
+		m.mu.RUnlock()
+		return "", media.ErrSessionNotFound
+	}
+	numbers := make([]int, 0, len(s.parts))
+	for number := range s.parts {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	parts := make([][]byte, 0, len(numbers))
+	for _, number := range numbers {
+		parts = append(parts, s.parts[number])
+	}
+	session, metadata, maxUploadSize := s.session, s.metadata, m.maxUploadSize
+	m.mu.RUnlock()
+
+	if len(parts) == 0 {
+		return "", fmt.Errorf("%w: no parts uploaded", media.ErrUploadIncomplete)
+	}
+	var total int64
+	readers := make([]io.Reader, 0, len(parts))
+	for i, part := range parts {
+		if i < len(parts)-1 && len(part) < media.MinPartSize {
+			return "", fmt.Errorf("%w: part %d is %d bytes", media.ErrPartTooSmall, numbers[i], len(part))
+		}
+		total += int64(len(part))
+		readers = append(readers, bytes.NewReader(part))
+	}
+	if maxUploadSize > 0 && total > maxUploadSize {
+		return "", fmt.Errorf("%w: %d bytes", media.ErrTooLarge, total)
+	}
+	if session.Size >= 0 && total != session.Size {
+		return "", fmt.Errorf("%w: %d of %d bytes uploaded", media.ErrUploadIncomplete, total, session.Size)
+	}
+
+	key, err := m.Upload(ctx, session.FileType, session.Filename, io.MultiReader(readers...), &media.UploadOptions{
+		ContentType: session.ContentType,
+		Metadata:    metadata,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	delete(m.sessions, sessionID)
+	m.mu.Unlock()
+
+	return key, nil
+}
+
+func (m *MemoryMedia) AbortUpload(ctx context.Context, sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sessions[sessionID]; !ok {
+		return media.ErrSessionNotFound
+	}
+	delete(m.sessions, sessionID)
+	return nil
+}
@@ -0,0 +1,14 @@
+package mediatest_test
+
+import (
+	"testing"
+
+	"github.com/weiawesome/wesio-live/storage/media"
+	"github.com/weiawesome/wesio-live/storage/media/mediatest"
+)
+
+func TestMemoryMediaConformance(t *testing.T) {
+	mediatest.Run(t, func(t *testing.T) media.Media {
+		return mediatest.CreateMemoryMedia()
+	})
+}
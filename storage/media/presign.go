@@ -0,0 +1,128 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxPresignedUploadSize caps presigned uploads when neither the constraints nor the backend set a limit,
+// matching the largest single S3 PUT
+const maxPresignedUploadSize = 5 * 1024 * 1024 * 1024
+
+// DefaultUploadURLExpiration is how long a presigned upload is valid when the constraints set no expiration
+const DefaultUploadURLExpiration = 15 * time.Minute
+
+// ErrTooSmall is returned when a presigned upload is smaller than its minimum size
+var ErrTooSmall = errors.New("media: file below minimum upload size")
+
+// UploadConstraints restrict what a client may upload with a presigned upload
+type UploadConstraints struct {
+	Expiration   time.Duration // How long the upload URL is valid, 0 for DefaultUploadURLExpiration
+	MinSize      int64
+	MaxSize      int64    // 0 uses the backend's maximum upload size
+	ContentTypes []string // Allowed content types; empty allows any type matching the FileType
+}
+
+// PresignedUpload lets a client upload a file directly to storage with an HTML form style POST.
+// Fields must be sent as multipart form fields before the "file" field. When several content types
+// are allowed, the client replaces the Content-Type field with the actual type of the file.
+type PresignedUpload struct {
+	Method    string
+	URL       string
+	Fields    map[string]string
+	Key       string // Key the file will be stored under, as returned by Upload
+	ExpiresAt time.Time
+}
+
+// UploadedFile describes a file accepted by VerifyUpload
+type UploadedFile struct {
+	Key         string
+	Size        int64
+	ContentType string
+}
+
+// ExpiresAt returns when a presigned upload issued at now expires
+func (c UploadConstraints) ExpiresAt(now time.Time) time.Time {
+	if c.Expiration <= 0 {
+		return now.Add(DefaultUploadURLExpiration)
+	}
+	return now.Add(c.Expiration)
+}
+
+// maxSize returns the effective maximum size for a presigned upload
+func (c UploadConstraints) maxSize(backendMax int64) int64 {
+	switch {
+	case c.MaxSize > 0 && (backendMax <= 0 || c.MaxSize < backendMax):
+		return c.MaxSize
+	case backendMax > 0:
+		return backendMax
+	default:
+		return maxPresignedUploadSize
+	}
+}
+
+// contentTypePrefix returns the Content-Type prefix a form policy can enforce for a file type
+func contentTypePrefix(fileType FileType) string {
+	switch fileType {
+	case Image:
+		return "image/"
+	case Video:
+		return "video/"
+	default:
+		return ""
+	}
+}
+
+// allowsContentType reports whether contentType is permitted by the constraints
+func (c UploadConstraints) allowsContentType(contentType string) bool {
+	if len(c.ContentTypes) == 0 {
+		return true
+	}
+	base := baseMediaType(contentType)
+	for _, allowed := range c.ContentTypes {
+		if baseMediaType(allowed) == base {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckUploaded verifies a file uploaded with a presigned upload against its constraints and
+// returns its content type. head reads the start of the file, declared is the content type stored
+// with it and backendMax the backend's maximum upload size. Used by VerifyUpload implementations.
+func CheckUploaded(fileType FileType, c UploadConstraints, backendMax int64, size int64, declared string, head io.Reader) (string, error) {
+	if size > c.maxSize(backendMax) {
+		return "", fmt.Errorf("%w: %d bytes", ErrTooLarge, size)
+	}
+	if size < c.MinSize {
+		return "", fmt.Errorf("%w: %d bytes, minimum %d", ErrTooSmall, size, c.MinSize)
+	}
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(head, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("failed to read uploaded file: %w", err)
+	}
+
+	contentType, err := checkContentType(fileType, declared, http.DetectContentType(buf[:n]))
+	if err != nil {
+		return "", err
+	}
+	if !c.allowsContentType(contentType) {
+		return "", fmt.Errorf("%w: %s is not allowed", ErrContentMismatch, baseMediaType(contentType))
+	}
+
+	return contentType, nil
+}
+
+// singleContentType returns the only allowed content type, if exactly one is allowed
+func (c UploadConstraints) singleContentType() (string, bool) {
+	if len(c.ContentTypes) == 1 && strings.TrimSpace(c.ContentTypes[0]) != "" {
+		return c.ContentTypes[0], true
+	}
+	return "", false
+}
@@ -0,0 +1,548 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/weiawesome/wesio-live/libs/logger"
+)
+
+// ErrCircuitOpen is returned without calling the backend while the circuit breaker is open
+var ErrCircuitOpen = errors.New("media: circuit breaker open")
+
+// ResilientOptions configures ResilientMedia
+type ResilientOptions struct {
+	Timeout          time.Duration            // Per attempt timeout of operations that do not move file content
+	TransferTimeout  time.Duration            // Per attempt timeout of uploads, and of downloads until the body is returned
+	Timeouts         map[string]time.Duration // Per operation overrides keyed by method name, e.g. "Stat"
+	MaxAttempts      int                      // Attempts of idempotent operations, including the first
+	BaseDelay        time.Duration            // Backoff before the first retry, doubled for every further retry
+	MaxDelay         time.Duration            // Largest backoff; every backoff is jittered between zero and its value
+	FailureThreshold int                      // Consecutive failed attempts that open the circuit
+	OpenTimeout      time.Duration            // How long the circuit stays open before a probe is let through
+}
+
+// DefaultResilientOptions returns default timeout, retry and circuit breaker options
+func DefaultResilientOptions() ResilientOptions {
+	return ResilientOptions{
+		Timeout:          10 * time.Second,
+		TransferTimeout:  5 * time.Minute,
+		MaxAttempts:      3,
+		BaseDelay:        100 * time.Millisecond,
+		MaxDelay:         2 * time.Second,
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+	}
+}
+
+// ResilientMedia decorates a Media with per operation timeouts, retries of transient failures and a
+// circuit breaker. Idempotent operations are retried with jittered exponential backoff; uploads are
+// retried only when their data can seek back to where it started. Failures that retrying cannot fix,
+// such as ErrNotFound or validation errors, are returned at once and count as healthy responses.
+// After FailureThreshold consecutive transient failures every call fails with ErrCircuitOpen for
+// OpenTimeout, then a single probe decides whether the circuit closes or stays open.
+type ResilientMedia struct {
+	media   Media
+	opts    ResilientOptions
+	breaker *circuitBreaker
+}
+
+func CreateResilientMedia(m Media, opts ResilientOptions) *ResilientMedia {
+	defaults := DefaultResilientOptions()
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaults.Timeout
+	}
+	if opts.TransferTimeout <= 0 {
+		opts.TransferTimeout = defaults.TransferTimeout
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaults.MaxAttempts
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = defaults.BaseDelay
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = defaults.MaxDelay
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = defaults.FailureThreshold
+	}
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = defaults.OpenTimeout
+	}
+
+	return &ResilientMedia{
+		media:   m,
+		opts:    opts,
+		breaker: &circuitBreaker{threshold: opts.FailureThreshold, openTimeout: opts.OpenTimeout},
+	}
+}
+
+func (r *ResilientMedia) Upload(ctx context.Context, fileType FileType, filename string, data io.Reader, opts *UploadOptions) (string, error) {
+	rewind, retryable := rewinder(data)
+	source := &sourceReader{r: data}
+	var key string
+	err := r.call(ctx, "Upload", filename, retryable, func(ctx context.Context) error {
+		if err := rewind(); err != nil {
+			return err
+		}
+		var err error
+		key, err = r.media.Upload(ctx, fileType, filename, source, opts)
+		return source.check(err)
+	})
+	return key, err
+}
+
+func (r *ResilientMedia) Download(ctx context.Context, fileType FileType, filename string) (io.ReadCloser, error) {
+	return r.open(ctx, "Download", filename, func(ctx context.Context) (io.ReadCloser, error) {
+		return r.media.Download(ctx, fileType, filename)
+	})
+}
+
+func (r *ResilientMedia) DownloadRange(ctx context.Context, fileType FileType, filename string, offset int64, length int64) (io.ReadCloser, error) {
+	return r.open(ctx, "DownloadRange", filename, func(ctx context.Context) (io.ReadCloser, error) {
+		return r.media.DownloadRange(ctx, fileType, filename, offset, length)
+	})
+}
+
+func (r *ResilientMedia) Stat(ctx context.Context, fileType FileType, filename string) (*FileInfo, error) {
+	var info *FileInfo
+	err := r.call(ctx, "Stat", filename, true, func(ctx context.Context) error {
+		var err error
+		info, err = r.media.Stat(ctx, fileType, filename)
+		return err
+	})
+	return info, err
+}
+
+// UpdateMetadata is retried, since merging the same metadata again has no further effect
+func (r *ResilientMedia) UpdateMetadata(ctx context.Context, fileType FileType, filename string, metadata map[string]string) error {
+	return r.call(ctx, "UpdateMetadata", filename, true, func(ctx context.Context) error {
+		return r.media.UpdateMetadata(ctx, fileType, filename, metadata)
+	})
+}
+
+func (r *ResilientMedia) GetURL(ctx context.Context, fileType FileType, filename string, expiration time.Duration) (string, error) {
+	var url string
+	err := r.call(ctx, "GetURL", filename, true, func(ctx context.Context) error {
+		var err error
+		url, err = r.media.GetURL(ctx, fileType, filename, expiration)
+		return err
+	})
+	return url, err
+}
+
+func (r *ResilientMedia) GetCDNURL(ctx context.Context, fileType FileType, filename string, expiration time.Duration) (string, error) {
+	var url string
+	err := r.call(ctx, "GetCDNURL", filename, true, func(ctx context.Context) error {
+		var err error
+		url, err = r.media.GetCDNURL(ctx, fileType, filename, expiration)
+		return err
+	})
+	return url, err
+}
+
+func (r *ResilientMedia) Delete(ctx context.Context, fileType FileType, filename string) error {
+	return r.call(ctx, "Delete", filename, true, func(ctx context.Context) error {
+		return r.media.Delete(ctx, fileType, filename)
+	})
+}
+
+func (r *ResilientMedia) List(ctx context.Context, fileType FileType, prefix string, cursor string, limit int) (*ListPage, error) {
+	var page *ListPage
+	err := r.call(ctx, "List", prefix, true, func(ctx context.Context) error {
+		var err error
+		page, err = r.media.List(ctx, fileType, prefix, cursor, limit)
+		return err
+	})
+	return page, err
+}
+
+// DeleteMany retries only the files that failed to delete
+func (r *ResilientMedia) DeleteMany(ctx context.Context, fileType FileType, filenames []string) error {
+	pending := filenames
+	return r.call(ctx, "DeleteMany", "", true, func(ctx context.Context) error {
+		err := r.media.DeleteMany(ctx, fileType, pending)
+		var failed DeleteErrors
+		if errors.As(err, &failed) {
+			pending = make([]string, 0, len(failed))
+			for filename := range failed {
+				pending = append(pending, filename)
+			}
+		}
+		return err
+	})
+}
+
+// InitiateUpload is not retried, since every call starts a new session
+func (r *ResilientMedia) InitiateUpload(ctx context.Context, fileType FileType, filename string, size int64, opts *UploadOptions) (*UploadSession, error) {
+	var session *UploadSession
+	err := r.call(ctx, "InitiateUpload", filename, false, func(ctx context.Context) error {
+		var err error
+		session, err = r.media.InitiateUpload(ctx, fileType, filename, size, opts)
+		return err
+	})
+	return session, err
+}
+
+func (r *ResilientMedia) GetUploadSession(ctx context.Context, sessionID string) (*UploadSession, error) {
+	var session *UploadSession
+	err := r.call(ctx, "GetUploadSession", sessionID, true, func(ctx context.Context) error {
+		var err error
+		session, err = r.media.GetUploadSession(ctx, sessionID)
+		return err
+	})
+	return session, err
+}
+
+// UploadPart is retried when data can seek back, since storing a part again replaces it
+func (r *ResilientMedia) UploadPart(ctx context.Context, sessionID string, partNumber int, data io.Reader, size int64) (*UploadPart, error) {
+	rewind, retryable := rewinder(data)
+	source := &sourceReader{r: data}
+	var part *UploadPart
+	err := r.call(ctx, "UploadPart", sessionID, retryable, func(ctx context.Context) error {
+		if err := rewind(); err != nil {
+			return err
+		}
+		var err error
+		part, err = r.media.UploadPart(ctx, sessionID, partNumber, source, size)
+		return source.check(err)
+	})
+	return part, err
+}
+
+func (r *ResilientMedia) ListParts(ctx context.Context, sessionID string) ([]UploadPart, error) {
+	var parts []UploadPart
+	err := r.call(ctx, "ListParts", sessionID, true, func(ctx context.Context) error {
+		var err error
+		parts, err = r.media.ListParts(ctx, sessionID)
+		return err
+	})
+	return parts, err
+}
+
+// CompleteUpload is not retried, since a completed session no longer exists
+func (r *ResilientMedia) CompleteUpload(ctx context.Context, sessionID string) (string, error) {
+	var key string
+	err := r.call(ctx, "CompleteUpload", sessionID, false, func(ctx context.Context) error {
+		var err error
+		key, err = r.media.CompleteUpload(ctx, sessionID)
+		return err
+	})
+	return key, err
+}
+
+// AbortUpload is not retried, since an aborted session no longer exists
+func (r *ResilientMedia) AbortUpload(ctx context.Context, sessionID string) error {
+	return r.call(ctx, "AbortUpload", sessionID, false, func(ctx context.Context) error {
+		return r.media.AbortUpload(ctx, sessionID)
+	})
+}
+
+func (r *ResilientMedia) GetUploadURL(ctx context.Context, fileType FileType, filename string, constraints UploadConstraints) (*PresignedUpload, error) {
+	var upload *PresignedUpload
+	err := r.call(ctx, "GetUploadURL", filename, true, func(ctx context.Context) error {
+		var err error
+		upload, err = r.media.GetUploadURL(ctx, fileType, filename, constraints)
+		return err
+	})
+	return upload, err
+}
+
+// VerifyUpload is not retried, since a rejected file is deleted by the first attempt
+func (r *ResilientMedia) VerifyUpload(ctx context.Context, fileType FileType, filename string, constraints UploadConstraints) (*UploadedFile, error) {
+	var uploaded *UploadedFile
+	err := r.call(ctx, "VerifyUpload", filename, false, func(ctx context.Context) error {
+		var err error
+		uploaded, err = r.media.VerifyUpload(ctx, fileType, filename, constraints)
+		return err
+	})
+	return uploaded, err
+}
+
+// call runs fn like do, cancelling the context of the last attempt when it returns
+func (r *ResilientMedia) call(ctx context.Context, op string, filename string, idempotent bool, fn func(ctx context.Context) error) error {
+	cancel, err := r.do(ctx, op, filename, idempotent, fn)
+	if cancel != nil {
+		cancel()
+	}
+	return err
+}
+
+// open runs a download like do, keeping the context of the successful attempt alive until the body is closed
+func (r *ResilientMedia) open(ctx context.Context, op string, filename string, fn func(ctx context.Context) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	var body io.ReadCloser
+	cancel, err := r.do(ctx, op, filename, true, func(ctx context.Context) error {
+		var err error
+		body, err = fn(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cancelReadCloser{ReadCloser: body, cancel: cancel}, nil
+}
+
+// do runs fn through the circuit breaker with the timeout of op, retrying transient failures when
+// the operation is idempotent. The timeout covers each attempt until fn returns; on success the
+// attempt's context stays open and its cancel function is returned.
+func (r *ResilientMedia) do(ctx context.Context, op string, filename string, idempotent bool, fn func(ctx context.Context) error) (context.CancelFunc, error) {
+	attempts := 1
+	if idempotent {
+		attempts = r.opts.MaxAttempts
+	}
+	timeout := r.timeout(op)
+
+	for attempt := 1; ; attempt++ {
+		probe, err := r.breaker.allow()
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", op, filename, err)
+		}
+
+		attemptCtx, cancel := context.WithCancel(ctx)
+		timer := time.AfterFunc(timeout, cancel)
+		err = fn(attemptCtx)
+		timedOut := !timer.Stop()
+		if err == nil {
+			r.breaker.record(probe, outcomeHealthy)
+			return cancel, nil
+		}
+		cancel()
+		if timedOut && ctx.Err() == nil {
+			// The attempt failed because its context was cancelled, not because of the request
+			err = fmt.Errorf("%s timed out after %s: %w", op, timeout, context.DeadlineExceeded)
+		}
+
+		if !r.transient(ctx, err) {
+			outcome := outcomeHealthy
+			if ctx.Err() != nil {
+				outcome = outcomeAbandoned
+			}
+			r.breaker.record(probe, outcome)
+			return nil, err
+		}
+		r.breaker.record(probe, outcomeFailed)
+
+		data := map[string]interface{}{
+			"operation": op,
+			"filename":  filename,
+			"attempt":   attempt,
+			"attempts":  attempts,
+		}
+		if attempt >= attempts {
+			logger.Error("media", "resilient_call", "media operation failed", err, data)
+			return nil, err
+		}
+		delay := r.backoff(attempt)
+		data["error"] = err.Error()
+		data["retry_in"] = delay.String()
+		logger.Warn("media", "resilient_call", "media operation failed, retrying", data)
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// timeout returns the per attempt timeout of an operation
+func (r *ResilientMedia) timeout(op string) time.Duration {
+	if timeout := r.opts.Timeouts[op]; timeout > 0 {
+		return timeout
+	}
+	switch op {
+	case "Upload", "UploadPart", "CompleteUpload", "Download", "DownloadRange":
+		return r.opts.TransferTimeout
+	default:
+		return r.opts.Timeout
+	}
+}
+
+// backoff returns the jittered delay before retry number attempt
+func (r *ResilientMedia) backoff(attempt int) time.Duration {
+	delay := r.opts.MaxDelay
+	if shift := attempt - 1; shift < 32 {
+		delay = min(delay, r.opts.BaseDelay<<shift)
+	}
+	return time.Duration(rand.Int64N(int64(delay)) + 1)
+}
+
+// transient reports whether a failed attempt may succeed when retried. Failures after the caller
+// gave up, and failures caused by the request itself or by reading its data, are not transient.
+func (r *ResilientMedia) transient(ctx context.Context, err error) bool {
+	var source *sourceError
+	if ctx.Err() != nil || errors.As(err, &source) {
+		return false
+	}
+	for _, permanent := range []error{
+		ErrNotFound, ErrInvalidFilename, ErrInvalidRange, ErrTooLarge, ErrTooSmall, ErrContentMismatch,
+		ErrSessionNotFound, ErrPartTooSmall, ErrUploadIncomplete, ErrInvalidPart,
+		ErrEncryptionUnsupported, ErrDecryption, ErrCircuitOpen, context.Canceled,
+	} {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+
+	var response minio.ErrorResponse
+	if errors.As(err, &response) && response.StatusCode >= 400 && response.StatusCode < 500 {
+		return response.StatusCode == http.StatusRequestTimeout || response.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// rewinder returns a function seeking data back to its current offset before every attempt, and
+// whether attempts can be repeated at all
+func rewinder(data io.Reader) (func() error, bool) {
+	seeker, ok := data.(io.Seeker)
+	if !ok {
+		return func() error { return nil }, false
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return func() error { return nil }, false
+	}
+	return func() error {
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to rewind upload: %w", err)
+		}
+		return nil
+	}, true
+}
+
+// sourceReader records the error of the caller's upload data, such as a client disconnect or an
+// exceeded size limit, so the failure is not blamed on the backend
+type sourceReader struct {
+	r   io.Reader
+	err error
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF {
+		s.err = err
+	}
+	return n, err
+}
+
+// check marks err as a sourceError when reading the data failed, keeping the read error in its chain
+func (s *sourceReader) check(err error) error {
+	if err == nil || s.err == nil {
+		return err
+	}
+	if !errors.Is(err, s.err) {
+		err = fmt.Errorf("failed to read upload: %w", s.err)
+	}
+	return &sourceError{err: err}
+}
+
+// sourceError is a failure to read the caller's upload data, which retrying cannot fix and which
+// says nothing about the health of the backend
+type sourceError struct {
+	err error
+}
+
+func (e *sourceError) Error() string { return e.err.Error() }
+func (e *sourceError) Unwrap() error { return e.err }
+
+// cancelReadCloser cancels the context of the download when the body is closed
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelReadCloser) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// attemptOutcome is how an attempt reflects on the health of the backend
+type attemptOutcome int
+
+const (
+	outcomeHealthy   attemptOutcome = iota // Succeeded, or failed because of the request
+	outcomeFailed                          // Failed transiently
+	outcomeAbandoned                       // The caller gave up; says nothing about the backend
+)
+
+// circuitBreaker opens after threshold consecutive failures and lets a single probe through once
+// openTimeout has passed
+type circuitBreaker struct {
+	threshold   int
+	openTimeout time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// allow reports whether a call may proceed, and whether it is the probe of a half-open circuit
+func (b *circuitBreaker) allow() (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return false, ErrCircuitOpen
+		}
+		b.state = breakerHalfOpen
+		fallthrough
+	case breakerHalfOpen:
+		if b.probing {
+			return false, ErrCircuitOpen
+		}
+		b.probing = true
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// record updates the breaker with the outcome of an allowed call
+func (b *circuitBreaker) record(probe bool, outcome attemptOutcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+	}
+	switch outcome {
+	case outcomeHealthy:
+		b.failures = 0
+		if b.state != breakerClosed {
+			b.state = breakerClosed
+			logger.Info("media", "circuit_breaker", "circuit closed", nil)
+		}
+	case outcomeFailed:
+		b.failures++
+		if probe || (b.state == breakerClosed && b.failures >= b.threshold) {
+			b.state = breakerOpen
+			b.openedAt = time.Now()
+			logger.Warn("media", "circuit_breaker", "circuit opened", map[string]interface{}{
+				"failures": b.failures,
+				"open_for": b.openTimeout.String(),
+				"probe":    probe,
+			})
+		}
+	}
+}
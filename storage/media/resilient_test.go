@@ -0,0 +1,211 @@
+package media_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/weiawesome/wesio-live/storage/media"
+	"github.com/weiawesome/wesio-live/storage/media/mediatest"
+)
+
+var errUnavailable = errors.New("backend unavailable")
+
+// flakyMedia fails Stat with queued errors before passing calls to the memory backend
+type flakyMedia struct {
+	media.Media
+
+	mu    sync.Mutex
+	calls int
+	errs  []error
+	block bool // Stat waits for its context to end
+}
+
+func newFlakyMedia() *flakyMedia {
+	return &flakyMedia{Media: mediatest.CreateMemoryMedia()}
+}
+
+func (f *flakyMedia) fail(errs ...error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs = append(f.errs, errs...)
+}
+
+func (f *flakyMedia) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func (f *flakyMedia) Stat(ctx context.Context, fileType media.FileType, filename string) (*media.FileInfo, error) {
+	f.mu.Lock()
+	f.calls++
+	block := f.block
+	var err error
+	if len(f.errs) > 0 {
+		err, f.errs = f.errs[0], f.errs[1:]
+	}
+	f.mu.Unlock()
+
+	if block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f.Media.Stat(ctx, fileType, filename)
+}
+
+func (f *flakyMedia) Upload(ctx context.Context, fileType media.FileType, filename string, data io.Reader, opts *media.UploadOptions) (string, error) {
+	f.mu.Lock()
+	f.calls++
+	f.mu.Unlock()
+	return f.Media.Upload(ctx, fileType, filename, data, opts)
+}
+
+// brokenReader is seekable upload data whose reads fail, like a client that disconnected
+type brokenReader struct {
+	io.ReadSeeker
+	err error
+}
+
+func (b *brokenReader) Read(p []byte) (int, error) { return 0, b.err }
+
+func resilientOptions() media.ResilientOptions {
+	return media.ResilientOptions{
+		Timeout:          time.Second,
+		MaxAttempts:      3,
+		BaseDelay:        time.Millisecond,
+		MaxDelay:         time.Millisecond,
+		FailureThreshold: 2,
+		OpenTimeout:      50 * time.Millisecond,
+	}
+}
+
+func storeFile(t *testing.T, m media.Media, filename string) {
+	t.Helper()
+	if _, err := m.Upload(context.Background(), "", filename, bytes.NewReader([]byte("content")), nil); err != nil {
+		t.Fatalf("failed to store %s: %v", filename, err)
+	}
+}
+
+func TestResilientRetriesTransientErrors(t *testing.T) {
+	ctx := context.Background()
+	backend := newFlakyMedia()
+	storeFile(t, backend.Media, "a.txt")
+	opts := resilientOptions()
+	opts.FailureThreshold = 10
+	m := media.CreateResilientMedia(backend, opts)
+
+	backend.fail(errUnavailable, errUnavailable)
+	if _, err := m.Stat(ctx, "", "a.txt"); err != nil {
+		t.Fatalf("Stat after two transient failures: %v", err)
+	}
+	if calls := backend.Calls(); calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls)
+	}
+
+	backend.fail(errUnavailable, errUnavailable, errUnavailable)
+	if _, err := m.Stat(ctx, "", "a.txt"); !errors.Is(err, errUnavailable) {
+		t.Fatalf("expected the last transient error once attempts run out, got %v", err)
+	}
+	if calls := backend.Calls(); calls != 6 {
+		t.Fatalf("expected 3 more attempts, got %d", calls-3)
+	}
+
+	if _, err := m.Stat(ctx, "", "missing.txt"); !errors.Is(err, media.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if calls := backend.Calls(); calls != 7 {
+		t.Fatalf("expected ErrNotFound not to be retried, got %d attempts", calls-6)
+	}
+}
+
+func TestResilientTimeout(t *testing.T) {
+	backend := newFlakyMedia()
+	backend.block = true
+	opts := resilientOptions()
+	opts.Timeouts = map[string]time.Duration{"Stat": 20 * time.Millisecond}
+	opts.MaxAttempts = 2
+	opts.FailureThreshold = 10
+	m := media.CreateResilientMedia(backend, opts)
+
+	start := time.Now()
+	_, err := m.Stat(context.Background(), "", "a.txt")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("timed out attempts took %s", elapsed)
+	}
+	if calls := backend.Calls(); calls != 2 {
+		t.Fatalf("expected timed out attempts to be retried, got %d attempts", calls)
+	}
+}
+
+func TestResilientCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	backend := newFlakyMedia()
+	storeFile(t, backend.Media, "a.txt")
+	opts := resilientOptions()
+	opts.MaxAttempts = 1
+	m := media.CreateResilientMedia(backend, opts)
+
+	backend.fail(errUnavailable, errUnavailable)
+	for i := 0; i < 2; i++ {
+		if _, err := m.Stat(ctx, "", "a.txt"); !errors.Is(err, errUnavailable) {
+			t.Fatalf("attempt %d: expected the backend error, got %v", i, err)
+		}
+	}
+	if _, err := m.Stat(ctx, "", "a.txt"); !errors.Is(err, media.ErrCircuitOpen) {
+		t.Fatalf("expected the circuit to open after 2 failures, got %v", err)
+	}
+	if calls := backend.Calls(); calls != 2 {
+		t.Fatalf("expected an open circuit not to call the backend, got %d calls", calls)
+	}
+
+	// A failed probe opens the circuit again
+	time.Sleep(opts.OpenTimeout)
+	backend.fail(errUnavailable)
+	if _, err := m.Stat(ctx, "", "a.txt"); !errors.Is(err, errUnavailable) {
+		t.Fatalf("expected the probe to reach the backend, got %v", err)
+	}
+	if _, err := m.Stat(ctx, "", "a.txt"); !errors.Is(err, media.ErrCircuitOpen) {
+		t.Fatalf("expected a failed probe to reopen the circuit, got %v", err)
+	}
+
+	// A successful probe closes it
+	time.Sleep(opts.OpenTimeout)
+	for i := 0; i < 3; i++ {
+		if _, err := m.Stat(ctx, "", "a.txt"); err != nil {
+			t.Fatalf("call %d after a successful probe: %v", i, err)
+		}
+	}
+}
+
+func TestResilientCallerReadErrorsKeepCircuitClosed(t *testing.T) {
+	ctx := context.Background()
+	backend := newFlakyMedia()
+	storeFile(t, backend.Media, "a.txt")
+	opts := resilientOptions()
+	opts.FailureThreshold = 1
+	m := media.CreateResilientMedia(backend, opts)
+
+	errDisconnected := errors.New("client disconnected")
+	data := &brokenReader{ReadSeeker: bytes.NewReader(nil), err: errDisconnected}
+	if _, err := m.Upload(ctx, "", "b.txt", data, nil); !errors.Is(err, errDisconnected) {
+		t.Fatalf("expected the read error, got %v", err)
+	}
+	if calls := backend.Calls(); calls != 1 {
+		t.Fatalf("expected a read error not to be retried, got %d attempts", calls)
+	}
+
+	if _, err := m.Stat(ctx, "", "a.txt"); err != nil {
+		t.Fatalf("expected the circuit to stay closed after a read error, got %v", err)
+	}
+}
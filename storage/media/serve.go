@@ -0,0 +1,226 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServeOptions configures a ServeHandler
+type ServeOptions struct {
+	// BasePath is the path the handler is mounted at. Files are served at BasePath/<images|videos|files>/<filename>.
+	BasePath string
+	// CacheControl is sent with every successful response. Defaults to "private, max-age=3600".
+	CacheControl string
+}
+
+// ServeHandler returns an http.Handler serving files from any backend with support for
+// Range, If-Range, If-None-Match and If-Modified-Since. Files that are not images, videos or audio are
+// served as attachments. Access control is left to middleware.
+func ServeHandler(m Media, opts ServeOptions) http.Handler {
+	opts.BasePath = strings.TrimSuffix(opts.BasePath, "/")
+	if opts.CacheControl == "" {
+		opts.CacheControl = "private, max-age=3600"
+	}
+	return &serveHandler{media: m, opts: opts}
+}
+
+type serveHandler struct {
+	media Media
+	opts  ServeOptions
+}
+
+func (h *serveHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	relative, ok := strings.CutPrefix(r.URL.Path, h.opts.BasePath+"/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	dir, filename, ok := strings.Cut(relative, "/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	fileType, ok := fileTypeFromDirName(dir)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	info, err := h.media.Stat(r.Context(), fileType, filename)
+	if err != nil {
+		writeServeError(w, err)
+		return
+	}
+
+	etag := `"` + info.ETag + `"`
+	header := w.Header()
+	setContentHeaders(header, info.ContentType)
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("Cache-Control", h.opts.CacheControl)
+	if info.ETag != "" {
+		header.Set("ETag", etag)
+	}
+	if !info.LastModified.IsZero() {
+		header.Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, info, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	offset, length, partial, err := requestRange(r, info, etag)
+	if err != nil {
+		header.Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+		http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	header.Set("Content-Length", strconv.FormatInt(length, 10))
+	status := http.StatusOK
+	if partial {
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, info.Size))
+		status = http.StatusPartialContent
+	}
+
+	if r.Method == http.MethodHead || length == 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	body, err := h.media.DownloadRange(r.Context(), fileType, filename, offset, length)
+	if err != nil {
+		header.Del("Content-Length")
+		header.Del("Content-Range")
+		writeServeError(w, err)
+		return
+	}
+	defer body.Close()
+
+	w.WriteHeader(status)
+	io.Copy(w, body)
+}
+
+// setContentHeaders sets the content type of a served file. Browsers are told not to sniff it, and only
+// image, video and audio files other than SVG are displayed inline, so uploaded HTML, SVG or scripts
+// are downloaded instead of running in the origin serving them.
+func setContentHeaders(header http.Header, contentType string) {
+	header.Set("X-Content-Type-Options", "nosniff")
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	base := baseMediaType(contentType)
+	major, _, _ := strings.Cut(base, "/")
+	if !isMediaMajorType(major) || base == "image/svg+xml" {
+		header.Set("Content-Disposition", "attachment")
+	}
+}
+
+// notModified evaluates If-None-Match, falling back to If-Modified-Since as RFC 9110 requires
+func notModified(r *http.Request, info *FileInfo, etag string) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if info.ETag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !info.LastModified.IsZero() {
+		since, err := http.ParseTime(ims)
+		if err == nil && !info.LastModified.Truncate(time.Second).After(since) {
+			return true
+		}
+	}
+	return false
+}
+
+// errRangeNotSatisfiable is returned for ranges starting past the end of the file
+var errRangeNotSatisfiable = errors.New("requested range not satisfiable")
+
+// requestRange returns the byte range to serve. Multiple ranges, malformed ranges and ranges with a
+// non-matching If-Range are ignored and the whole file is served.
+func requestRange(r *http.Request, info *FileInfo, etag string) (offset int64, length int64, partial bool, err error) {
+	spec, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, info.Size, false, nil
+	}
+
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" {
+		if strings.HasPrefix(ifRange, `"`) {
+			if ifRange != etag {
+				return 0, info.Size, false, nil
+			}
+		} else if since, err := http.ParseTime(ifRange); err != nil || info.LastModified.Truncate(time.Second).After(since) {
+			return 0, info.Size, false, nil
+		}
+	}
+
+	startSpec, endSpec, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, info.Size, false, nil
+	}
+
+	if startSpec == "" {
+		// Suffix range: the last n bytes
+		n, err := strconv.ParseInt(endSpec, 10, 64)
+		if err != nil || n < 0 {
+			return 0, info.Size, false, nil
+		}
+		if n == 0 || info.Size == 0 {
+			return 0, 0, false, errRangeNotSatisfiable
+		}
+		n = min(n, info.Size)
+		return info.Size - n, n, true, nil
+	}
+
+	start, err := strconv.ParseInt(startSpec, 10, 64)
+	if err != nil || start < 0 {
+		return 0, info.Size, false, nil
+	}
+	if start >= info.Size {
+		return 0, 0, false, errRangeNotSatisfiable
+	}
+
+	end := info.Size - 1
+	if endSpec != "" {
+		end, err = strconv.ParseInt(endSpec, 10, 64)
+		if err != nil || end < start {
+			return 0, info.Size, false, nil
+		}
+		end = min(end, info.Size-1)
+	}
+
+	return start, end - start + 1, true, nil
+}
+
+// writeServeError maps media errors to HTTP status codes
+func writeServeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	case errors.Is(err, ErrInvalidFilename):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrInvalidRange):
+		http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,124 @@
+package media
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// MinPartSize is the smallest size allowed for every part of an upload session except the last,
+// matching the S3 multipart minimum
+const MinPartSize = 5 * 1024 * 1024
+
+// MaxParts is the largest part number accepted by UploadPart
+const MaxParts = 10000
+
+// DefaultSessionTTL is how long backends that keep session state themselves hold an unfinished upload session
+const DefaultSessionTTL = 24 * time.Hour
+
+var (
+	// ErrSessionNotFound is returned when an upload session does not exist, or was completed or aborted
+	ErrSessionNotFound = errors.New("media: upload session not found")
+	// ErrPartTooSmall is returned when completing a session whose non-final parts are below MinPartSize
+	ErrPartTooSmall = errors.New("media: upload part too small")
+	// ErrUploadIncomplete is returned when completing a session that has fewer bytes than declared
+	ErrUploadIncomplete = errors.New("media: upload incomplete")
+	// ErrInvalidPart is returned for part numbers outside 1..MaxParts or parts shorter than their declared size
+	ErrInvalidPart = errors.New("media: invalid upload part")
+)
+
+// UploadSession is a resumable upload created by InitiateUpload.
+// Parts are uploaded independently, then CompleteUpload assembles them into a single file.
+type UploadSession struct {
+	ID          string // Opaque identifier passed to the other session methods
+	FileType    FileType
+	Filename    string
+	ContentType string
+	Size        int64 // Declared total size, -1 if unknown
+	CreatedAt   time.Time
+}
+
+// UploadPart is a part stored in an upload session
+type UploadPart struct {
+	Number int
+	Size   int64
+	ETag   string
+}
+
+// newSessionID returns a random session identifier
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate session id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validatePartNumber checks a part number is within 1..MaxParts
+func validatePartNumber(partNumber int) error {
+	if partNumber < 1 || partNumber > MaxParts {
+		return fmt.Errorf("%w: part number %d", ErrInvalidPart, partNumber)
+	}
+	return nil
+}
+
+// checkParts sorts parts by number and verifies they can be assembled into a file
+// of the declared size no larger than maxSize (<= 0 for unlimited)
+func checkParts(parts []UploadPart, declaredSize int64, maxSize int64) (int64, error) {
+	if len(parts) == 0 {
+		return 0, fmt.Errorf("%w: no parts uploaded", ErrUploadIncomplete)
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Number < parts[j].Number })
+
+	var total int64
+	for i, part := range parts {
+		if i < len(parts)-1 && part.Size < MinPartSize {
+			return 0, fmt.Errorf("%w: part %d is %d bytes", ErrPartTooSmall, part.Number, part.Size)
+		}
+		total += part.Size
+	}
+
+	if maxSize > 0 && total > maxSize {
+		return 0, fmt.Errorf("%w: %d bytes", ErrTooLarge, total)
+	}
+	if declaredSize >= 0 && total != declaredSize {
+		return 0, fmt.Errorf("%w: %d of %d bytes uploaded", ErrUploadIncomplete, total, declaredSize)
+	}
+
+	return total, nil
+}
+
+// partReader limits a part to its declared size and fails if the stream ends early.
+// size < 0 reads until EOF.
+func partReader(data io.Reader, size int64) io.Reader {
+	if size < 0 {
+		return data
+	}
+	return &exactReader{r: io.LimitReader(data, size), remaining: size}
+}
+
+type exactReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (e *exactReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	e.remaining -= int64(n)
+	if err == io.EOF && e.remaining > 0 {
+		return n, fmt.Errorf("%w: %v", ErrInvalidPart, io.ErrUnexpectedEOF)
+	}
+	return n, err
+}
+
+// sniffFirstPart validates the content of the first part against the session's file type
+func sniffFirstPart(session *UploadSession, partNumber int, data io.Reader) (io.Reader, error) {
+	if partNumber != 1 {
+		return data, nil
+	}
+	return NewUploadReader(data, session.FileType, &UploadOptions{ContentType: session.ContentType}, 0)
+}
@@ -0,0 +1,309 @@
+package media
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// TusVersion is the tus resumable upload protocol version implemented by TusHandler
+const TusVersion = "1.0.0"
+
+// TusOptions configures a TusHandler
+type TusOptions struct {
+	// BasePath is the path the handler is mounted at, e.g. /uploads. Upload URLs are BasePath/<session id>.
+	BasePath string
+	// MaxSize is the largest upload accepted, advertised as Tus-Max-Size. 0 for unlimited.
+	MaxSize int64
+	// Target decides where an upload is stored from the request and its tus Upload-Metadata.
+	// Defaults to DefaultTusTarget.
+	Target func(r *http.Request, metadata map[string]string) (FileType, string, error)
+	// OnComplete is called after the last chunk has been received and the file assembled
+	OnComplete func(r *http.Request, session *UploadSession, key string)
+}
+
+// DefaultTusTarget picks the file type from the "filetype" metadata sent by tus clients
+// and stores the upload under a random name keeping the extension of "filename"
+func DefaultTusTarget(r *http.Request, metadata map[string]string) (FileType, string, error) {
+	var fileType FileType
+	switch {
+	case strings.HasPrefix(metadata["filetype"], "image/"):
+		fileType = Image
+	case strings.HasPrefix(metadata["filetype"], "video/"):
+		fileType = Video
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate filename: %w", err)
+	}
+
+	ext := strings.ToLower(path.Ext(metadata["filename"]))
+	if !isSafeExtension(ext) {
+		ext = ""
+	}
+
+	return fileType, hex.EncodeToString(b) + ext, nil
+}
+
+// isSafeExtension reports whether ext is a short alphanumeric extension such as ".mp4"
+func isSafeExtension(ext string) bool {
+	if len(ext) < 2 || len(ext) > 10 {
+		return false
+	}
+	for _, r := range ext[1:] {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// TusHandler returns an http.Handler implementing the tus core protocol with the creation and
+// termination extensions on top of the upload session API. Authentication is left to middleware.
+//
+// Every PATCH is stored as one part, so clients must send chunks of at least MinPartSize except the
+// last one (tus-js-client: chunkSize). A PATCH interrupted mid-body is discarded and the client
+// resumes from the end of the previous chunk.
+func TusHandler(m Media, opts TusOptions) http.Handler {
+	if opts.Target == nil {
+		opts.Target = DefaultTusTarget
+	}
+	opts.BasePath = strings.TrimSuffix(opts.BasePath, "/")
+	return &tusHandler{media: m, opts: opts}
+}
+
+type tusHandler struct {
+	media Media
+	opts  TusOptions
+}
+
+func (h *tusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", TusVersion)
+
+	method := r.Method
+	if override := r.Header.Get("X-HTTP-Method-Override"); override != "" && method == http.MethodPost {
+		method = override
+	}
+
+	if method == http.MethodOptions {
+		w.Header().Set("Tus-Version", TusVersion)
+		w.Header().Set("Tus-Extension", "creation,termination")
+		if h.opts.MaxSize > 0 {
+			w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.opts.MaxSize, 10))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Header.Get("Tus-Resumable") != TusVersion {
+		w.Header().Set("Tus-Version", TusVersion)
+		http.Error(w, "unsupported tus version", http.StatusPreconditionFailed)
+		return
+	}
+
+	relative, ok := strings.CutPrefix(r.URL.Path, h.opts.BasePath)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	sessionID := strings.Trim(relative, "/")
+	if strings.Contains(sessionID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case sessionID == "" && method == http.MethodPost:
+		h.create(w, r)
+	case sessionID != "" && method == http.MethodHead:
+		h.head(w, r, sessionID)
+	case sessionID != "" && method == http.MethodPatch:
+		h.patch(w, r, sessionID)
+	case sessionID != "" && method == http.MethodDelete:
+		h.terminate(w, r, sessionID)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *tusHandler) create(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		http.Error(w, "deferred upload length is not supported", http.StatusBadRequest)
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		http.Error(w, "invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+	if h.opts.MaxSize > 0 && length > h.opts.MaxSize {
+		http.Error(w, ErrTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileType, filename, err := h.opts.Target(r, metadata)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.media.InitiateUpload(r.Context(), fileType, filename, length, &UploadOptions{
+		ContentType: metadata["filetype"],
+	})
+	if err != nil {
+		writeTusError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", h.opts.BasePath+"/"+session.ID)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// offset returns the session and the number of bytes stored so far
+func (h *tusHandler) offset(r *http.Request, sessionID string) (*UploadSession, []UploadPart, int64, error) {
+	session, err := h.media.GetUploadSession(r.Context(), sessionID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	parts, err := h.media.ListParts(r.Context(), sessionID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	var offset int64
+	for _, part := range parts {
+		offset += part.Size
+	}
+	return session, parts, offset, nil
+}
+
+func (h *tusHandler) head(w http.ResponseWriter, r *http.Request, sessionID string) {
+	session, _, offset, err := h.offset(r, sessionID)
+	if err != nil {
+		writeTusError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	if session.Size >= 0 {
+		w.Header().Set("Upload-Length", strconv.FormatInt(session.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *tusHandler) patch(w http.ResponseWriter, r *http.Request, sessionID string) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+	if r.ContentLength < 0 {
+		http.Error(w, http.StatusText(http.StatusLengthRequired), http.StatusLengthRequired)
+		return
+	}
+	requestOffset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || requestOffset < 0 {
+		http.Error(w, "invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	session, parts, offset, err := h.offset(r, sessionID)
+	if err != nil {
+		writeTusError(w, err)
+		return
+	}
+	if requestOffset != offset {
+		http.Error(w, "Upload-Offset does not match the current offset", http.StatusConflict)
+		return
+	}
+
+	newOffset := offset + r.ContentLength
+	if newOffset > session.Size {
+		http.Error(w, "chunk exceeds Upload-Length", http.StatusBadRequest)
+		return
+	}
+	if newOffset < session.Size && r.ContentLength < MinPartSize {
+		http.Error(w, fmt.Sprintf("chunks other than the last must be at least %d bytes", MinPartSize), http.StatusBadRequest)
+		return
+	}
+
+	if r.ContentLength > 0 {
+		if _, err := h.media.UploadPart(r.Context(), sessionID, len(parts)+1, r.Body, r.ContentLength); err != nil {
+			writeTusError(w, err)
+			return
+		}
+	}
+
+	if newOffset == session.Size {
+		key, err := h.media.CompleteUpload(r.Context(), sessionID)
+		if err != nil {
+			writeTusError(w, err)
+			return
+		}
+		if h.opts.OnComplete != nil {
+			h.opts.OnComplete(r, session, key)
+		}
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(newOffset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *tusHandler) terminate(w http.ResponseWriter, r *http.Request, sessionID string) {
+	if err := h.media.AbortUpload(r.Context(), sessionID); err != nil {
+		writeTusError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeTusError maps media errors to tus status codes
+func writeTusError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrSessionNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, ErrContentMismatch):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	case errors.Is(err, ErrInvalidFilename), errors.Is(err, ErrInvalidPart),
+		errors.Is(err, ErrPartTooSmall), errors.Is(err, ErrUploadIncomplete):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// parseTusMetadata decodes an Upload-Metadata header: comma-separated "key base64(value)" pairs
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("invalid Upload-Metadata")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Upload-Metadata value for %q", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
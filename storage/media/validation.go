@@ -0,0 +1,217 @@
+package media
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// sniffLen is the number of leading bytes inspected by http.DetectContentType
+const sniffLen = 512
+
+// Metadata keys recorded for every validated upload
+const (
+	MetadataSize     = "size"
+	MetadataChecksum = "sha256"
+)
+
+var (
+	// ErrTooLarge is returned when an upload exceeds the configured maximum size
+	ErrTooLarge = errors.New("media: file exceeds maximum upload size")
+	// ErrContentMismatch is returned when the sniffed content does not match the FileType or declared content type
+	ErrContentMismatch = errors.New("media: content does not match declared type")
+)
+
+// UploadReader validates an upload stream while it is read.
+// The content type is sniffed and checked when the reader is created, the size limit is enforced
+// while reading, and the size and SHA-256 checksum are available once the stream is exhausted.
+type UploadReader struct {
+	r           *bufio.Reader
+	maxSize     int64
+	size        int64
+	hash        hash.Hash
+	contentType string
+}
+
+// NewUploadReader sniffs the first bytes of data and rejects content that does not match fileType
+// or opts.ContentType. maxSize <= 0 disables the size limit.
+func NewUploadReader(data io.Reader, fileType FileType, opts *UploadOptions, maxSize int64) (*UploadReader, error) {
+	r := bufio.NewReaderSize(data, sniffLen)
+	head, err := r.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	declared := ""
+	if opts != nil {
+		declared = opts.ContentType
+	}
+	sniffed := http.DetectContentType(head)
+
+	contentType, err := checkContentType(fileType, declared, sniffed)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UploadReader{
+		r:           r,
+		maxSize:     maxSize,
+		hash:        sha256.New(),
+		contentType: contentType,
+	}, nil
+}
+
+func (u *UploadReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	u.size += int64(n)
+	if u.maxSize > 0 && u.size > u.maxSize {
+		return 0, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, u.maxSize)
+	}
+	u.hash.Write(p[:n])
+	return n, err
+}
+
+// ContentType returns the declared content type, or the sniffed one when none was declared
+func (u *UploadReader) ContentType() string {
+	return u.contentType
+}
+
+// Size returns the number of bytes read so far
+func (u *UploadReader) Size() int64 {
+	return u.size
+}
+
+// Checksum returns the hex SHA-256 of the bytes read so far
+func (u *UploadReader) Checksum() string {
+	return hex.EncodeToString(u.hash.Sum(nil))
+}
+
+// Metadata returns a copy of metadata with the size and checksum of the upload added
+func (u *UploadReader) Metadata(metadata map[string]string) map[string]string {
+	return uploadMetadata(metadata, u.size, u.Checksum())
+}
+
+// Verify checks the bytes read against the size and checksum declared in opts, if any
+func (u *UploadReader) Verify(opts *UploadOptions) error {
+	if opts == nil {
+		return nil
+	}
+	if opts.Size > 0 && u.size != opts.Size {
+		return fmt.Errorf("%w: declared %d bytes but read %d", ErrContentMismatch, opts.Size, u.size)
+	}
+	if opts.Checksum != "" && !strings.EqualFold(u.Checksum(), opts.Checksum) {
+		return fmt.Errorf("%w: checksum does not match the declared checksum", ErrContentMismatch)
+	}
+	return nil
+}
+
+// declaresContent reports whether opts carries both the size and checksum of the upload
+func declaresContent(opts *UploadOptions) bool {
+	return opts != nil && opts.Size > 0 && opts.Checksum != ""
+}
+
+// uploadMetadata returns a copy of metadata with the size and checksum added
+func uploadMetadata(metadata map[string]string, size int64, checksum string) map[string]string {
+	out := make(map[string]string, len(metadata)+2)
+	for k, v := range metadata {
+		out[k] = v
+	}
+	out[MetadataSize] = strconv.FormatInt(size, 10)
+	out[MetadataChecksum] = strings.ToLower(checksum)
+	return out
+}
+
+// checkContentType validates the sniffed type against the file type and declared type,
+// returning the content type to store
+func checkContentType(fileType FileType, declared string, sniffed string) (string, error) {
+	sniffedBase := baseMediaType(sniffed)
+	sniffedMajor, _, _ := strings.Cut(sniffedBase, "/")
+	generic := sniffedBase == "application/octet-stream"
+	declaredBase := baseMediaType(declared)
+
+	switch fileType {
+	case Image:
+		if sniffedMajor != "image" {
+			return "", fmt.Errorf("%w: %s upload sniffed as %s", ErrContentMismatch, fileType, sniffedBase)
+		}
+	case Video:
+		// Streaming manifests are text, and containers such as MPEG-TS and fragmented MP4
+		// segments are not recognised by the sniffer
+		if streamingManifestTypes[declaredBase] {
+			if sniffedMajor != "text" {
+				return "", fmt.Errorf("%w: declared %s but sniffed %s", ErrContentMismatch, declaredBase, sniffedBase)
+			}
+			return declared, nil
+		}
+		if sniffedMajor != "video" && !generic {
+			return "", fmt.Errorf("%w: %s upload sniffed as %s", ErrContentMismatch, fileType, sniffedBase)
+		}
+	}
+
+	if declaredBase == "" || declaredBase == "application/octet-stream" {
+		return checkActiveContent(fileType, sniffed)
+	}
+
+	// Only media types can be told apart reliably; other text and application types are left to the caller
+	declaredMajor, _, _ := strings.Cut(declaredBase, "/")
+	if !generic && (isMediaMajorType(declaredMajor) || isMediaMajorType(sniffedMajor)) && declaredBase != sniffedBase {
+		return "", fmt.Errorf("%w: declared %s but sniffed %s", ErrContentMismatch, declaredBase, sniffedBase)
+	}
+	if generic && fileType == Video && declaredMajor != "video" {
+		return "", fmt.Errorf("%w: %s upload declared as %s", ErrContentMismatch, fileType, declaredBase)
+	}
+
+	return checkActiveContent(fileType, declared)
+}
+
+// activeContentTypes are documents a browser runs scripts in when they are displayed
+var activeContentTypes = map[string]bool{
+	"text/html":             true,
+	"application/xhtml+xml": true,
+	"image/svg+xml":         true,
+	"text/xml":              true,
+	"application/xml":       true,
+}
+
+// checkActiveContent rejects plain files stored as an active type. The serve handlers already send them
+// as attachments, but URLs of the backend itself, such as MinIO presigned URLs, display them inline.
+func checkActiveContent(fileType FileType, contentType string) (string, error) {
+	if fileType == "" && activeContentTypes[baseMediaType(contentType)] {
+		return "", fmt.Errorf("%w: %s files are not accepted", ErrContentMismatch, baseMediaType(contentType))
+	}
+	return contentType, nil
+}
+
+// streamingManifestTypes are text playlists stored alongside video segments
+var streamingManifestTypes = map[string]bool{
+	"application/vnd.apple.mpegurl": true,
+	"application/x-mpegurl":         true,
+	"audio/mpegurl":                 true,
+	"application/dash+xml":          true,
+}
+
+func baseMediaType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	base, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		base = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	if base == "image/jpg" {
+		return "image/jpeg"
+	}
+	return base
+}
+
+func isMediaMajorType(major string) bool {
+	return major == "image" || major == "video" || major == "audio"
+}
@@ -0,0 +1,187 @@
+package video
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/weiawesome/wesio-live/libs/logger"
+	"github.com/weiawesome/wesio-live/storage/media"
+	"github.com/weiawesome/wesio-live/storage/media/imaging"
+)
+
+// Options configures an Inspector
+type Options struct {
+	FFmpegPath    string        // ffmpeg binary used for posters, "ffmpeg" to search PATH; posters are skipped when it is missing
+	PosterAt      time.Duration // Position of the poster frame, moved to the middle of shorter videos
+	PosterWidth   int           // Maximum poster width in pixels
+	MaxHeaderSize int64         // Maximum MP4 header read into memory
+	Timeout       time.Duration // Deadline for extracting a poster
+}
+
+// DefaultOptions returns default inspector options
+func DefaultOptions() Options {
+	return Options{
+		FFmpegPath:    "ffmpeg",
+		PosterAt:      time.Second,
+		PosterWidth:   1280,
+		MaxHeaderSize: defaultMaxHeaderSize,
+		Timeout:       time.Minute,
+	}
+}
+
+// Result is the outcome of Inspector.Process
+type Result struct {
+	Info   *Info  `json:"info"`
+	Poster string `json:"poster,omitempty"` // Key of the poster image, empty when none was extracted
+}
+
+// Inspector records the properties of stored videos and extracts their posters
+type Inspector struct {
+	media  media.Media
+	opts   Options
+	ffmpeg string // Resolved ffmpeg path, empty when unavailable
+}
+
+func CreateInspector(m media.Media, opts Options) *Inspector {
+	defaults := DefaultOptions()
+	if opts.FFmpegPath == "" {
+		opts.FFmpegPath = defaults.FFmpegPath
+	}
+	if opts.PosterAt <= 0 {
+		opts.PosterAt = defaults.PosterAt
+	}
+	if opts.PosterWidth <= 0 {
+		opts.PosterWidth = defaults.PosterWidth
+	}
+	if opts.MaxHeaderSize <= 0 {
+		opts.MaxHeaderSize = defaults.MaxHeaderSize
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaults.Timeout
+	}
+
+	ffmpeg, err := exec.LookPath(opts.FFmpegPath)
+	if err != nil {
+		logger.Warn("video", "create_inspector", "ffmpeg not found, video posters are disabled", map[string]interface{}{
+			"path":  opts.FFmpegPath,
+			"error": err.Error(),
+		})
+		ffmpeg = ""
+	}
+
+	return &Inspector{media: m, opts: opts, ffmpeg: ffmpeg}
+}
+
+// Process inspects the stored video filename, stores a poster next to it as an image when ffmpeg is
+// available, and merges the video properties and poster filename into the video's metadata.
+// Poster failures are logged and leave Result.Poster empty.
+func (i *Inspector) Process(ctx context.Context, filename string) (*Result, error) {
+	stat, err := i.media.Stat(ctx, media.Video, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := &rangeReaderAt{ctx: ctx, media: i.media, filename: filename, size: stat.Size}
+	info, err := inspect(reader, stat.Size, i.opts.MaxHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Info: info}
+	metadata := info.Metadata()
+
+	if i.ffmpeg != "" && info.VideoCodec != "" {
+		posterFilename := imaging.VariantFilename(filename, "poster", imaging.JPEG)
+		key, err := i.storePoster(ctx, filename, posterFilename, info.Duration)
+		if err != nil {
+			logger.Error("video", "process", "failed to extract video poster", err, map[string]interface{}{
+				"filename": filename,
+			})
+		} else {
+			result.Poster = key
+			metadata[MetaPoster] = posterFilename
+		}
+	}
+
+	if err := i.media.UpdateMetadata(ctx, media.Video, filename, metadata); err != nil {
+		return nil, fmt.Errorf("failed to store video metadata: %w", err)
+	}
+	return result, nil
+}
+
+// storePoster extracts the first keyframe at or after the poster position with ffmpeg, reading the
+// video through a signed URL so only the needed ranges are fetched
+func (i *Inspector) storePoster(ctx context.Context, filename string, posterFilename string, duration time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, i.opts.Timeout)
+	defer cancel()
+
+	source, err := i.media.GetURL(ctx, media.Video, filename, i.opts.Timeout+time.Minute)
+	if err != nil {
+		return "", err
+	}
+
+	at := i.opts.PosterAt
+	if duration > 0 && at >= duration {
+		at = duration / 2
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, i.ffmpeg,
+		"-hide_banner", "-loglevel", "error", "-nostdin",
+		"-ss", strconv.FormatFloat(at.Seconds(), 'f', 3, 64),
+		"-skip_frame", "nokey",
+		"-i", source,
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale='min(%d,iw)':-2", i.opts.PosterWidth),
+		"-map_metadata", "-1",
+		"-f", "image2pipe", "-c:v", "mjpeg", "-q:v", "3",
+		"pipe:1",
+	)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("ffmpeg failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if stdout.Len() == 0 {
+		return "", fmt.Errorf("ffmpeg produced no frame: %s", bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return i.media.Upload(ctx, media.Image, posterFilename, &stdout, &media.UploadOptions{
+		ContentType: imaging.JPEG.ContentType(),
+	})
+}
+
+// rangeReaderAt reads a stored video with ranged downloads
+type rangeReaderAt struct {
+	ctx      context.Context
+	media    media.Media
+	filename string
+	size     int64
+}
+
+func (r *rangeReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	if offset >= r.size {
+		return 0, io.EOF
+	}
+	length := min(int64(len(p)), r.size-offset)
+
+	body, err := r.media.DownloadRange(r.ctx, media.Video, r.filename, offset, length)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	n, err := io.ReadFull(body, p[:length])
+	if err != nil {
+		return n, err
+	}
+	if length < int64(len(p)) {
+		return n, io.EOF
+	}
+	return n, nil
+}
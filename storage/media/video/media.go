@@ -0,0 +1,61 @@
+package video
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/weiawesome/wesio-live/storage/media"
+)
+
+// posterListSize is the number of videos listed per page by PosterReferences
+const posterListSize = 1000
+
+// PosterReferences returns a media.ReferenceSource reporting the key of the poster recorded in the
+// MetaPoster metadata of every stored video, so the media garbage collector keeps posters while their video exists.
+// Videos whose listing leaves out metadata are read with Stat.
+func PosterReferences(m media.Media) func(ctx context.Context, yield func(ref string) error) error {
+	return func(ctx context.Context, yield func(ref string) error) error {
+		cursor := ""
+		for {
+			page, err := m.List(ctx, media.Video, "", cursor, posterListSize)
+			if err != nil {
+				return fmt.Errorf("failed to list videos: %w", err)
+			}
+
+			for _, file := range page.Files {
+				metadata := file.Metadata
+				if metadata == nil {
+					stat, err := m.Stat(ctx, media.Video, file.Filename)
+					if errors.Is(err, media.ErrNotFound) {
+						continue
+					}
+					if err != nil {
+						return fmt.Errorf("failed to stat video %s: %w", file.Filename, err)
+					}
+					metadata = stat.Metadata
+				}
+
+				poster := metadata[MetaPoster]
+				if poster == "" {
+					continue
+				}
+				stat, err := m.Stat(ctx, media.Image, poster)
+				if errors.Is(err, media.ErrNotFound) {
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("failed to stat poster %s: %w", poster, err)
+				}
+				if err := yield(stat.Key); err != nil {
+					return err
+				}
+			}
+
+			if page.NextCursor == "" {
+				return nil
+			}
+			cursor = page.NextCursor
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package video
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// mp4Box is an ISO base media file format box
+type mp4Box struct {
+	Type    string
+	Payload []byte
+}
+
+// mp4Boxes splits data into its child boxes. Truncated trailing boxes are ignored.
+func mp4Boxes(data []byte) []mp4Box {
+	var boxes []mp4Box
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data))
+		boxType := string(data[4:8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return boxes
+			}
+			size = binary.BigEndian.Uint64(data[8:])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return boxes
+		}
+		boxes = append(boxes, mp4Box{Type: boxType, Payload: data[header:size]})
+		data = data[size:]
+	}
+	return boxes
+}
+
+// inspectMP4 finds the moov box among the top-level boxes, wherever it is, and parses it
+func inspectMP4(r io.ReaderAt, size int64, maxHeader int64) (*Info, error) {
+	info := &Info{Container: "mp4"}
+
+	header := make([]byte, 16)
+	for offset := int64(0); offset+8 <= size; {
+		n, err := r.ReadAt(header, offset)
+		if n < 8 {
+			return nil, fmt.Errorf("failed to read MP4 box header: %w", err)
+		}
+
+		boxSize := int64(binary.BigEndian.Uint32(header))
+		boxType := string(header[4:8])
+		headerSize := int64(8)
+		switch boxSize {
+		case 0:
+			boxSize = size - offset
+		case 1:
+			if n < 16 {
+				return nil, fmt.Errorf("%w: truncated MP4 box header", ErrUnsupportedContainer)
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:]))
+			headerSize = 16
+		}
+		if boxSize < headerSize || offset+boxSize > size {
+			return nil, fmt.Errorf("%w: invalid MP4 box size", ErrUnsupportedContainer)
+		}
+
+		switch boxType {
+		case "ftyp":
+			if n >= 12 && string(header[8:12]) == "qt  " {
+				info.Container = "mov"
+			}
+		case "moov":
+			if boxSize-headerSize > maxHeader {
+				return nil, fmt.Errorf("%w: MP4 header of %d bytes", ErrHeaderTooLarge, boxSize-headerSize)
+			}
+			moov := make([]byte, boxSize-headerSize)
+			if _, err := r.ReadAt(moov, offset+headerSize); err != nil && err != io.EOF {
+				return nil, fmt.Errorf("failed to read MP4 header: %w", err)
+			}
+			parseMoov(info, moov)
+			info.setBitrate(size)
+			return info, nil
+		}
+		offset += boxSize
+	}
+
+	return nil, fmt.Errorf("%w: MP4 without a moov box", ErrUnsupportedContainer)
+}
+
+func parseMoov(info *Info, moov []byte) {
+	var fragmentDuration uint64
+	var timescale uint32
+
+	for _, box := range mp4Boxes(moov) {
+		switch box.Type {
+		case "mvhd":
+			var duration uint64
+			duration, timescale = parseMP4Duration(box.Payload)
+			info.Duration = scaleDuration(duration, timescale)
+		case "mvex":
+			// Fragmented files record their duration in mehd instead of mvhd
+			for _, child := range mp4Boxes(box.Payload) {
+				if child.Type == "mehd" && len(child.Payload) >= 8 {
+					if child.Payload[0] == 1 && len(child.Payload) >= 12 {
+						fragmentDuration = binary.BigEndian.Uint64(child.Payload[4:])
+					} else {
+						fragmentDuration = uint64(binary.BigEndian.Uint32(child.Payload[4:]))
+					}
+				}
+			}
+		case "trak":
+			parseTrak(info, box.Payload)
+		}
+	}
+
+	if info.Duration == 0 && fragmentDuration > 0 {
+		info.Duration = scaleDuration(fragmentDuration, timescale)
+	}
+}
+
+func parseTrak(info *Info, trak []byte) {
+	var (
+		handler       string
+		codec         string
+		width, height int
+		duration      time.Duration
+	)
+
+	for _, box := range mp4Boxes(trak) {
+		switch box.Type {
+		case "tkhd":
+			// Width and height are the last two 16.16 fixed point fields
+			if p := box.Payload; len(p) >= 8 {
+				width = int(binary.BigEndian.Uint32(p[len(p)-8:]) >> 16)
+				height = int(binary.BigEndian.Uint32(p[len(p)-4:]) >> 16)
+			}
+		case "mdia":
+			for _, mdia := range mp4Boxes(box.Payload) {
+				switch mdia.Type {
+				case "mdhd":
+					duration = scaleDuration(parseMP4Duration(mdia.Payload))
+				case "hdlr":
+					if len(mdia.Payload) >= 12 {
+						handler = string(mdia.Payload[8:12])
+					}
+				case "minf":
+					codec, width, height = parseMinf(mdia.Payload, width, height)
+				}
+			}
+		}
+	}
+
+	switch handler {
+	case "vide":
+		if info.VideoCodec != "" {
+			return
+		}
+		info.VideoCodec = codecName(codec)
+		info.Width, info.Height = width, height
+	case "soun":
+		if info.AudioCodec == "" {
+			info.AudioCodec = codecName(codec)
+		}
+	default:
+		return
+	}
+	if info.Duration == 0 {
+		info.Duration = duration
+	}
+}
+
+// parseMinf returns the first sample entry format of minf/stbl/stsd and, for visual entries, its coded size
+func parseMinf(minf []byte, width int, height int) (string, int, int) {
+	for _, box := range mp4Boxes(minf) {
+		if box.Type != "stbl" {
+			continue
+		}
+		for _, stbl := range mp4Boxes(box.Payload) {
+			if stbl.Type != "stsd" || len(stbl.Payload) < 8 {
+				continue
+			}
+			entries := mp4Boxes(stbl.Payload[8:])
+			if len(entries) == 0 {
+				continue
+			}
+			entry := entries[0]
+			if p := entry.Payload; len(p) >= 28 && isVisualSampleEntry(entry.Type) {
+				if w, h := int(binary.BigEndian.Uint16(p[24:])), int(binary.BigEndian.Uint16(p[26:])); w > 0 && h > 0 {
+					width, height = w, h
+				}
+			}
+			return entry.Type, width, height
+		}
+	}
+	return "", width, height
+}
+
+func isVisualSampleEntry(format string) bool {
+	switch format {
+	case "avc1", "avc3", "hvc1", "hev1", "av01", "vp08", "vp09", "mp4v", "dvh1", "dvhe":
+		return true
+	}
+	return false
+}
+
+// parseMP4Duration reads the duration and timescale of an mvhd or mdhd payload
+func parseMP4Duration(p []byte) (uint64, uint32) {
+	if len(p) >= 32 && p[0] == 1 {
+		return binary.BigEndian.Uint64(p[24:]), binary.BigEndian.Uint32(p[20:])
+	}
+	if len(p) >= 20 {
+		return uint64(binary.BigEndian.Uint32(p[16:])), binary.BigEndian.Uint32(p[12:])
+	}
+	return 0, 0
+}
+
+func scaleDuration(duration uint64, timescale uint32) time.Duration {
+	// All ones marks an unknown duration
+	if timescale == 0 || duration == 0 || duration == 0xffffffff || duration == 0xffffffffffffffff {
+		return 0
+	}
+	seconds := duration / uint64(timescale)
+	remainder := duration % uint64(timescale)
+	return time.Duration(seconds)*time.Second + time.Duration(remainder*uint64(time.Second)/uint64(timescale))
+}
+
+// codecName maps MP4 sample entry formats to common codec names
+func codecName(format string) string {
+	switch format {
+	case "avc1", "avc3":
+		return "h264"
+	case "hvc1", "hev1", "dvh1", "dvhe":
+		return "h265"
+	case "av01":
+		return "av1"
+	case "vp08":
+		return "vp8"
+	case "vp09":
+		return "vp9"
+	case "mp4v":
+		return "mpeg4"
+	case "mp4a":
+		return "aac"
+	case "Opus":
+		return "opus"
+	case "ac-3":
+		return "ac3"
+	case "ec-3":
+		return "eac3"
+	case "fLaC":
+		return "flac"
+	default:
+		return strings.ToLower(strings.TrimSpace(format))
+	}
+}
@@ -0,0 +1,99 @@
+// Package video inspects stored MP4 and WebM files in pure Go, records their duration, codecs,
+// resolution and bitrate as object metadata, and extracts poster frames when ffmpeg is available.
+package video
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrUnsupportedContainer is returned for data that is not a parsable MP4 or WebM file
+	ErrUnsupportedContainer = errors.New("video: unsupported container")
+	// ErrHeaderTooLarge is returned when an MP4 header exceeds Options.MaxHeaderSize
+	ErrHeaderTooLarge = errors.New("video: header too large")
+)
+
+// Metadata keys written by Inspector.Process
+const (
+	MetaContainer  = "container"
+	MetaDuration   = "duration" // Seconds with millisecond precision
+	MetaWidth      = "width"
+	MetaHeight     = "height"
+	MetaVideoCodec = "video-codec"
+	MetaAudioCodec = "audio-codec"
+	MetaBitrate    = "bitrate" // Bits per second
+	MetaPoster     = "poster"  // Filename of the poster image
+)
+
+// defaultMaxHeaderSize caps the MP4 moov box read into memory
+const defaultMaxHeaderSize = 64 * 1024 * 1024
+
+// Info describes a video file. Fields that could not be determined are zero.
+type Info struct {
+	Container  string        `json:"container"`
+	Duration   time.Duration `json:"duration"`
+	Width      int           `json:"width,omitempty"`
+	Height     int           `json:"height,omitempty"`
+	VideoCodec string        `json:"video_codec,omitempty"`
+	AudioCodec string        `json:"audio_codec,omitempty"`
+	Bitrate    int64         `json:"bitrate,omitempty"`
+}
+
+// Metadata returns the info as object metadata, leaving out unknown fields
+func (i *Info) Metadata() map[string]string {
+	metadata := map[string]string{MetaContainer: i.Container}
+	if i.Duration > 0 {
+		metadata[MetaDuration] = strconv.FormatFloat(i.Duration.Seconds(), 'f', 3, 64)
+	}
+	if i.Width > 0 && i.Height > 0 {
+		metadata[MetaWidth] = strconv.Itoa(i.Width)
+		metadata[MetaHeight] = strconv.Itoa(i.Height)
+	}
+	if i.VideoCodec != "" {
+		metadata[MetaVideoCodec] = i.VideoCodec
+	}
+	if i.AudioCodec != "" {
+		metadata[MetaAudioCodec] = i.AudioCodec
+	}
+	if i.Bitrate > 0 {
+		metadata[MetaBitrate] = strconv.FormatInt(i.Bitrate, 10)
+	}
+	return metadata
+}
+
+// setBitrate derives the average bitrate from the file size and duration
+func (i *Info) setBitrate(size int64) {
+	if i.Duration > 0 {
+		i.Bitrate = int64(float64(size) * 8 / i.Duration.Seconds())
+	}
+}
+
+// Inspect parses the container headers of an MP4 (or QuickTime) or WebM (or Matroska) file of size bytes.
+// Only the headers are read, so r can be backed by ranged downloads.
+func Inspect(r io.ReaderAt, size int64) (*Info, error) {
+	return inspect(r, size, defaultMaxHeaderSize)
+}
+
+func inspect(r io.ReaderAt, size int64, maxHeader int64) (*Info, error) {
+	magic := make([]byte, 8)
+	if n, err := r.ReadAt(magic, 0); n < len(magic) {
+		if err == nil || err == io.EOF {
+			return nil, fmt.Errorf("%w: file too short", ErrUnsupportedContainer)
+		}
+		return nil, fmt.Errorf("failed to read video header: %w", err)
+	}
+
+	switch {
+	case string(magic[4:8]) == "ftyp":
+		return inspectMP4(r, size, maxHeader)
+	case bytes.HasPrefix(magic, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return inspectWebM(r, size)
+	default:
+		return nil, ErrUnsupportedContainer
+	}
+}
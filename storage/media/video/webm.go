@@ -0,0 +1,234 @@
+package video
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Matroska element IDs, with their length marker bits kept
+const (
+	ebmlHeader        = 0x1A45DFA3
+	ebmlDocType       = 0x4282
+	mkvSegment        = 0x18538067
+	mkvInfo           = 0x1549A966
+	mkvTimecodeScale  = 0x2AD7B1
+	mkvDuration       = 0x4489
+	mkvTracks         = 0x1654AE6B
+	mkvTrackEntry     = 0xAE
+	mkvTrackType      = 0x83
+	mkvCodecID        = 0x86
+	mkvVideo          = 0xE0
+	mkvPixelWidth     = 0xB0
+	mkvPixelHeight    = 0xBA
+	mkvCluster        = 0x1F43B675
+	mkvTrackTypeVideo = 1
+	mkvTrackTypeAudio = 2
+)
+
+// webmWindow is how much of a WebM file is read. Info and Tracks precede the first Cluster,
+// so they fit within it unless the file starts with unusually large attachments.
+const webmWindow = 1024 * 1024
+
+// ebmlElement is a parsed EBML element header
+type ebmlElement struct {
+	ID      uint32
+	Payload []byte
+}
+
+// readVint reads an EBML variable length integer. With keepMarker the length marker bit is kept, as
+// element IDs are written. unknown reports a size with all value bits set.
+func readVint(data []byte, keepMarker bool) (value uint64, length int, unknown bool, ok bool) {
+	if len(data) == 0 || data[0] == 0 {
+		return 0, 0, false, false
+	}
+	length = 1
+	for mask := byte(0x80); data[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 || length > len(data) {
+		return 0, 0, false, false
+	}
+
+	value = uint64(data[0])
+	if !keepMarker {
+		value &= uint64(0xff >> length)
+	}
+	for _, b := range data[1:length] {
+		value = value<<8 | uint64(b)
+	}
+	unknown = !keepMarker && value == 1<<(7*length)-1
+	return value, length, unknown, true
+}
+
+// ebmlElements splits data into its child elements. An element of unknown or overflowing size
+// extends to the end of data, which is how live recordings and the truncated window appear.
+func ebmlElements(data []byte) []ebmlElement {
+	var elements []ebmlElement
+	for len(data) > 0 {
+		id, idLength, _, ok := readVint(data, true)
+		if !ok || id > math.MaxUint32 {
+			return elements
+		}
+		size, sizeLength, unknown, ok := readVint(data[idLength:], false)
+		if !ok {
+			return elements
+		}
+		start := idLength + sizeLength
+		end := len(data)
+		if !unknown && size <= uint64(len(data)-start) {
+			end = start + int(size)
+		}
+		elements = append(elements, ebmlElement{ID: uint32(id), Payload: data[start:end]})
+		data = data[end:]
+	}
+	return elements
+}
+
+func inspectWebM(r io.ReaderAt, size int64) (*Info, error) {
+	window := make([]byte, min(size, webmWindow))
+	n, err := r.ReadAt(window, 0)
+	if n < len(window) && err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read WebM header: %w", err)
+	}
+	window = window[:n]
+
+	elements := ebmlElements(window)
+	if len(elements) == 0 || elements[0].ID != ebmlHeader {
+		return nil, fmt.Errorf("%w: missing EBML header", ErrUnsupportedContainer)
+	}
+
+	info := &Info{}
+	for _, element := range ebmlElements(elements[0].Payload) {
+		if element.ID == ebmlDocType {
+			info.Container = string(element.Payload)
+		}
+	}
+	if info.Container != "webm" && info.Container != "matroska" {
+		return nil, fmt.Errorf("%w: EBML document type %q", ErrUnsupportedContainer, info.Container)
+	}
+	if info.Container == "matroska" {
+		info.Container = "mkv"
+	}
+
+	for _, element := range elements[1:] {
+		if element.ID == mkvSegment {
+			parseSegment(info, element.Payload)
+			info.setBitrate(size)
+			return info, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: WebM without a segment", ErrUnsupportedContainer)
+}
+
+func parseSegment(info *Info, segment []byte) {
+	for _, element := range ebmlElements(segment) {
+		switch element.ID {
+		case mkvInfo:
+			timecodeScale := uint64(time.Millisecond)
+			var duration float64
+			for _, child := range ebmlElements(element.Payload) {
+				switch child.ID {
+				case mkvTimecodeScale:
+					if scale := ebmlUint(child.Payload); scale > 0 {
+						timecodeScale = scale
+					}
+				case mkvDuration:
+					duration = ebmlFloat(child.Payload)
+				}
+			}
+			if duration > 0 && !math.IsInf(duration, 0) {
+				info.Duration = time.Duration(duration * float64(timecodeScale))
+			}
+		case mkvTracks:
+			for _, entry := range ebmlElements(element.Payload) {
+				if entry.ID == mkvTrackEntry {
+					parseTrackEntry(info, entry.Payload)
+				}
+			}
+		case mkvCluster:
+			// Media data follows; everything needed has been seen
+			return
+		}
+	}
+}
+
+func parseTrackEntry(info *Info, entry []byte) {
+	var (
+		trackType     uint64
+		codec         string
+		width, height int
+	)
+	for _, element := range ebmlElements(entry) {
+		switch element.ID {
+		case mkvTrackType:
+			trackType = ebmlUint(element.Payload)
+		case mkvCodecID:
+			codec = string(element.Payload)
+		case mkvVideo:
+			for _, child := range ebmlElements(element.Payload) {
+				switch child.ID {
+				case mkvPixelWidth:
+					width = int(ebmlUint(child.Payload))
+				case mkvPixelHeight:
+					height = int(ebmlUint(child.Payload))
+				}
+			}
+		}
+	}
+
+	switch {
+	case trackType == mkvTrackTypeVideo && info.VideoCodec == "":
+		info.VideoCodec = matroskaCodecName(codec)
+		info.Width, info.Height = width, height
+	case trackType == mkvTrackTypeAudio && info.AudioCodec == "":
+		info.AudioCodec = matroskaCodecName(codec)
+	}
+}
+
+func ebmlUint(data []byte) uint64 {
+	var value uint64
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
+
+func ebmlFloat(data []byte) float64 {
+	switch len(data) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(data))
+	default:
+		return 0
+	}
+}
+
+// matroskaCodecName maps Matroska codec IDs to the names codecName uses
+func matroskaCodecName(codecID string) string {
+	switch codecID {
+	case "V_VP8":
+		return "vp8"
+	case "V_VP9":
+		return "vp9"
+	case "V_AV1":
+		return "av1"
+	case "V_MPEG4/ISO/AVC":
+		return "h264"
+	case "V_MPEGH/ISO/HEVC":
+		return "h265"
+	case "A_OPUS":
+		return "opus"
+	case "A_VORBIS":
+		return "vorbis"
+	case "A_AAC":
+		return "aac"
+	case "A_FLAC":
+		return "flac"
+	default:
+		return codecID
+	}
+}
@@ -0,0 +1,65 @@
+package outbox
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/weiawesome/wesio-live/libs/events"
+	pb "github.com/weiawesome/wesio-live/libs/events/proto"
+	"gorm.io/gorm"
+)
+
+// Message is an event waiting to be relayed to the message queue.
+// Rows are written in the same transaction as the entity change that produced the event.
+type Message struct {
+	ID            int64      `json:"id" gorm:"primaryKey;autoIncrement"`
+	EventID       string     `json:"event_id" gorm:"not null;uniqueIndex"`
+	EventType     string     `json:"event_type" gorm:"not null"`
+	AggregateID   string     `json:"aggregate_id" gorm:"not null;index"`
+	Payload       []byte     `json:"payload" gorm:"not null"` // encoded events.v1.EventEnvelope
+	Attempts      int        `json:"attempts" gorm:"not null;default:0"`
+	LastError     *string    `json:"last_error" gorm:"type:text"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"not null"`
+	DeliveredAt   *time.Time `json:"delivered_at" gorm:"index"`
+	DeadAt        *time.Time `json:"dead_at" gorm:"index"` // set once the relay gives up on the message
+	CreatedAt     time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (Message) TableName() string {
+	return "outbox_messages"
+}
+
+// Enqueue stores an event envelope in the outbox using the caller's transaction
+func Enqueue(tx *gorm.DB, env *pb.EventEnvelope) error {
+	payload, err := events.Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	msg := &Message{
+		EventID:       env.GetEventId(),
+		EventType:     env.GetType().String(),
+		AggregateID:   env.GetAggregateId(),
+		Payload:       payload,
+		NextAttemptAt: time.Now(),
+	}
+	if err := tx.Create(msg).Error; err != nil {
+		return fmt.Errorf("failed to write outbox message: %w", err)
+	}
+
+	return nil
+}
+
+// Record wraps the event in an envelope and stores it in the outbox using the caller's transaction
+func Record[T events.Event](tx *gorm.DB, event T, meta events.Metadata) (*pb.EventEnvelope, error) {
+	env, err := events.NewEnvelope(event, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Enqueue(tx, env); err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
@@ -0,0 +1,293 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/weiawesome/wesio-live/libs/events"
+	"github.com/weiawesome/wesio-live/libs/logger"
+	"github.com/weiawesome/wesio-live/libs/messaging"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errUndecodable marks rows whose payload is not a valid event envelope
+var errUndecodable = errors.New("undecodable outbox payload")
+
+// RelayOptions configures the outbox relay worker
+type RelayOptions struct {
+	BatchSize       int           // Max rows claimed per poll
+	PollInterval    time.Duration // Delay between polls when the outbox is idle
+	RetryBackoff    time.Duration // Initial delay after a failed publish, doubled per attempt
+	MaxRetryBackoff time.Duration // Upper bound for the retry delay
+	MaxAttempts     int           // Failed publishes after which a row is dead-lettered
+	ClaimTimeout    time.Duration // How long claimed rows are hidden from other relays while being published
+	Retention       time.Duration // How long delivered rows are kept before cleanup
+	CleanupInterval time.Duration // How often delivered rows are cleaned up
+}
+
+// DefaultRelayOptions returns default relay options
+func DefaultRelayOptions() RelayOptions {
+	return RelayOptions{
+		BatchSize:       100,
+		PollInterval:    time.Second,
+		RetryBackoff:    2 * time.Second,
+		MaxRetryBackoff: 5 * time.Minute,
+		MaxAttempts:     20,
+		ClaimTimeout:    time.Minute,
+		Retention:       24 * time.Hour,
+		CleanupInterval: time.Hour,
+	}
+}
+
+// Relay publishes outbox rows to the message queue.
+// Delivery is at-least-once: a crash between publishing and marking a row delivered
+// results in the event being published again, so consumers must deduplicate by event ID.
+// Several relays may run against the same outbox; each row is claimed by one of them at a time.
+type Relay struct {
+	db        *gorm.DB
+	publisher messaging.Publisher
+	opts      RelayOptions
+}
+
+func CreateRelay(db *gorm.DB, publisher messaging.Publisher, opts RelayOptions) *Relay {
+	defaults := DefaultRelayOptions()
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaults.BatchSize
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaults.PollInterval
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = defaults.RetryBackoff
+	}
+	if opts.MaxRetryBackoff <= 0 {
+		opts.MaxRetryBackoff = defaults.MaxRetryBackoff
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaults.MaxAttempts
+	}
+	if opts.ClaimTimeout <= 0 {
+		opts.ClaimTimeout = defaults.ClaimTimeout
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = defaults.Retention
+	}
+	if opts.CleanupInterval <= 0 {
+		opts.CleanupInterval = defaults.CleanupInterval
+	}
+
+	return &Relay{
+		db:        db,
+		publisher: publisher,
+		opts:      opts,
+	}
+}
+
+// Run relays outbox rows until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) error {
+	pollTimer := time.NewTimer(0)
+	defer pollTimer.Stop()
+	cleanupTicker := time.NewTicker(r.opts.CleanupInterval)
+	defer cleanupTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-cleanupTicker.C:
+			if _, err := r.Cleanup(ctx); err != nil {
+				logger.Error("outbox", "cleanup", "failed to clean up delivered messages", err, nil)
+			}
+
+		case <-pollTimer.C:
+			delivered, err := r.RelayBatch(ctx)
+			if err != nil && ctx.Err() == nil {
+				logger.Error("outbox", "relay", "failed to relay outbox batch", err, nil)
+			}
+
+			// Keep draining while messages are being delivered, since a batch holds one message per aggregate
+			if delivered > 0 {
+				pollTimer.Reset(0)
+			} else {
+				pollTimer.Reset(r.opts.PollInterval)
+			}
+		}
+	}
+}
+
+// RelayBatch publishes one batch of pending rows and returns how many were delivered.
+// Only the oldest pending row of each aggregate is claimed, so events for one aggregate are
+// never published out of order and an aggregate waiting for a retry does not hold back others.
+// Rows that fail MaxAttempts times are dead-lettered, which lets later rows of their aggregate through.
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	rows, err := r.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for i := range rows {
+		row := &rows[i]
+		if err := r.publish(ctx, row); err != nil {
+			if ctx.Err() != nil {
+				// The claim expires and another poll retries the row without counting an attempt
+				return delivered, ctx.Err()
+			}
+			if err := r.fail(ctx, row, err); err != nil {
+				return delivered, err
+			}
+			continue
+		}
+
+		err := r.db.WithContext(ctx).Model(row).Updates(map[string]interface{}{
+			"attempts":     row.Attempts + 1,
+			"last_error":   nil,
+			"delivered_at": time.Now(),
+		}).Error
+		if err != nil {
+			return delivered, fmt.Errorf("failed to mark outbox message delivered: %w", err)
+		}
+		delivered++
+	}
+
+	return delivered, nil
+}
+
+// claim locks the oldest pending row of up to BatchSize aggregates, skipping rows locked by other
+// relays, and pushes their next attempt past the claim timeout so that publishing happens outside
+// the locking transaction without another relay picking the rows up
+func (r *Relay) claim(ctx context.Context) ([]Message, error) {
+	var rows []Message
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("delivered_at IS NULL AND dead_at IS NULL AND next_attempt_at <= ?", now).
+			Where(`NOT EXISTS (
+				SELECT 1 FROM outbox_messages earlier
+				WHERE earlier.aggregate_id = outbox_messages.aggregate_id
+				AND earlier.id < outbox_messages.id
+				AND earlier.delivered_at IS NULL
+				AND earlier.dead_at IS NULL
+			)`).
+			Order("id").
+			Limit(r.opts.BatchSize).
+			Find(&rows).Error
+		if err != nil {
+			return fmt.Errorf("failed to load outbox messages: %w", err)
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		ids := make([]int64, len(rows))
+		for i := range rows {
+			ids[i] = rows[i].ID
+		}
+		err = tx.Model(&Message{}).
+			Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(r.opts.ClaimTimeout)).Error
+		if err != nil {
+			return fmt.Errorf("failed to claim outbox messages: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// fail records a failed publish, scheduling a retry or dead-lettering the row.
+// Rows whose payload cannot be decoded are dead-lettered at once, since retrying cannot fix them.
+func (r *Relay) fail(ctx context.Context, row *Message, cause error) error {
+	now := time.Now()
+	attempts := row.Attempts + 1
+	lastError := cause.Error()
+	dead := attempts >= r.opts.MaxAttempts || errors.Is(cause, errUndecodable)
+
+	fields := map[string]interface{}{
+		"event_id":     row.EventID,
+		"event_type":   row.EventType,
+		"aggregate_id": row.AggregateID,
+		"attempts":     attempts,
+		"error":        lastError,
+	}
+	updates := map[string]interface{}{
+		"attempts":   attempts,
+		"last_error": lastError,
+	}
+	if dead {
+		logger.Error("outbox", "publish", "dead-lettered outbox message", cause, fields)
+		updates["dead_at"] = now
+	} else {
+		logger.Warn("outbox", "publish", "failed to publish outbox message", fields)
+		updates["next_attempt_at"] = now.Add(r.backoff(attempts))
+	}
+
+	if err := r.db.WithContext(ctx).Model(row).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to record outbox failure: %w", err)
+	}
+	return nil
+}
+
+// Requeue returns dead-lettered rows to the outbox with a fresh attempt count and returns how many
+// were requeued. Rows that are not dead-lettered are left untouched.
+func (r *Relay) Requeue(ctx context.Context, eventIDs []string) (int64, error) {
+	if len(eventIDs) == 0 {
+		return 0, nil
+	}
+
+	result := r.db.WithContext(ctx).Model(&Message{}).
+		Where("event_id IN ? AND dead_at IS NOT NULL", eventIDs).
+		Updates(map[string]interface{}{
+			"attempts":        0,
+			"dead_at":         nil,
+			"next_attempt_at": time.Now(),
+		})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to requeue outbox messages: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
+
+// Cleanup deletes delivered rows older than the retention period
+func (r *Relay) Cleanup(ctx context.Context) (int64, error) {
+	cutoff := time.Now().Add(-r.opts.Retention)
+
+	result := r.db.WithContext(ctx).
+		Where("delivered_at IS NOT NULL AND delivered_at < ?", cutoff).
+		Delete(&Message{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete delivered outbox messages: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
+
+func (r *Relay) publish(ctx context.Context, row *Message) error {
+	env, err := events.Unmarshal(row.Payload)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errUndecodable, err)
+	}
+
+	return events.PublishEnvelope(ctx, r.publisher, env)
+}
+
+// backoff returns the retry delay for the given attempt number
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.opts.RetryBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= r.opts.MaxRetryBackoff {
+			return r.opts.MaxRetryBackoff
+		}
+	}
+	return delay
+}
@@ -0,0 +1,54 @@
+package presence
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/weiawesome/wesio-live/libs/config"
+)
+
+var (
+	// ErrRoomFull is returned by Join when the room already has MaxParticipants viewers
+	ErrRoomFull = errors.New("presence: room is full")
+	// ErrNotJoined is returned by Heartbeat when the session is unknown or has expired
+	ErrNotJoined = errors.New("presence: user has not joined the room")
+)
+
+// Options configures session expiry and room capacity
+type Options struct {
+	SessionTTL      time.Duration // Sessions without a heartbeat for this long are expired
+	SweepInterval   time.Duration // How often a Tracker expires stale sessions
+	MaxParticipants int           // Maximum viewers per room, 0 for unlimited
+}
+
+// OptionsFromConfig builds presence options from the room configuration
+func OptionsFromConfig(cfg config.RoomConfig) Options {
+	return Options{
+		SessionTTL:      config.ParseDuration(cfg.PresenceTTL, 30*time.Second),
+		SweepInterval:   config.ParseDuration(cfg.PresenceSweepInterval, 10*time.Second),
+		MaxParticipants: cfg.MaxParticipants,
+	}
+}
+
+// Presence tracks which users are currently in which rooms
+type Presence interface {
+	// Join registers the user in the room and returns the room's viewer count.
+	// Joining again refreshes the session; new joins fail with ErrRoomFull when the room is at capacity.
+	Join(ctx context.Context, roomID string, userID string) (int, error)
+
+	// Heartbeat keeps the user's session alive
+	Heartbeat(ctx context.Context, roomID string, userID string) error
+
+	// Leave removes the user from the room and returns the room's viewer count
+	Leave(ctx context.Context, roomID string, userID string) (int, error)
+
+	// Count returns the number of live sessions in the room
+	Count(ctx context.Context, roomID string) (int, error)
+
+	// Participants returns the IDs of users with a live session in the room
+	Participants(ctx context.Context, roomID string) ([]string, error)
+
+	// ExpireStale removes expired sessions and returns the new viewer count of every room that changed
+	ExpireStale(ctx context.Context) (map[string]int, error)
+}
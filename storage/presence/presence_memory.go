@@ -0,0 +1,136 @@
+package presence
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryPresence keeps sessions in process memory, suitable for single instance deployments
+type MemoryPresence struct {
+	opts Options
+
+	mu    sync.Mutex
+	rooms map[string]map[string]time.Time // roomID -> userID -> last seen
+}
+
+func CreateMemoryPresence(opts Options) *MemoryPresence {
+	return &MemoryPresence{
+		opts:  opts,
+		rooms: make(map[string]map[string]time.Time),
+	}
+}
+
+func (p *MemoryPresence) Join(ctx context.Context, roomID string, userID string) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	p.expireRoom(roomID, now)
+
+	sessions := p.rooms[roomID]
+	if sessions == nil {
+		sessions = make(map[string]time.Time)
+		p.rooms[roomID] = sessions
+	}
+
+	if _, ok := sessions[userID]; !ok && p.opts.MaxParticipants > 0 && len(sessions) >= p.opts.MaxParticipants {
+		return len(sessions), ErrRoomFull
+	}
+
+	sessions[userID] = now
+	return len(sessions), nil
+}
+
+func (p *MemoryPresence) Heartbeat(ctx context.Context, roomID string, userID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	lastSeen, ok := p.rooms[roomID][userID]
+	if !ok || p.expired(lastSeen, now) {
+		return ErrNotJoined
+	}
+
+	p.rooms[roomID][userID] = now
+	return nil
+}
+
+func (p *MemoryPresence) Leave(ctx context.Context, roomID string, userID string) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sessions, ok := p.rooms[roomID]
+	if !ok {
+		return 0, nil
+	}
+
+	delete(sessions, userID)
+	p.expireRoom(roomID, time.Now())
+	return len(p.rooms[roomID]), nil
+}
+
+func (p *MemoryPresence) Count(ctx context.Context, roomID string) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	count := 0
+	for _, lastSeen := range p.rooms[roomID] {
+		if !p.expired(lastSeen, now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (p *MemoryPresence) Participants(ctx context.Context, roomID string) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	users := make([]string, 0, len(p.rooms[roomID]))
+	for userID, lastSeen := range p.rooms[roomID] {
+		if !p.expired(lastSeen, now) {
+			users = append(users, userID)
+		}
+	}
+	sort.Strings(users)
+	return users, nil
+}
+
+func (p *MemoryPresence) ExpireStale(ctx context.Context) (map[string]int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	changed := make(map[string]int)
+	for roomID := range p.rooms {
+		if p.expireRoom(roomID, now) > 0 {
+			changed[roomID] = len(p.rooms[roomID])
+		}
+	}
+	return changed, nil
+}
+
+// expireRoom drops expired sessions of a room and returns how many were removed.
+// Empty rooms are forgotten. Callers must hold p.mu.
+func (p *MemoryPresence) expireRoom(roomID string, now time.Time) int {
+	sessions := p.rooms[roomID]
+	removed := 0
+	for userID, lastSeen := range sessions {
+		if p.expired(lastSeen, now) {
+			delete(sessions, userID)
+			removed++
+		}
+	}
+	if len(sessions) == 0 {
+		delete(p.rooms, roomID)
+	}
+	return removed
+}
+
+func (p *MemoryPresence) expired(lastSeen time.Time, now time.Time) bool {
+	return p.opts.SessionTTL > 0 && now.Sub(lastSeen) > p.opts.SessionTTL
+}
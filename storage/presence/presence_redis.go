@@ -0,0 +1,171 @@
+package presence
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// joinScript expires stale sessions, enforces the room capacity and registers the session atomically.
+// Returns the new viewer count, or -1 when the room is full.
+var joinScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[3])
+if redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+	return redis.call('ZCARD', KEYS[1])
+end
+local max = tonumber(ARGV[4])
+if max > 0 and redis.call('ZCARD', KEYS[1]) >= max then
+	return -1
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+redis.call('SADD', KEYS[2], ARGV[5])
+return redis.call('ZCARD', KEYS[1])
+`)
+
+// heartbeatScript refreshes a session only if it is still alive. Returns 0 when the session is unknown or expired.
+var heartbeatScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not score or tonumber(score) <= tonumber(ARGV[3]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], 'XX', ARGV[2], ARGV[1])
+return 1
+`)
+
+// expireScript drops expired sessions of a room and forgets the room once it is empty.
+// Returns {removed, remaining}.
+var expireScript = redis.NewScript(`
+local removed = redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+local count = redis.call('ZCARD', KEYS[1])
+if count == 0 then
+	redis.call('SREM', KEYS[2], ARGV[2])
+end
+return {removed, count}
+`)
+
+// RedisPresence stores sessions in Redis sorted sets scored by last heartbeat,
+// so every instance of a multi-instance deployment shares the same view of a room.
+type RedisPresence struct {
+	client redis.UniversalClient
+	prefix string
+	opts   Options
+}
+
+func CreateRedisPresence(client redis.UniversalClient, prefix string, opts Options) *RedisPresence {
+	if prefix == "" {
+		prefix = "presence:"
+	}
+	return &RedisPresence{
+		client: client,
+		prefix: prefix,
+		opts:   opts,
+	}
+}
+
+// roomKey is the sorted set of userID -> last heartbeat (unix millis) for a room
+func (p *RedisPresence) roomKey(roomID string) string {
+	return p.prefix + "room:" + roomID
+}
+
+// roomsKey is the set of rooms that may have live sessions
+func (p *RedisPresence) roomsKey() string {
+	return p.prefix + "rooms"
+}
+
+// cutoff returns the score at or below which sessions are expired
+func (p *RedisPresence) cutoff(now time.Time) string {
+	if p.opts.SessionTTL <= 0 {
+		return "-inf"
+	}
+	return strconv.FormatInt(now.Add(-p.opts.SessionTTL).UnixMilli(), 10)
+}
+
+func (p *RedisPresence) Join(ctx context.Context, roomID string, userID string) (int, error) {
+	now := time.Now()
+	count, err := joinScript.Run(ctx, p.client,
+		[]string{p.roomKey(roomID), p.roomsKey()},
+		userID, now.UnixMilli(), p.cutoff(now), p.opts.MaxParticipants, roomID,
+	).Int()
+	if err != nil {
+		return 0, fmt.Errorf("failed to join room: %w", err)
+	}
+
+	if count < 0 {
+		return p.opts.MaxParticipants, ErrRoomFull
+	}
+	return count, nil
+}
+
+func (p *RedisPresence) Heartbeat(ctx context.Context, roomID string, userID string) error {
+	now := time.Now()
+	alive, err := heartbeatScript.Run(ctx, p.client,
+		[]string{p.roomKey(roomID)},
+		userID, now.UnixMilli(), p.cutoff(now),
+	).Int()
+	if err != nil {
+		return fmt.Errorf("failed to record heartbeat: %w", err)
+	}
+
+	if alive == 0 {
+		return ErrNotJoined
+	}
+	return nil
+}
+
+func (p *RedisPresence) Leave(ctx context.Context, roomID string, userID string) (int, error) {
+	key := p.roomKey(roomID)
+	if err := p.client.ZRem(ctx, key, userID).Err(); err != nil {
+		return 0, fmt.Errorf("failed to leave room: %w", err)
+	}
+
+	return p.Count(ctx, roomID)
+}
+
+func (p *RedisPresence) Count(ctx context.Context, roomID string) (int, error) {
+	count, err := p.client.ZCount(ctx, p.roomKey(roomID), "("+p.cutoff(time.Now()), "+inf").Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count participants: %w", err)
+	}
+	return int(count), nil
+}
+
+func (p *RedisPresence) Participants(ctx context.Context, roomID string) ([]string, error) {
+	users, err := p.client.ZRangeByScore(ctx, p.roomKey(roomID), &redis.ZRangeBy{
+		Min: "(" + p.cutoff(time.Now()),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list participants: %w", err)
+	}
+	return users, nil
+}
+
+func (p *RedisPresence) ExpireStale(ctx context.Context) (map[string]int, error) {
+	rooms, err := p.client.SMembers(ctx, p.roomsKey()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rooms: %w", err)
+	}
+
+	cutoff := p.cutoff(time.Now())
+	changed := make(map[string]int)
+	for _, roomID := range rooms {
+		result, err := expireScript.Run(ctx, p.client,
+			[]string{p.roomKey(roomID), p.roomsKey()},
+			cutoff, roomID,
+		).Int64Slice()
+		if err != nil {
+			return changed, fmt.Errorf("failed to expire sessions of room %s: %w", roomID, err)
+		}
+
+		removed, count := result[0], result[1]
+		if removed > 0 {
+			changed[roomID] = int(count)
+		}
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,128 @@
+package presence
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/weiawesome/wesio-live/libs/events"
+	pb "github.com/weiawesome/wesio-live/libs/events/proto"
+	"github.com/weiawesome/wesio-live/libs/logger"
+	"github.com/weiawesome/wesio-live/libs/messaging"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Tracker wraps a Presence store, sweeps expired sessions and publishes
+// ViewerCountChanged events whenever a room's viewer count changes.
+type Tracker struct {
+	presence        Presence
+	publisher       messaging.Publisher
+	producer        string
+	maxParticipants int
+	sweepInterval   time.Duration
+
+	mu        sync.Mutex
+	published map[string]int // last count published per room by this instance
+}
+
+func CreateTracker(presence Presence, publisher messaging.Publisher, producer string, opts Options) *Tracker {
+	sweepInterval := opts.SweepInterval
+	if sweepInterval <= 0 {
+		sweepInterval = 10 * time.Second
+	}
+	return &Tracker{
+		presence:        presence,
+		publisher:       publisher,
+		producer:        producer,
+		maxParticipants: opts.MaxParticipants,
+		sweepInterval:   sweepInterval,
+		published:       make(map[string]int),
+	}
+}
+
+func (t *Tracker) Join(ctx context.Context, roomID string, userID string) (int, error) {
+	count, err := t.presence.Join(ctx, roomID, userID)
+	if err != nil {
+		return count, err
+	}
+
+	t.publish(ctx, roomID, count)
+	return count, nil
+}
+
+func (t *Tracker) Heartbeat(ctx context.Context, roomID string, userID string) error {
+	return t.presence.Heartbeat(ctx, roomID, userID)
+}
+
+func (t *Tracker) Leave(ctx context.Context, roomID string, userID string) (int, error) {
+	count, err := t.presence.Leave(ctx, roomID, userID)
+	if err != nil {
+		return count, err
+	}
+
+	t.publish(ctx, roomID, count)
+	return count, nil
+}
+
+func (t *Tracker) Count(ctx context.Context, roomID string) (int, error) {
+	return t.presence.Count(ctx, roomID)
+}
+
+// Run expires stale sessions every sweep interval until ctx is cancelled
+func (t *Tracker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(t.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		changed, err := t.presence.ExpireStale(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Error("presence", "expire_stale", "failed to expire stale sessions", err, nil)
+		}
+		for roomID, count := range changed {
+			t.publish(ctx, roomID, count)
+		}
+	}
+}
+
+// publish emits the room's viewer count if it differs from the last count published by this instance
+func (t *Tracker) publish(ctx context.Context, roomID string, count int) {
+	t.mu.Lock()
+	last, ok := t.published[roomID]
+	if ok && last == count {
+		t.mu.Unlock()
+		return
+	}
+	if count == 0 {
+		delete(t.published, roomID)
+	} else {
+		t.published[roomID] = count
+	}
+	t.mu.Unlock()
+
+	if t.publisher == nil {
+		return
+	}
+
+	_, err := events.Publish(ctx, t.publisher, &pb.ViewerCountChanged{
+		RoomId:          roomID,
+		Count:           int32(count),
+		MaxParticipants: int32(t.maxParticipants),
+		UpdatedAt:       timestamppb.Now(),
+	}, events.Metadata{
+		AggregateID: roomID,
+		Producer:    t.producer,
+	})
+	if err != nil {
+		logger.Warn("presence", "publish_count", "failed to publish viewer count", map[string]interface{}{
+			"room_id": roomID,
+			"count":   count,
+			"error":   err.Error(),
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/weiawesome/wesio-live/libs/logger"
+	"github.com/weiawesome/wesio-live/storage/media"
+	"github.com/weiawesome/wesio-live/storage/user"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Accountant enforces storage quotas and keeps the Usage of every user up to date.
+// Usage counts the files whose media.MetadataOwner names the user.
+type Accountant struct {
+	db     *gorm.DB
+	media  media.Media
+	policy Policy
+}
+
+func CreateAccountant(db *gorm.DB, m media.Media, policy Policy) *Accountant {
+	return &Accountant{
+		db:     db,
+		media:  m,
+		policy: policy,
+	}
+}
+
+// Limits returns the limits of a user: those of their role, with their UserQuota overrides applied.
+// Unknown users get the limits of DefaultRole.
+func (a *Accountant) Limits(ctx context.Context, userID string) (Limits, error) {
+	var roles []string
+	err := a.db.WithContext(ctx).Model(&user.User{}).
+		Where("id = ?", userID).
+		Pluck("role", &roles).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user role: %w", err)
+	}
+	role := DefaultRole
+	if len(roles) > 0 {
+		role = roles[0]
+	}
+
+	var overrides []UserQuota
+	if err := a.db.WithContext(ctx).Where("user_id = ?", userID).Find(&overrides).Error; err != nil {
+		return nil, fmt.Errorf("failed to load user quotas: %w", err)
+	}
+
+	roleLimits := a.policy.limitsFor(role)
+	limits := make(Limits, len(roleLimits)+len(overrides))
+	for fileType, limit := range roleLimits {
+		limits[fileType] = limit
+	}
+	for _, override := range overrides {
+		limits[override.FileType] = Limit{MaxBytes: override.MaxBytes, MaxCount: override.MaxCount}
+	}
+	return limits, nil
+}
+
+// Usage returns the storage held by a user, ordered by file type
+func (a *Accountant) Usage(ctx context.Context, userID string) ([]Usage, error) {
+	var usage []Usage
+	err := a.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("file_type").
+		Find(&usage).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load storage usage: %w", err)
+	}
+	return usage, nil
+}
+
+// SetUserQuota overrides the role limit of a file type for a user
+func (a *Accountant) SetUserQuota(ctx context.Context, userID string, fileType media.FileType, limit Limit) error {
+	if limit.MaxBytes < 0 || limit.MaxCount < 0 {
+		return fmt.Errorf("invalid quota %+v", limit)
+	}
+	err := a.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "file_type"}},
+			DoUpdates: clause.AssignmentColumns([]string{"max_bytes", "max_count", "updated_at"}),
+		}).
+		Create(&UserQuota{UserID: userID, FileType: fileType, MaxBytes: limit.MaxBytes, MaxCount: limit.MaxCount}).Error
+	if err != nil {
+		return fmt.Errorf("failed to set user quota: %w", err)
+	}
+	return nil
+}
+
+// RemoveUserQuota restores the role limit of a file type for a user
+func (a *Accountant) RemoveUserQuota(ctx context.Context, userID string, fileType media.FileType) error {
+	err := a.db.WithContext(ctx).
+		Where("user_id = ? AND file_type = ?", userID, fileType).
+		Delete(&UserQuota{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to remove user quota: %w", err)
+	}
+	return nil
+}
+
+// Check returns an ExceededError when the user cannot store another file of size bytes (0 if unknown)
+func (a *Accountant) Check(ctx context.Context, userID string, fileType media.FileType, size int64) error {
+	limit, usage, err := a.state(ctx, userID, fileType)
+	if err != nil {
+		return err
+	}
+	return limit.check(userID, fileType, usage.Bytes+max(size, 0), usage.Count+1)
+}
+
+// state returns the limit and usage of a user for a file type
+func (a *Accountant) state(ctx context.Context, userID string, fileType media.FileType) (Limit, Usage, error) {
+	limits, err := a.Limits(ctx, userID)
+	if err != nil {
+		return Limit{}, Usage{}, err
+	}
+
+	usage := Usage{UserID: userID, FileType: fileType}
+	err = a.db.WithContext(ctx).
+		Where("user_id = ? AND file_type = ?", userID, fileType).
+		Limit(1).
+		Find(&usage).Error
+	if err != nil {
+		return Limit{}, Usage{}, fmt.Errorf("failed to load storage usage: %w", err)
+	}
+	return limits[fileType], usage, nil
+}
+
+// charge adds bytes and count to the usage of a user. When limit is not nil, a charge that would take
+// the user over it fails with an ExceededError and leaves the usage unchanged.
+func (a *Accountant) charge(ctx context.Context, userID string, fileType media.FileType, bytes int64, count int64, limit *Limit) error {
+	db := a.db.WithContext(ctx)
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&Usage{UserID: userID, FileType: fileType}).Error; err != nil {
+		return fmt.Errorf("failed to create storage usage: %w", err)
+	}
+
+	query := db.Model(&Usage{}).Where("user_id = ? AND file_type = ?", userID, fileType)
+	if limit != nil && limit.MaxBytes > 0 && bytes > 0 {
+		query = query.Where("bytes + ? <= ?", bytes, limit.MaxBytes)
+	}
+	if limit != nil && limit.MaxCount > 0 && count > 0 {
+		query = query.Where("file_count + ? <= ?", count, limit.MaxCount)
+	}
+	result := query.Updates(map[string]interface{}{
+		"bytes":      gorm.Expr("bytes + ?", bytes),
+		"file_count": gorm.Expr("file_count + ?", count),
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update storage usage: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	usage := Usage{UserID: userID, FileType: fileType}
+	if err := db.Where("user_id = ? AND file_type = ?", userID, fileType).Limit(1).Find(&usage).Error; err != nil {
+		return fmt.Errorf("failed to load storage usage: %w", err)
+	}
+	return &ExceededError{UserID: userID, FileType: fileType, Limit: *limit, Bytes: usage.Bytes + bytes, Count: usage.Count + count}
+}
+
+// credit removes a deleted or replaced file from the usage of its owner. Failures are logged rather
+// than returned, since the file is already gone; Recalculate corrects the drift.
+func (a *Accountant) credit(ctx context.Context, fileType media.FileType, file *media.FileInfo) {
+	owner := file.Metadata[media.MetadataOwner]
+	if owner == "" {
+		return
+	}
+	if err := a.charge(ctx, owner, fileType, -file.Size, -1, nil); err != nil {
+		logger.Error("quota", "credit", "failed to credit storage usage", err, map[string]interface{}{
+			"user_id":  owner,
+			"filename": file.Filename,
+		})
+	}
+}
+
+// record charges the owner of a newly stored file, crediting the owner of the file it replaced.
+// When the charge fails, for example because it exceeds the owner's limit, the stored file is deleted
+// and the error returned. A file replacing one the owner already had is kept and charged regardless of
+// the limit instead, since deleting it would lose the replaced file as well.
+func (a *Accountant) record(ctx context.Context, fileType media.FileType, filename string, stored *media.FileInfo, previous *media.FileInfo) error {
+	owner := stored.Metadata[media.MetadataOwner]
+	previousOwner := ""
+	if previous != nil {
+		previousOwner = previous.Metadata[media.MetadataOwner]
+	}
+	if owner == "" {
+		if previousOwner != "" {
+			a.credit(ctx, fileType, previous)
+		}
+		return nil
+	}
+
+	bytes, count := stored.Size, int64(1)
+	if previousOwner == owner {
+		bytes -= previous.Size
+		count = 0
+	}
+
+	limits, err := a.Limits(ctx, owner)
+	if err == nil {
+		limit := limits[fileType]
+		err = a.charge(ctx, owner, fileType, bytes, count, &limit)
+	}
+	if err != nil && previousOwner == owner {
+		logger.Warn("quota", "record", "replaced file exceeds quota, charging it anyway", map[string]interface{}{
+			"user_id":  owner,
+			"filename": filename,
+			"error":    err.Error(),
+		})
+		return a.charge(ctx, owner, fileType, bytes, count, nil)
+	}
+	if err != nil {
+		if delErr := a.media.Delete(ctx, fileType, filename); delErr != nil {
+			logger.Error("quota", "record", "failed to delete file exceeding quota", delErr, map[string]interface{}{
+				"user_id":  owner,
+				"filename": filename,
+			})
+		}
+		return err
+	}
+
+	if previousOwner != "" && previousOwner != owner {
+		a.credit(ctx, fileType, previous)
+	}
+	return nil
+}
+
+// stat returns the stored file, or nil when it does not exist
+func (a *Accountant) stat(ctx context.Context, fileType media.FileType, filename string) (*media.FileInfo, error) {
+	info, err := a.media.Stat(ctx, fileType, filename)
+	if errors.Is(err, media.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
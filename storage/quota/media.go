@@ -0,0 +1,269 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/weiawesome/wesio-live/storage/media"
+)
+
+// Media returns a media.Media storing files on behalf of a user. Files stored through it are tagged
+// with media.MetadataOwner and charged to the user, and stores that would take the user over their
+// limits fail with an ExceededError. Deleting a file credits its owner, whoever that is. Reads pass
+// through unchanged.
+func (a *Accountant) Media(userID string) media.Media {
+	return &userMedia{Media: a.media, accountant: a, userID: userID}
+}
+
+type userMedia struct {
+	media.Media
+	accountant *Accountant
+	userID     string
+}
+
+func (u *userMedia) Upload(ctx context.Context, fileType media.FileType, filename string, data io.Reader, opts *media.UploadOptions) (string, error) {
+	limit, usage, err := u.accountant.state(ctx, u.userID, fileType)
+	if err != nil {
+		return "", err
+	}
+	previous, err := u.accountant.stat(ctx, fileType, filename)
+	if err != nil {
+		return "", err
+	}
+	replacedBytes, replacedCount := u.owned(previous)
+	if err := limit.check(u.userID, fileType, usage.Bytes-replacedBytes, usage.Count-replacedCount+1); err != nil {
+		return "", err
+	}
+
+	reader := &quotaReader{r: data, remaining: -1}
+	if limit.MaxBytes > 0 {
+		reader.remaining = limit.MaxBytes - usage.Bytes + replacedBytes
+		reader.exceeded = &ExceededError{UserID: u.userID, FileType: fileType, Limit: limit, Count: usage.Count - replacedCount + 1}
+	}
+	key, err := u.Media.Upload(ctx, fileType, filename, reader, u.options(opts))
+	if reader.err != nil {
+		reader.exceeded.Bytes = usage.Bytes - replacedBytes + reader.n
+		return "", reader.err
+	}
+	if err != nil {
+		return "", err
+	}
+
+	stored := &media.FileInfo{Filename: filename, Size: reader.n, Metadata: map[string]string{media.MetadataOwner: u.userID}}
+	if err := u.accountant.record(ctx, fileType, filename, stored, previous); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func (u *userMedia) UpdateMetadata(ctx context.Context, fileType media.FileType, filename string, metadata map[string]string) error {
+	for k := range metadata {
+		if strings.EqualFold(k, media.MetadataOwner) {
+			return fmt.Errorf("metadata key %s is managed by quota accounting", media.MetadataOwner)
+		}
+	}
+	return u.Media.UpdateMetadata(ctx, fileType, filename, metadata)
+}
+
+func (u *userMedia) Delete(ctx context.Context, fileType media.FileType, filename string) error {
+	info, err := u.accountant.stat(ctx, fileType, filename)
+	if err != nil {
+		return err
+	}
+	if err := u.Media.Delete(ctx, fileType, filename); err != nil {
+		return err
+	}
+	if info != nil {
+		u.accountant.credit(ctx, fileType, info)
+	}
+	return nil
+}
+
+func (u *userMedia) DeleteMany(ctx context.Context, fileType media.FileType, filenames []string) error {
+	infos := make([]*media.FileInfo, 0, len(filenames))
+	for _, filename := range filenames {
+		info, err := u.accountant.stat(ctx, fileType, filename)
+		if err != nil {
+			return err
+		}
+		if info != nil {
+			infos = append(infos, info)
+		}
+	}
+
+	err := u.Media.DeleteMany(ctx, fileType, filenames)
+	var failed media.DeleteErrors
+	if err != nil && !errors.As(err, &failed) {
+		return err
+	}
+	for _, info := range infos {
+		if _, ok := failed[info.Filename]; !ok {
+			u.accountant.credit(ctx, fileType, info)
+		}
+	}
+	return err
+}
+
+func (u *userMedia) InitiateUpload(ctx context.Context, fileType media.FileType, filename string, size int64, opts *media.UploadOptions) (*media.UploadSession, error) {
+	limit, usage, err := u.accountant.state(ctx, u.userID, fileType)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := u.accountant.stat(ctx, fileType, filename)
+	if err != nil {
+		return nil, err
+	}
+	replacedBytes, replacedCount := u.owned(previous)
+	if err := limit.check(u.userID, fileType, usage.Bytes-replacedBytes+max(size, 0), usage.Count-replacedCount+1); err != nil {
+		return nil, err
+	}
+	return u.Media.InitiateUpload(ctx, fileType, filename, size, u.options(opts))
+}
+
+// CompleteUpload charges the owner the session was started for, so sessions started through another
+// view or the underlying media are accounted like any other store. The uploaded parts are checked
+// against the user's quota before they replace an existing file, since parts are not metered and
+// sessions of unknown size pass InitiateUpload with no bytes charged.
+func (u *userMedia) CompleteUpload(ctx context.Context, sessionID string) (string, error) {
+	session, err := u.Media.GetUploadSession(ctx, sessionID)
+	if err != nil {
+		return "", err
+	}
+	previous, err := u.accountant.stat(ctx, session.FileType, session.Filename)
+	if err != nil {
+		return "", err
+	}
+
+	limit, usage, err := u.accountant.state(ctx, u.userID, session.FileType)
+	if err != nil {
+		return "", err
+	}
+	parts, err := u.Media.ListParts(ctx, sessionID)
+	if err != nil {
+		return "", err
+	}
+	var size int64
+	for _, part := range parts {
+		size += part.Size
+	}
+	replacedBytes, replacedCount := u.owned(previous)
+	if err := limit.check(u.userID, session.FileType, usage.Bytes-replacedBytes+size, usage.Count-replacedCount+1); err != nil {
+		return "", err
+	}
+
+	key, err := u.Media.CompleteUpload(ctx, sessionID)
+	if err != nil {
+		return "", err
+	}
+	stored, err := u.Media.Stat(ctx, session.FileType, session.Filename)
+	if err != nil {
+		return "", err
+	}
+	if err := u.accountant.record(ctx, session.FileType, session.Filename, stored, previous); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// GetUploadURL lowers the maximum size of the presigned upload to the bytes left in the user's quota
+func (u *userMedia) GetUploadURL(ctx context.Context, fileType media.FileType, filename string, constraints media.UploadConstraints) (*media.PresignedUpload, error) {
+	limit, usage, err := u.accountant.state(ctx, u.userID, fileType)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := u.accountant.stat(ctx, fileType, filename)
+	if err != nil {
+		return nil, err
+	}
+	replacedBytes, replacedCount := u.owned(previous)
+	if err := limit.check(u.userID, fileType, usage.Bytes-replacedBytes+max(constraints.MinSize, 1), usage.Count-replacedCount+1); err != nil {
+		return nil, err
+	}
+
+	if limit.MaxBytes > 0 {
+		remaining := limit.MaxBytes - usage.Bytes + replacedBytes
+		if constraints.MaxSize <= 0 || constraints.MaxSize > remaining {
+			constraints.MaxSize = remaining
+		}
+	}
+	return u.Media.GetUploadURL(ctx, fileType, filename, constraints)
+}
+
+// VerifyUpload tags an accepted presigned upload with the user and charges it. Verifying a file
+// already tagged with the user does not charge it again.
+func (u *userMedia) VerifyUpload(ctx context.Context, fileType media.FileType, filename string, constraints media.UploadConstraints) (*media.UploadedFile, error) {
+	uploaded, err := u.Media.VerifyUpload(ctx, fileType, filename, constraints)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := u.Media.Stat(ctx, fileType, filename)
+	if err != nil {
+		return nil, err
+	}
+	if stored.Metadata[media.MetadataOwner] == u.userID {
+		return uploaded, nil
+	}
+
+	previousOwner := stored.Metadata[media.MetadataOwner]
+	if err := u.Media.UpdateMetadata(ctx, fileType, filename, map[string]string{media.MetadataOwner: u.userID}); err != nil {
+		return nil, err
+	}
+	var previous *media.FileInfo
+	if previousOwner != "" {
+		// Tagged by another user, who no longer owns it
+		previous = stored
+	}
+	tagged := &media.FileInfo{Filename: filename, Size: stored.Size, Metadata: map[string]string{media.MetadataOwner: u.userID}}
+	if err := u.accountant.record(ctx, fileType, filename, tagged, previous); err != nil {
+		return nil, err
+	}
+	return uploaded, nil
+}
+
+// owned returns the size and count of a file the user is replacing, zero when it belongs to someone else
+func (u *userMedia) owned(previous *media.FileInfo) (int64, int64) {
+	if previous == nil || previous.Metadata[media.MetadataOwner] != u.userID {
+		return 0, 0
+	}
+	return previous.Size, 1
+}
+
+// options returns a copy of opts with the file tagged as owned by the user
+func (u *userMedia) options(opts *media.UploadOptions) *media.UploadOptions {
+	tagged := &media.UploadOptions{Metadata: map[string]string{media.MetadataOwner: u.userID}}
+	if opts == nil {
+		return tagged
+	}
+	tagged.ContentType = opts.ContentType
+	for k, v := range opts.Metadata {
+		if !strings.EqualFold(k, media.MetadataOwner) {
+			tagged.Metadata[k] = v
+		}
+	}
+	return tagged
+}
+
+// quotaReader fails an upload once it reads more than the bytes left in the user's quota
+type quotaReader struct {
+	r         io.Reader
+	remaining int64 // -1 for unlimited
+	n         int64
+	exceeded  *ExceededError
+	err       error
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	if q.err != nil {
+		return 0, q.err
+	}
+	n, err := q.r.Read(p)
+	q.n += int64(n)
+	if q.remaining >= 0 && q.n > q.remaining {
+		q.err = q.exceeded
+		return 0, q.err
+	}
+	return n, err
+}
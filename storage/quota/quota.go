@@ -0,0 +1,112 @@
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/weiawesome/wesio-live/libs/config"
+	"github.com/weiawesome/wesio-live/storage/media"
+)
+
+// ErrQuotaExceeded is matched by every ExceededError
+var ErrQuotaExceeded = errors.New("quota: storage quota exceeded")
+
+// DefaultRole holds the limits of roles without their own entry in a Policy
+const DefaultRole = "default"
+
+// Limit caps the storage of one file type. Zero fields are unlimited.
+type Limit struct {
+	MaxBytes int64
+	MaxCount int64
+}
+
+// Limits maps file types to their limit; file types without an entry are unlimited
+type Limits map[media.FileType]Limit
+
+// Policy holds the limits of each role. A role without an entry uses DefaultRole,
+// and a user without a matching role is unlimited.
+type Policy struct {
+	Roles map[string]Limits
+}
+
+// PolicyFromConfig builds a policy from the media quota configuration
+func PolicyFromConfig(cfg config.MediaQuotaConfig) (Policy, error) {
+	policy := Policy{Roles: make(map[string]Limits, len(cfg.Roles))}
+	for role, limits := range cfg.Roles {
+		policy.Roles[role] = make(Limits, len(limits))
+		for name, limit := range limits {
+			fileType, err := media.FileTypeFromConfigKey(name)
+			if err != nil {
+				return Policy{}, fmt.Errorf("invalid quota of role %s: %w", role, err)
+			}
+			policy.Roles[role][fileType] = Limit{MaxBytes: limit.MaxBytes, MaxCount: limit.MaxCount}
+		}
+	}
+	return policy, nil
+}
+
+// limitsFor returns the limits of a role
+func (p Policy) limitsFor(role string) Limits {
+	if limits, ok := p.Roles[role]; ok {
+		return limits
+	}
+	return p.Roles[DefaultRole]
+}
+
+// UserQuota overrides the role limit of one file type for a single user
+type UserQuota struct {
+	UserID    string         `json:"user_id" gorm:"primaryKey"`
+	FileType  media.FileType `json:"file_type" gorm:"primaryKey"`
+	MaxBytes  int64          `json:"max_bytes" gorm:"not null;default:0"`
+	MaxCount  int64          `json:"max_count" gorm:"not null;default:0"`
+	UpdatedAt time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// Usage is the storage a user holds of one file type
+type Usage struct {
+	UserID    string         `json:"user_id" gorm:"primaryKey"`
+	FileType  media.FileType `json:"file_type" gorm:"primaryKey"`
+	Bytes     int64          `json:"bytes" gorm:"not null;default:0"`
+	Count     int64          `json:"count" gorm:"column:file_count;not null;default:0"`
+	UpdatedAt time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (Usage) TableName() string {
+	return "storage_usages"
+}
+
+// ExceededError is returned when a file would take a user over their limit. It matches ErrQuotaExceeded.
+type ExceededError struct {
+	UserID   string
+	FileType media.FileType
+	Limit    Limit
+	Bytes    int64 // Bytes the user would hold; a lower bound when an upload is cut short
+	Count    int64 // Files the user would hold
+}
+
+func (e *ExceededError) Error() string {
+	if e.Limit.MaxCount > 0 && e.Count > e.Limit.MaxCount {
+		return fmt.Sprintf("quota: user %s would hold %d %s files, limit is %d", e.UserID, e.Count, fileTypeName(e.FileType), e.Limit.MaxCount)
+	}
+	return fmt.Sprintf("quota: user %s would hold %d bytes of %s files, limit is %d", e.UserID, e.Bytes, fileTypeName(e.FileType), e.Limit.MaxBytes)
+}
+
+func (e *ExceededError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// check returns an ExceededError when holding bytes and count files exceeds limit
+func (l Limit) check(userID string, fileType media.FileType, bytes int64, count int64) error {
+	if (l.MaxBytes > 0 && bytes > l.MaxBytes) || (l.MaxCount > 0 && count > l.MaxCount) {
+		return &ExceededError{UserID: userID, FileType: fileType, Limit: l, Bytes: bytes, Count: count}
+	}
+	return nil
+}
+
+func fileTypeName(fileType media.FileType) string {
+	if fileType == "" {
+		return "file"
+	}
+	return string(fileType)
+}
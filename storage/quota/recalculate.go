@@ -0,0 +1,163 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/weiawesome/wesio-live/libs/logger"
+	"github.com/weiawesome/wesio-live/storage/media"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// recalculatePageSize is the number of files listed per page by Recalculate
+const recalculatePageSize = 1000
+
+// ReportEntry compares the recorded usage of a user with the files they own in storage
+type ReportEntry struct {
+	UserID        string
+	FileType      media.FileType
+	RecordedBytes int64
+	RecordedCount int64
+	StoredBytes   int64
+	StoredCount   int64
+}
+
+// Drifted reports whether the recorded usage differs from storage
+func (e ReportEntry) Drifted() bool {
+	return e.RecordedBytes != e.StoredBytes || e.RecordedCount != e.StoredCount
+}
+
+// Report is the result of Recalculate
+type Report struct {
+	Entries []ReportEntry // Ordered by user and file type
+	Scanned int           // Files listed
+	Unowned int           // Files without an owner, which count against no quota
+	Fixed   int           // Drifted entries overwritten with the stored usage
+}
+
+// Drifted returns the entries whose recorded usage differs from storage
+func (r *Report) Drifted() []ReportEntry {
+	var drifted []ReportEntry
+	for _, e := range r.Entries {
+		if e.Drifted() {
+			drifted = append(drifted, e)
+		}
+	}
+	return drifted
+}
+
+// Recalculate sums the files each user owns in storage and compares the totals with the recorded
+// usage. Only files tagged with media.MetadataOwner count, so room recordings are charged to no one.
+// With fix, drifted usage is overwritten with the stored totals. Files stored or deleted while
+// storage is scanned can be miscounted, so fixes are best applied while uploads are quiet.
+// fileTypes defaults to every file type.
+func (a *Accountant) Recalculate(ctx context.Context, fileTypes []media.FileType, fix bool) (*Report, error) {
+	if len(fileTypes) == 0 {
+		fileTypes = []media.FileType{media.Image, media.Video, ""}
+	}
+
+	type usageKey struct {
+		userID   string
+		fileType media.FileType
+	}
+	entries := make(map[usageKey]*ReportEntry)
+	entry := func(userID string, fileType media.FileType) *ReportEntry {
+		key := usageKey{userID, fileType}
+		if entries[key] == nil {
+			entries[key] = &ReportEntry{UserID: userID, FileType: fileType}
+		}
+		return entries[key]
+	}
+
+	var recorded []Usage
+	if err := a.db.WithContext(ctx).Where("file_type IN ?", fileTypes).Find(&recorded).Error; err != nil {
+		return nil, fmt.Errorf("failed to load storage usage: %w", err)
+	}
+	for _, usage := range recorded {
+		e := entry(usage.UserID, usage.FileType)
+		e.RecordedBytes = usage.Bytes
+		e.RecordedCount = usage.Count
+	}
+
+	report := &Report{}
+	for _, fileType := range fileTypes {
+		cursor := ""
+		for {
+			page, err := a.media.List(ctx, fileType, "", cursor, recalculatePageSize)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, file := range page.Files {
+				report.Scanned++
+				info := &file
+				if info.Metadata == nil {
+					// Listing may leave metadata empty, and encrypted files list their stored size
+					info, err = a.stat(ctx, fileType, file.Filename)
+					if err != nil {
+						return nil, err
+					}
+					if info == nil {
+						continue
+					}
+				}
+
+				owner := info.Metadata[media.MetadataOwner]
+				if owner == "" {
+					report.Unowned++
+					continue
+				}
+				e := entry(owner, fileType)
+				e.StoredBytes += info.Size
+				e.StoredCount++
+			}
+
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+	}
+
+	for _, e := range entries {
+		report.Entries = append(report.Entries, *e)
+	}
+	sort.Slice(report.Entries, func(i, j int) bool {
+		if report.Entries[i].UserID != report.Entries[j].UserID {
+			return report.Entries[i].UserID < report.Entries[j].UserID
+		}
+		return report.Entries[i].FileType < report.Entries[j].FileType
+	})
+
+	if !fix {
+		return report, nil
+	}
+	drifted := report.Drifted()
+	if len(drifted) == 0 {
+		return report, nil
+	}
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, e := range drifted {
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}, {Name: "file_type"}},
+				DoUpdates: clause.AssignmentColumns([]string{"bytes", "file_count", "updated_at"}),
+			}).Create(&Usage{UserID: e.UserID, FileType: e.FileType, Bytes: e.StoredBytes, Count: e.StoredCount}).Error
+			if err != nil {
+				return fmt.Errorf("failed to fix storage usage: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Fixed = len(drifted)
+
+	logger.Info("quota", "recalculate", "fixed drifted storage usage", map[string]interface{}{
+		"scanned": report.Scanned,
+		"fixed":   report.Fixed,
+	})
+	return report, nil
+}
@@ -0,0 +1,41 @@
+package room
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/weiawesome/wesio-live/libs/events"
+	pb "github.com/weiawesome/wesio-live/libs/events/proto"
+	"github.com/weiawesome/wesio-live/storage/outbox"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// End marks the room as ended and records a RoomEnded event in the same transaction.
+// Ending a room that has already ended is a no-op.
+func End(ctx context.Context, db *gorm.DB, roomID string, meta events.Metadata) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Room{}).
+			Where("id = ? AND is_ended = ?", roomID, false).
+			Update("is_ended", true)
+		if result.Error != nil {
+			return fmt.Errorf("failed to end room: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		var userID string
+		if err := tx.Model(&Room{}).Where("id = ?", roomID).Pluck("user_id", &userID).Error; err != nil {
+			return fmt.Errorf("failed to load room owner: %w", err)
+		}
+
+		meta.AggregateID = roomID
+		_, err := outbox.Record(tx, &pb.RoomEnded{
+			RoomId:  roomID,
+			UserId:  userID,
+			EndedAt: timestamppb.Now(),
+		}, meta)
+		return err
+	})
+}
@@ -0,0 +1,84 @@
+package room
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// recordingBatchSize is the number of rows read per query by RecordingReferences
+const recordingBatchSize = 1000
+
+// RecordingReferences returns a media.ReferenceSource reporting the storage keys of every segment,
+// init segment and manifest of every recording, so the media garbage collector keeps recordings that still exist.
+func RecordingReferences(db *gorm.DB) func(ctx context.Context, yield func(ref string) error) error {
+	return func(ctx context.Context, yield func(ref string) error) error {
+		type recordingRow struct {
+			ID          string
+			InitKey     *string
+			ManifestKey *string
+		}
+
+		lastID := ""
+		for {
+			var rows []recordingRow
+			err := db.WithContext(ctx).Model(&Recording{}).
+				Select("id", "init_key", "manifest_key").
+				Where("id > ?", lastID).
+				Order("id").
+				Limit(recordingBatchSize).
+				Find(&rows).Error
+			if err != nil {
+				return fmt.Errorf("failed to load recordings: %w", err)
+			}
+
+			for _, row := range rows {
+				for _, ref := range []*string{row.InitKey, row.ManifestKey} {
+					if ref == nil {
+						continue
+					}
+					if err := yield(*ref); err != nil {
+						return err
+					}
+				}
+			}
+			if len(rows) < recordingBatchSize {
+				break
+			}
+			lastID = rows[len(rows)-1].ID
+		}
+
+		type segmentRow struct {
+			RecordingID string
+			Sequence    int
+			Key         string
+		}
+
+		lastRecordingID, lastSequence := "", -1
+		for {
+			var rows []segmentRow
+			err := db.WithContext(ctx).Model(&RecordingSegment{}).
+				Select("recording_id", "sequence", "key").
+				Where("recording_id > ? OR (recording_id = ? AND sequence > ?)", lastRecordingID, lastRecordingID, lastSequence).
+				Order("recording_id").
+				Order("sequence").
+				Limit(recordingBatchSize).
+				Find(&rows).Error
+			if err != nil {
+				return fmt.Errorf("failed to load recording segments: %w", err)
+			}
+
+			for _, row := range rows {
+				if err := yield(row.Key); err != nil {
+					return err
+				}
+			}
+			if len(rows) < recordingBatchSize {
+				return nil
+			}
+			last := rows[len(rows)-1]
+			lastRecordingID, lastSequence = last.RecordingID, last.Sequence
+		}
+	}
+}
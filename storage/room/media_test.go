@@ -0,0 +1,73 @@
+package room_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/weiawesome/wesio-live/libs/events"
+	"github.com/weiawesome/wesio-live/storage/media"
+	"github.com/weiawesome/wesio-live/storage/media/mediatest"
+	"github.com/weiawesome/wesio-live/storage/outbox"
+	"github.com/weiawesome/wesio-live/storage/room"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func TestRecordingReferencesKeepRecording(t *testing.T) {
+	ctx := context.Background()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&room.Recording{}, &room.RecordingSegment{}, &outbox.Message{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	// Room stores its tags as a slice, which sqlite cannot bind, so create the table by hand
+	err = db.Exec(`CREATE TABLE rooms (id TEXT PRIMARY KEY, user_id TEXT, is_ended BOOLEAN NOT NULL DEFAULT false)`).Error
+	if err == nil {
+		err = db.Exec(`INSERT INTO rooms (id, user_id) VALUES (?, ?)`, "room-1", "user-1").Error
+	}
+	if err != nil {
+		t.Fatalf("failed to create room: %v", err)
+	}
+
+	// Binary content sniffed as application/octet-stream, which video uploads accept
+	fragment := []byte{0x00, 0x00, 0x00, 0x08, 0x00, 0x01, 0x02, 0x03}
+	m := mediatest.CreateMemoryMedia()
+	w, err := room.StartRecording(ctx, db, m, "room-1", room.SegmentFMP4)
+	if err != nil {
+		t.Fatalf("StartRecording: %v", err)
+	}
+	if err := w.WriteInit(ctx, bytes.NewReader(fragment)); err != nil {
+		t.Fatalf("WriteInit: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := w.WriteSegment(ctx, bytes.NewReader(fragment), 2*time.Second); err != nil {
+			t.Fatalf("WriteSegment: %v", err)
+		}
+	}
+	if _, err := w.Finalize(ctx, events.Metadata{Producer: "room-test"}); err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+	stored := m.Len()
+
+	gc := media.CreateGarbageCollector(m, []media.ReferenceSource{room.RecordingReferences(db)}, media.GCOptions{
+		MinAge: time.Nanosecond,
+	})
+	time.Sleep(time.Millisecond)
+	result, err := gc.Collect(ctx)
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if result.Deleted != 0 || len(result.Orphans) != 0 {
+		t.Fatalf("collected recording files: %v", result.Orphans)
+	}
+	if result.Referenced != stored || m.Len() != stored {
+		t.Fatalf("referenced %d of %d stored files, %d left", result.Referenced, stored, m.Len())
+	}
+}
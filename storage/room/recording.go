@@ -0,0 +1,68 @@
+package room
+
+import (
+	"path"
+	"time"
+
+	"github.com/weiawesome/wesio-live/storage/media/hls"
+)
+
+// RecordingStatus is the lifecycle state of a recording
+type RecordingStatus string
+
+const (
+	RecordingActive RecordingStatus = "recording" // Segments are being written
+	RecordingReady  RecordingStatus = "ready"     // Finalized, the manifest is playable
+	RecordingFailed RecordingStatus = "failed"    // Aborted or finalized without segments
+)
+
+// SegmentFormat is the container of recording segments
+type SegmentFormat = hls.SegmentFormat
+
+const (
+	SegmentTS   = hls.TS   // MPEG-TS, self-contained segments
+	SegmentFMP4 = hls.FMP4 // Fragmented MP4, segments share an init segment
+)
+
+// Recording is the stored video of a live session in a room.
+// Its files are media.Video files under Prefix.
+type Recording struct {
+	ID            string          `json:"id" gorm:"primaryKey"`
+	RoomID        string          `json:"room_id" gorm:"not null;index"`
+	UserID        string          `json:"user_id" gorm:"not null;index"`
+	Status        RecordingStatus `json:"status" gorm:"not null;default:recording;index"`
+	Format        SegmentFormat   `json:"format" gorm:"not null"`
+	Prefix        string          `json:"prefix" gorm:"not null"`
+	InitFilename  *string         `json:"init_filename" gorm:"type:text"`
+	InitKey       *string         `json:"init_key" gorm:"type:text"` // Storage key of the init segment
+	Manifest      *string         `json:"manifest" gorm:"type:text"` // Filename of the playlist, set once ready
+	ManifestKey   *string         `json:"manifest_key" gorm:"type:text"`
+	SegmentCount  int             `json:"segment_count" gorm:"not null;default:0"`
+	DurationMs    int64           `json:"duration_ms" gorm:"not null;default:0"`
+	Size          int64           `json:"size" gorm:"not null;default:0"`
+	FailureReason *string         `json:"failure_reason" gorm:"type:text"`
+	StartedAt     time.Time       `json:"started_at" gorm:"autoCreateTime"`
+	EndedAt       *time.Time      `json:"ended_at"`
+	UpdatedAt     time.Time       `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// RecordingSegment is one stored media segment of a recording, in playback order
+type RecordingSegment struct {
+	RecordingID string    `json:"recording_id" gorm:"primaryKey"`
+	Sequence    int       `json:"sequence" gorm:"primaryKey;autoIncrement:false"`
+	Filename    string    `json:"filename" gorm:"not null"`
+	Key         string    `json:"key" gorm:"not null"`
+	DurationMs  int64     `json:"duration_ms" gorm:"not null"`
+	Size        int64     `json:"size" gorm:"not null"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// Duration returns the total playback duration recorded so far
+func (r *Recording) Duration() time.Duration {
+	return time.Duration(r.DurationMs) * time.Millisecond
+}
+
+// recordingPrefix returns the media filename prefix holding the files of a recording
+func recordingPrefix(roomID string, recordingID string) string {
+	return path.Join("recordings", roomID, recordingID)
+}
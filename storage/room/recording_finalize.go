@@ -0,0 +1,193 @@
+package room
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/weiawesome/wesio-live/libs/events"
+	pb "github.com/weiawesome/wesio-live/libs/events/proto"
+	"github.com/weiawesome/wesio-live/libs/logger"
+	"github.com/weiawesome/wesio-live/storage/media"
+	"github.com/weiawesome/wesio-live/storage/media/hls"
+	"github.com/weiawesome/wesio-live/storage/outbox"
+	"gorm.io/gorm"
+)
+
+// Finalize stops the recording, stores a VOD playlist of its segments next to them and marks it ready,
+// recording a MediaUploaded event for the playlist in the same transaction. A recording without
+// segments is marked failed instead. Finalizing a ready recording returns it unchanged.
+func (w *RecordingWriter) Finalize(ctx context.Context, meta events.Metadata) (*Recording, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	recording, err := FinalizeRecording(ctx, w.db, w.media, w.recording.ID, meta)
+	if err != nil {
+		return nil, err
+	}
+	w.recording = recording
+	return recording, nil
+}
+
+// Abort marks the recording failed, keeping the segments written so far for inspection
+func (w *RecordingWriter) Abort(ctx context.Context, reason string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := failRecording(w.db.WithContext(ctx), w.recording.ID, reason); err != nil {
+		return err
+	}
+	now := time.Now()
+	w.recording.Status = RecordingFailed
+	w.recording.FailureReason = &reason
+	w.recording.EndedAt = &now
+	return nil
+}
+
+// FinalizeRecording finalizes the recording like RecordingWriter.Finalize, without needing the writer
+// that recorded it
+func FinalizeRecording(ctx context.Context, db *gorm.DB, m media.Media, recordingID string, meta events.Metadata) (*Recording, error) {
+	recording, err := loadRecording(ctx, db, recordingID)
+	if err != nil {
+		return nil, err
+	}
+	switch recording.Status {
+	case RecordingReady:
+		return recording, nil
+	case RecordingFailed:
+		return nil, fmt.Errorf("%w: %s has failed", ErrRecordingNotActive, recordingID)
+	}
+
+	var segments []RecordingSegment
+	err = db.WithContext(ctx).
+		Where("recording_id = ?", recordingID).
+		Order("sequence").
+		Find(&segments).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load recording segments: %w", err)
+	}
+
+	if len(segments) == 0 {
+		if err := failRecording(db.WithContext(ctx), recordingID, "no segments recorded"); err != nil {
+			return nil, err
+		}
+		return loadRecording(ctx, db, recordingID)
+	}
+
+	playlist := vodPlaylist(recording, segments)
+	manifest := path.Join(recording.Prefix, "index.m3u8")
+	key, err := m.Upload(ctx, media.Video, manifest, bytes.NewReader(playlist), &media.UploadOptions{
+		ContentType: hls.ContentType,
+		Metadata: map[string]string{
+			"room-id":      recording.RoomID,
+			"recording-id": recording.ID,
+			"user-id":      recording.UserID,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store recording manifest: %w", err)
+	}
+
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Recording{}).
+			Where("id = ? AND status = ?", recordingID, RecordingActive).
+			Updates(map[string]interface{}{
+				"status":       RecordingReady,
+				"manifest":     manifest,
+				"manifest_key": key,
+				"ended_at":     time.Now(),
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to finalize recording: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			// Finalized or aborted concurrently
+			return nil
+		}
+
+		meta.AggregateID = recording.RoomID
+		_, err := outbox.Record(tx, &pb.MediaUploaded{
+			FileType:       string(media.Video),
+			Key:            key,
+			Filename:       manifest,
+			ContentType:    hls.ContentType,
+			Size:           int64(len(playlist)),
+			UploaderUserId: recording.UserID,
+			RoomId:         recording.RoomID,
+		}, meta)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("room", "finalize_recording", "recording finalized", map[string]interface{}{
+		"recording_id": recordingID,
+		"room_id":      recording.RoomID,
+		"segments":     len(segments),
+	})
+	return loadRecording(ctx, db, recordingID)
+}
+
+// FinalizeRoomRecordings finalizes every active recording of the room. Call it when the room ends,
+// for example from a RoomEnded event consumer. Failures are logged and the first one is returned
+// after the remaining recordings have been attempted.
+func FinalizeRoomRecordings(ctx context.Context, db *gorm.DB, m media.Media, roomID string, meta events.Metadata) error {
+	var ids []string
+	err := db.WithContext(ctx).Model(&Recording{}).
+		Where("room_id = ? AND status = ?", roomID, RecordingActive).
+		Order("started_at").
+		Pluck("id", &ids).Error
+	if err != nil {
+		return fmt.Errorf("failed to load room recordings: %w", err)
+	}
+
+	var firstErr error
+	for _, id := range ids {
+		if _, err := FinalizeRecording(ctx, db, m, id, meta); err != nil {
+			logger.Error("room", "finalize_recording", "failed to finalize recording", err, map[string]interface{}{
+				"recording_id": id,
+				"room_id":      roomID,
+			})
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func failRecording(db *gorm.DB, recordingID string, reason string) error {
+	result := db.Model(&Recording{}).
+		Where("id = ? AND status = ?", recordingID, RecordingActive).
+		Updates(map[string]interface{}{
+			"status":         RecordingFailed,
+			"failure_reason": reason,
+			"ended_at":       time.Now(),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update recording: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrRecordingNotActive, recordingID)
+	}
+	return nil
+}
+
+// vodPlaylist returns an HLS VOD playlist of the segments. URIs are relative to the playlist,
+// which is stored in the same directory as the segments.
+func vodPlaylist(recording *Recording, segments []RecordingSegment) []byte {
+	playlist := hls.MediaPlaylist{Type: hls.VOD}
+	if recording.InitFilename != nil {
+		playlist.Map = path.Base(*recording.InitFilename)
+	}
+	for _, s := range segments {
+		playlist.Segments = append(playlist.Segments, hls.Segment{
+			URI:      path.Base(s.Filename),
+			Duration: time.Duration(s.DurationMs) * time.Millisecond,
+		})
+	}
+	return playlist.Encode()
+}
@@ -0,0 +1,256 @@
+package room
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/weiawesome/wesio-live/libs/logger"
+	"github.com/weiawesome/wesio-live/storage/media"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrRoomNotFound is returned when recording a room that does not exist
+	ErrRoomNotFound = errors.New("room: room not found")
+	// ErrRoomEnded is returned when recording a room that has already ended
+	ErrRoomEnded = errors.New("room: room has ended")
+	// ErrRecordingNotFound is returned for unknown recording IDs
+	ErrRecordingNotFound = errors.New("room: recording not found")
+	// ErrRecordingNotActive is returned when writing to a recording that is finalized or failed
+	ErrRecordingNotActive = errors.New("room: recording is not active")
+)
+
+// RecordingWriter persists the segments of a live session as media.Video files.
+// It is safe for concurrent use; segments are numbered in the order writes complete.
+type RecordingWriter struct {
+	db    *gorm.DB
+	media media.Media
+	// writerID tells apart the segment files of writers of the same recording, such as a resumed
+	// writer started while the previous process is still writing
+	writerID string
+
+	mu           sync.Mutex
+	recording    *Recording
+	nextSequence int
+}
+
+// StartRecording creates an active recording of the room, which must exist and not have ended
+func StartRecording(ctx context.Context, db *gorm.DB, m media.Media, roomID string, format SegmentFormat) (*RecordingWriter, error) {
+	if format != SegmentTS && format != SegmentFMP4 {
+		return nil, fmt.Errorf("unsupported segment format %q", format)
+	}
+
+	var room Room
+	err := db.WithContext(ctx).Select("id", "user_id", "is_ended").Where("id = ?", roomID).Take(&room).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrRoomNotFound, roomID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load room: %w", err)
+	}
+	if room.IsEnded {
+		return nil, fmt.Errorf("%w: %s", ErrRoomEnded, roomID)
+	}
+
+	id := uuid.NewString()
+	recording := &Recording{
+		ID:     id,
+		RoomID: roomID,
+		UserID: room.UserID,
+		Status: RecordingActive,
+		Format: format,
+		Prefix: recordingPrefix(roomID, id),
+	}
+	if err := db.WithContext(ctx).Create(recording).Error; err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+
+	return &RecordingWriter{db: db, media: m, writerID: newWriterID(), recording: recording}, nil
+}
+
+// OpenRecording resumes writing an active recording, such as after the writing process restarted
+func OpenRecording(ctx context.Context, db *gorm.DB, m media.Media, recordingID string) (*RecordingWriter, error) {
+	recording, err := loadRecording(ctx, db, recordingID)
+	if err != nil {
+		return nil, err
+	}
+	if recording.Status != RecordingActive {
+		return nil, fmt.Errorf("%w: %s is %s", ErrRecordingNotActive, recordingID, recording.Status)
+	}
+
+	var last *int
+	err = db.WithContext(ctx).Model(&RecordingSegment{}).
+		Where("recording_id = ?", recordingID).
+		Select("MAX(sequence)").
+		Scan(&last).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load recording segments: %w", err)
+	}
+
+	w := &RecordingWriter{db: db, media: m, writerID: newWriterID(), recording: recording}
+	if last != nil {
+		w.nextSequence = *last + 1
+	}
+	return w, nil
+}
+
+// Recording returns a copy of the recording as last written
+func (w *RecordingWriter) Recording() Recording {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return *w.recording
+}
+
+// WriteInit stores the initialization segment of a fragmented MP4 recording, replacing any earlier one
+func (w *RecordingWriter) WriteInit(ctx context.Context, data io.Reader) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.recording.Format != SegmentFMP4 {
+		return fmt.Errorf("%s recordings have no init segment", w.recording.Format)
+	}
+	if w.recording.Status != RecordingActive {
+		return fmt.Errorf("%w: %s", ErrRecordingNotActive, w.recording.ID)
+	}
+
+	filename := path.Join(w.recording.Prefix, "init.mp4")
+	key, err := w.media.Upload(ctx, media.Video, filename, data, &media.UploadOptions{
+		ContentType: "video/mp4",
+		Metadata:    w.metadata(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store init segment: %w", err)
+	}
+
+	err = w.db.WithContext(ctx).Model(&Recording{}).
+		Where("id = ?", w.recording.ID).
+		Updates(map[string]interface{}{
+			"init_filename": filename,
+			"init_key":      key,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update recording: %w", err)
+	}
+	w.recording.InitFilename = &filename
+	w.recording.InitKey = &key
+	return nil
+}
+
+// WriteSegment stores the next media segment, lasting duration, and adds it to the recording.
+// If the segment cannot be recorded in the database, the stored file is deleted. Segment filenames
+// include the writer, so a segment another writer recorded under the same sequence is never replaced.
+func (w *RecordingWriter) WriteSegment(ctx context.Context, data io.Reader, duration time.Duration) (*RecordingSegment, error) {
+	if duration <= 0 {
+		return nil, fmt.Errorf("invalid segment duration %s", duration)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.recording.Status != RecordingActive {
+		return nil, fmt.Errorf("%w: %s", ErrRecordingNotActive, w.recording.ID)
+	}
+
+	sequence := w.nextSequence
+	filename := path.Join(w.recording.Prefix, fmt.Sprintf("segment-%06d-%s%s", sequence, w.writerID, w.recording.Format.Extension()))
+	counter := &countingReader{r: data}
+	key, err := w.media.Upload(ctx, media.Video, filename, counter, &media.UploadOptions{
+		ContentType: w.recording.Format.ContentType(),
+		Metadata:    w.metadata(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store segment %d: %w", sequence, err)
+	}
+
+	segment := &RecordingSegment{
+		RecordingID: w.recording.ID,
+		Sequence:    sequence,
+		Filename:    filename,
+		Key:         key,
+		DurationMs:  duration.Milliseconds(),
+		Size:        counter.n,
+	}
+	err = w.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Recording{}).
+			Where("id = ? AND status = ?", w.recording.ID, RecordingActive).
+			Updates(map[string]interface{}{
+				"segment_count": gorm.Expr("segment_count + 1"),
+				"duration_ms":   gorm.Expr("duration_ms + ?", segment.DurationMs),
+				"size":          gorm.Expr("size + ?", segment.Size),
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to update recording: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w: %s", ErrRecordingNotActive, w.recording.ID)
+		}
+		if err := tx.Create(segment).Error; err != nil {
+			return fmt.Errorf("failed to record segment: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		w.discard(ctx, filename)
+		return nil, err
+	}
+
+	w.nextSequence++
+	w.recording.SegmentCount++
+	w.recording.DurationMs += segment.DurationMs
+	w.recording.Size += segment.Size
+	return segment, nil
+}
+
+// newWriterID returns a short random identifier for the segment filenames of a writer
+func newWriterID() string {
+	return uuid.NewString()[:8]
+}
+
+// metadata returns the object metadata stored with every file of the recording
+func (w *RecordingWriter) metadata() map[string]string {
+	return map[string]string{
+		"room-id":      w.recording.RoomID,
+		"recording-id": w.recording.ID,
+		"user-id":      w.recording.UserID,
+	}
+}
+
+// discard deletes a segment that could not be added to the recording
+func (w *RecordingWriter) discard(ctx context.Context, filename string) {
+	if err := w.media.Delete(context.WithoutCancel(ctx), media.Video, filename); err != nil {
+		logger.Error("room", "write_segment", "failed to delete unrecorded segment", err, map[string]interface{}{
+			"recording_id": w.recording.ID,
+			"filename":     filename,
+		})
+	}
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func loadRecording(ctx context.Context, db *gorm.DB, recordingID string) (*Recording, error) {
+	var recording Recording
+	err := db.WithContext(ctx).Where("id = ?", recordingID).Take(&recording).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrRecordingNotFound, recordingID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load recording: %w", err)
+	}
+	return &recording, nil
+}
@@ -0,0 +1,70 @@
+package uploads
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/weiawesome/wesio-live/storage/media"
+)
+
+// defaultAuditLimit is the page size used by Audit when the filter has no limit
+const defaultAuditLimit = 100
+
+// AuditFilter selects upload records. Empty fields match every record.
+type AuditFilter struct {
+	UploaderUserID string
+	RoomID         string
+	Hash           string // Every upload of the same content
+	FileType       *media.FileType
+	Since          time.Time // Uploaded at or after
+	Until          time.Time // Uploaded before
+	Before         string    // ID of the last record of the previous page, "" for the first page
+	Limit          int
+}
+
+// Audit returns upload records matching filter, newest first, including released uploads
+func (s *Store) Audit(ctx context.Context, filter AuditFilter) ([]Upload, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+
+	query := s.db.WithContext(ctx).Model(&Upload{})
+	if filter.UploaderUserID != "" {
+		query = query.Where("uploader_user_id = ?", filter.UploaderUserID)
+	}
+	if filter.RoomID != "" {
+		query = query.Where("room_id = ?", filter.RoomID)
+	}
+	if filter.Hash != "" {
+		query = query.Where("hash = ?", filter.Hash)
+	}
+	if filter.FileType != nil {
+		query = query.Where("file_type = ?", *filter.FileType)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+	if filter.Before != "" {
+		var last Upload
+		if err := s.db.WithContext(ctx).Select("id", "created_at").Where("id = ?", filter.Before).First(&last).Error; err != nil {
+			return nil, fmt.Errorf("failed to load audit cursor: %w", err)
+		}
+		query = query.Where("created_at < ? OR (created_at = ? AND id < ?)", last.CreatedAt, last.CreatedAt, last.ID)
+	}
+
+	var records []Upload
+	err := query.
+		Order("created_at DESC").
+		Order("id DESC").
+		Limit(limit).
+		Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load upload records: %w", err)
+	}
+	return records, nil
+}
@@ -0,0 +1,51 @@
+package uploads
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/weiawesome/wesio-live/storage/media"
+	"gorm.io/gorm"
+)
+
+// blobBatchSize is the number of rows read per query by BlobReferences
+const blobBatchSize = 1000
+
+// BlobReferences returns a media.ReferenceSource reporting the key of all stored content that is
+// still referenced by an upload, so the media garbage collector removes content once it is released.
+func BlobReferences(db *gorm.DB) func(ctx context.Context, yield func(ref string) error) error {
+	return func(ctx context.Context, yield func(ref string) error) error {
+		type blobRow struct {
+			FileType media.FileType
+			Hash     string
+			Key      string
+		}
+
+		lastFileType, lastHash := media.FileType(""), ""
+		for {
+			var rows []blobRow
+			err := db.WithContext(ctx).Model(&Blob{}).
+				Select("file_type", "hash", "key").
+				Where("ref_count > 0").
+				Where("file_type > ? OR (file_type = ? AND hash > ?)", lastFileType, lastFileType, lastHash).
+				Order("file_type").
+				Order("hash").
+				Limit(blobBatchSize).
+				Find(&rows).Error
+			if err != nil {
+				return fmt.Errorf("failed to load stored content: %w", err)
+			}
+
+			for _, row := range rows {
+				if err := yield(row.Key); err != nil {
+					return err
+				}
+			}
+			if len(rows) < blobBatchSize {
+				return nil
+			}
+			last := rows[len(rows)-1]
+			lastFileType, lastHash = last.FileType, last.Hash
+		}
+	}
+}
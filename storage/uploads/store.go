@@ -0,0 +1,234 @@
+package uploads
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/weiawesome/wesio-live/libs/logger"
+	"github.com/weiawesome/wesio-live/storage/media"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Options configures a Store
+type Options struct {
+	Prefix  string // Filename prefix of stored content
+	MaxSize int64  // Largest accepted upload, which bounds the spooled copy
+	TempDir string // Directory uploads are spooled to while hashed, "" for the system default
+}
+
+// DefaultOptions returns default store options
+func DefaultOptions() Options {
+	return Options{
+		Prefix:  "content",
+		MaxSize: media.DefaultMaxUploadSize,
+	}
+}
+
+// PutOptions describes an upload for its audit record
+type PutOptions struct {
+	UploaderUserID   string
+	RoomID           string // Room the file was uploaded to, "" for none
+	OriginalFilename string // Filename chosen by the uploader
+	ContentType      string // Declared content type, "" to sniff it
+}
+
+// Store keeps uploaded files by content address, storing identical content once, and records an
+// audit trail of every upload. Content whose uploads are all released is left to the media garbage
+// collector, which keeps it while BlobReferences reports it.
+type Store struct {
+	db    *gorm.DB
+	media media.Media
+	opts  Options
+}
+
+func CreateStore(db *gorm.DB, m media.Media, opts Options) *Store {
+	defaults := DefaultOptions()
+	if opts.Prefix == "" {
+		opts.Prefix = defaults.Prefix
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = defaults.MaxSize
+	}
+
+	return &Store{
+		db:    db,
+		media: m,
+		opts:  opts,
+	}
+}
+
+// Put hashes data while validating it like media.Media.Upload, stores the content unless identical
+// content of the same file type is already stored, and records the upload
+func (s *Store) Put(ctx context.Context, fileType media.FileType, data io.Reader, opts PutOptions) (*Upload, error) {
+	if opts.UploaderUserID == "" {
+		return nil, errors.New("uploads need an uploader")
+	}
+
+	upload, err := media.NewUploadReader(data, fileType, &media.UploadOptions{ContentType: opts.ContentType}, s.opts.MaxSize)
+	if err != nil {
+		return nil, err
+	}
+	spool, err := os.CreateTemp(s.opts.TempDir, "wesio-upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+	if _, err := io.Copy(spool, upload); err != nil {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	record := &Upload{
+		ID:               uuid.NewString(),
+		FileType:         fileType,
+		Hash:             upload.Checksum(),
+		OriginalFilename: opts.OriginalFilename,
+		ContentType:      upload.ContentType(),
+		Size:             upload.Size(),
+		UploaderUserID:   opts.UploaderUserID,
+	}
+	if opts.RoomID != "" {
+		record.RoomID = &opts.RoomID
+	}
+
+	deduplicated, err := s.reference(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+	if !deduplicated {
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to rewind temporary file: %w", err)
+		}
+		if err := s.store(ctx, record, spool); err != nil {
+			return nil, err
+		}
+	}
+
+	logger.Info("uploads", "put", "upload stored", map[string]interface{}{
+		"upload_id":    record.ID,
+		"user_id":      record.UploaderUserID,
+		"hash":         record.Hash,
+		"size":         record.Size,
+		"deduplicated": record.Deduplicated,
+	})
+	return record, nil
+}
+
+// reference records the upload against already stored content, reporting false when there is none
+func (s *Store) reference(ctx context.Context, record *Upload) (bool, error) {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Blob{}).
+			Where("file_type = ? AND hash = ? AND ref_count > 0", record.FileType, record.Hash).
+			Update("ref_count", gorm.Expr("ref_count + 1"))
+		if result.Error != nil {
+			return fmt.Errorf("failed to reference stored content: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		var blob Blob
+		if err := tx.Where("file_type = ? AND hash = ?", record.FileType, record.Hash).First(&blob).Error; err != nil {
+			return fmt.Errorf("failed to load stored content: %w", err)
+		}
+		record.Key = blob.Key
+		record.Filename = blob.Filename
+		record.Deduplicated = true
+		if err := tx.Create(record).Error; err != nil {
+			return fmt.Errorf("failed to record upload: %w", err)
+		}
+		return nil
+	})
+	return record.Deduplicated, err
+}
+
+// store uploads new content and records the upload. Concurrent uploads of the same content both store
+// it, which is harmless since the content is identical, and share one blob.
+func (s *Store) store(ctx context.Context, record *Upload, content io.Reader) error {
+	filename := contentFilename(s.opts.Prefix, record.Hash)
+	// The content is already spooled, so declaring it lets the backend stream it without another copy
+	key, err := s.media.Upload(ctx, record.FileType, filename, content, &media.UploadOptions{
+		ContentType: record.ContentType,
+		Size:        record.Size,
+		Checksum:    record.Hash,
+	})
+	if err != nil {
+		return err
+	}
+
+	blob := &Blob{
+		FileType:    record.FileType,
+		Hash:        record.Hash,
+		Filename:    filename,
+		Key:         key,
+		Size:        record.Size,
+		ContentType: record.ContentType,
+		RefCount:    1,
+	}
+	record.Key = key
+	record.Filename = filename
+
+	// The content is left to the garbage collector on failure, since a concurrent upload may share it
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "file_type"}, {Name: "hash"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"ref_count":  gorm.Expr("media_blobs.ref_count + 1"),
+				"updated_at": time.Now(),
+			}),
+		}).Create(blob).Error
+		if err != nil {
+			return fmt.Errorf("failed to record stored content: %w", err)
+		}
+		if err := tx.Create(record).Error; err != nil {
+			return fmt.Errorf("failed to record upload: %w", err)
+		}
+		return nil
+	})
+}
+
+// Release drops the reference an upload holds on its content. The audit record is kept.
+// Releasing an upload twice has no further effect.
+func (s *Store) Release(ctx context.Context, uploadID string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var record Upload
+		err := tx.Select("id", "file_type", "hash", "released_at").Where("id = ?", uploadID).First(&record).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: %s", ErrUploadNotFound, uploadID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load upload: %w", err)
+		}
+
+		result := tx.Model(&Upload{}).
+			Where("id = ? AND released_at IS NULL", uploadID).
+			Update("released_at", time.Now())
+		if result.Error != nil {
+			return fmt.Errorf("failed to release upload: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		err = tx.Model(&Blob{}).
+			Where("file_type = ? AND hash = ?", record.FileType, record.Hash).
+			Update("ref_count", gorm.Expr("ref_count - 1")).Error
+		if err != nil {
+			return fmt.Errorf("failed to release stored content: %w", err)
+		}
+		err = tx.Where("file_type = ? AND hash = ? AND ref_count <= 0", record.FileType, record.Hash).
+			Delete(&Blob{}).Error
+		if err != nil {
+			return fmt.Errorf("failed to delete released content: %w", err)
+		}
+		return nil
+	})
+}
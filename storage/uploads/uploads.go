@@ -0,0 +1,56 @@
+package uploads
+
+import (
+	"errors"
+	"path"
+	"time"
+
+	"github.com/weiawesome/wesio-live/storage/media"
+)
+
+// ErrUploadNotFound is returned when releasing an upload that does not exist
+var ErrUploadNotFound = errors.New("uploads: upload not found")
+
+// Blob is stored content shared by every upload with the same SHA-256
+type Blob struct {
+	FileType    media.FileType `json:"file_type" gorm:"primaryKey"`
+	Hash        string         `json:"hash" gorm:"primaryKey"` // Hex SHA-256 of the content
+	Filename    string         `json:"filename" gorm:"not null"`
+	Key         string         `json:"key" gorm:"not null"`
+	Size        int64          `json:"size" gorm:"not null"`
+	ContentType string         `json:"content_type" gorm:"not null"`
+	RefCount    int64          `json:"ref_count" gorm:"not null;default:0"` // Unreleased uploads of the content
+	CreatedAt   time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (Blob) TableName() string {
+	return "media_blobs"
+}
+
+// Upload is the audit record of a file stored through a Store. Records are kept after the upload is
+// released, so they remain available to abuse investigations.
+type Upload struct {
+	ID               string         `json:"id" gorm:"primaryKey"`
+	FileType         media.FileType `json:"file_type" gorm:"not null"`
+	Hash             string         `json:"hash" gorm:"not null;index"`
+	Key              string         `json:"key" gorm:"not null"`      // Key of the shared content
+	Filename         string         `json:"filename" gorm:"not null"` // Filename of the shared content
+	OriginalFilename string         `json:"original_filename" gorm:"not null"`
+	ContentType      string         `json:"content_type" gorm:"not null"`
+	Size             int64          `json:"size" gorm:"not null"`
+	UploaderUserID   string         `json:"uploader_user_id" gorm:"not null;index"`
+	RoomID           *string        `json:"room_id" gorm:"index"`
+	Deduplicated     bool           `json:"deduplicated" gorm:"not null;default:false"` // The content was already stored
+	CreatedAt        time.Time      `json:"created_at" gorm:"autoCreateTime;index"`
+	ReleasedAt       *time.Time     `json:"released_at"`
+}
+
+func (Upload) TableName() string {
+	return "media_uploads"
+}
+
+// contentFilename returns the filename content with the given hash is stored under
+func contentFilename(prefix string, hash string) string {
+	return path.Join(prefix, hash[:2], hash)
+}
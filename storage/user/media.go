@@ -0,0 +1,46 @@
+package user
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// avatarBatchSize is the number of users read per query by AvatarReferences
+const avatarBatchSize = 1000
+
+// AvatarReferences returns a media.ReferenceSource reporting the avatar of every user,
+// so the media garbage collector keeps avatars that are still in use.
+func AvatarReferences(db *gorm.DB) func(ctx context.Context, yield func(ref string) error) error {
+	return func(ctx context.Context, yield func(ref string) error) error {
+		type avatarRow struct {
+			ID     string
+			Avatar string
+		}
+
+		lastID := ""
+		for {
+			var rows []avatarRow
+			err := db.WithContext(ctx).Model(&User{}).
+				Select("id", "avatar").
+				Where("id > ? AND avatar IS NOT NULL AND avatar <> ''", lastID).
+				Order("id").
+				Limit(avatarBatchSize).
+				Find(&rows).Error
+			if err != nil {
+				return fmt.Errorf("failed to load user avatars: %w", err)
+			}
+
+			for _, row := range rows {
+				if err := yield(row.Avatar); err != nil {
+					return err
+				}
+			}
+			if len(rows) < avatarBatchSize {
+				return nil
+			}
+			lastID = rows[len(rows)-1].ID
+		}
+	}
+}
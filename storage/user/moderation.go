@@ -0,0 +1,37 @@
+package user
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/weiawesome/wesio-live/libs/events"
+	pb "github.com/weiawesome/wesio-live/libs/events/proto"
+	"github.com/weiawesome/wesio-live/storage/outbox"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// Ban marks the user as banned and records a UserBanned event in the same transaction.
+// Banning a user who is already banned is a no-op.
+func Ban(ctx context.Context, db *gorm.DB, userID string, bannedBy string, reason string, meta events.Metadata) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).
+			Where("id = ? AND is_banned = ?", userID, false).
+			Update("is_banned", true)
+		if result.Error != nil {
+			return fmt.Errorf("failed to ban user: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		meta.AggregateID = userID
+		_, err := outbox.Record(tx, &pb.UserBanned{
+			UserId:   userID,
+			BannedBy: bannedBy,
+			Reason:   reason,
+			BannedAt: timestamppb.Now(),
+		}, meta)
+		return err
+	})
+}